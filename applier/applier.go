@@ -0,0 +1,63 @@
+// Package applier is 計測の Test が Mutation と DML を書き込む先を、接続先によらない interface にする
+//
+// 実装は以下の 3 種類
+//
+//	Client : 本物の Cloud Spanner か Emulator の spanner.Client
+//	Fake   : in-process の fakespanner に接続した spanner.Client
+//	DryRun : どこにも接続せず、estimator の見積もりが上限を超えるかどうかだけを返す
+//
+// 同じ Case の表を接続先を変えて実行できる. DryRun は network を使わないので、すぐに終わる
+package applier
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// Applier is 計測する操作を行う接続先. batch.Applier も満たす
+type Applier interface {
+	// Apply is ms を 1 つの Commit で Apply する
+	Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error)
+
+	// Update is 1 つの ReadWriteTransaction で DML の UPDATE を実行して、更新した行数を返す
+	Update(ctx context.Context, stmt spanner.Statement) (int64, error)
+
+	// Close is 接続を閉じる
+	Close()
+}
+
+// Client is spanner.Client の Applier
+type Client struct {
+	Client *spanner.Client
+}
+
+// NewClient is c の Applier を作成する. Close すると c も Close する
+func NewClient(c *spanner.Client) *Client {
+	return &Client{Client: c}
+}
+
+// Apply is spanner.Client.Apply
+func (c *Client) Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error) {
+	return c.Client.Apply(ctx, ms, opts...)
+}
+
+// Update is ReadWriteTransaction の中で stmt を実行する
+func (c *Client) Update(ctx context.Context, stmt spanner.Statement) (int64, error) {
+	var rows int64
+	_, err := c.Client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		var err error
+		rows, err = txn.Update(ctx, stmt)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+// Close is spanner.Client を Close する
+func (c *Client) Close() {
+	c.Client.Close()
+}
@@ -0,0 +1,216 @@
+package applier_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/applier"
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+)
+
+const database = "projects/fake/instances/fake/databases/fake"
+
+// limit is Test の上限. Measure の 1 行 (ID, Mark, Col1 と 3 つの Index) が 6 なので 16 行まで入る
+const limit = 100
+
+func TestApplier(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Limit = limit
+	s.AddDatabase(database, sc)
+	fake, err := applier.NewFake(ctx, s, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+
+	dryRun := applier.NewDryRun(sc, limit)
+
+	// Fake と DryRun で同じ Case が同じ結果になる
+	appliers := []struct {
+		name     string
+		applier  applier.Applier
+		rowCount func(table string) int
+	}{
+		{"fake", fake, fake.Database.RowCount},
+		{"dryrun", dryRun, dryRun.RowCount},
+	}
+
+	for _, a := range appliers {
+		a := a
+		t.Run(a.name, func(t *testing.T) {
+			cases := []struct {
+				name     string
+				mark     string
+				insert   int
+				update   bool
+				delete   int
+				wantRows int64
+				wantErr  bool
+			}{
+				{"insert N", "a", 16, false, 0, 0, false},
+				{"insert N+1", "b", 17, false, 0, 0, true},
+				// DML の UPDATE は ID と Col2 で 1 行 2 なので 50 行まで更新できる
+				{"update N", "c", 50, true, 0, 50, false},
+				{"update N+1", "d", 51, true, 0, 0, true},
+				{"delete", "e", 10, false, 10, 0, false},
+			}
+
+			for _, tt := range cases {
+				tt := tt
+				t.Run(tt.name, func(t *testing.T) {
+					var ms []*spanner.Mutation
+					var ids []string
+					for i := 0; i < tt.insert; i++ {
+						id := fmt.Sprintf("%s-%d", tt.mark, i)
+						ids = append(ids, id)
+						ms = append(ms, spanner.InsertMap("Measure", map[string]interface{}{"ID": id, "Mark": tt.mark, "Col1": ""}))
+					}
+					if tt.update || tt.delete > 0 {
+						// 前準備なので上限に収まるように分けて書き込む
+						for len(ms) > 0 {
+							n := 15
+							if n > len(ms) {
+								n = len(ms)
+							}
+							if _, err := a.applier.Apply(ctx, ms[:n]); err != nil {
+								t.Fatal(err)
+							}
+							ms = ms[n:]
+						}
+					}
+
+					var rows int64
+					var err error
+					switch {
+					case tt.update:
+						rows, err = a.applier.Update(ctx, spanner.Statement{
+							SQL:    `UPDATE Measure SET Col2 = "" WHERE Mark = @mark`,
+							Params: map[string]interface{}{"mark": tt.mark},
+						})
+					case tt.delete > 0:
+						for _, id := range ids[:tt.delete] {
+							ms = append(ms, spanner.Delete("Measure", spanner.Key{id}))
+						}
+						_, err = a.applier.Apply(ctx, ms)
+					default:
+						_, err = a.applier.Apply(ctx, ms)
+					}
+					if tt.wantErr {
+						if !spanerr.IsMutationLimit(err) {
+							t.Errorf("want mutation limit error but got %v", err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if e, g := tt.wantRows, rows; e != g {
+						t.Errorf("want rows %d but got %d", e, g)
+					}
+				})
+			}
+			// insert N の 16 行と、update の 50 行 + 51 行だけが残る
+			if e, g := 16+50+51, a.rowCount("Measure"); e != g {
+				t.Errorf("want rows %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestDryRun_Update(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := applier.NewDryRun(sc, 0)
+	defer d.Close()
+	ms := []*spanner.Mutation{
+		spanner.InsertMap("Measure", map[string]interface{}{"ID": "a", "Mark": "run/1"}),
+		spanner.InsertMap("Measure", map[string]interface{}{"ID": "b", "Mark": "run/2"}),
+		spanner.InsertMap("Measure", map[string]interface{}{"ID": "c"}),
+		spanner.InsertOrUpdateMap("Measure", map[string]interface{}{"ID": "a", "Col1": "x"}),
+	}
+	if _, err := d.Apply(ctx, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		sql  string
+		want int64
+	}{
+		{"literal", `UPDATE Measure SET Col2 = "" WHERE Mark = "run/1"`, 1},
+		{"starts with", `UPDATE Measure SET Col2 = "" WHERE STARTS_WITH(Mark, "run/")`, 2},
+		{"and", `UPDATE Measure SET Col2 = "" WHERE STARTS_WITH(Mark, "run/") AND Col1 = "x"`, 1},
+		{"updated column", `UPDATE Measure SET Col3 = "" WHERE Col2 = ""`, 2},
+		{"null", `UPDATE Measure SET Col2 = "" WHERE Col4 = ""`, 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Update(ctx, spanner.NewStatement(tt.sql))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != g {
+				t.Errorf("want rows %d but got %d", e, g)
+			}
+		})
+	}
+
+	// 見積もりは WHERE 句を見ないが、DryRun は行を選ぶために WHERE 句を評価する必要がある
+	if _, err := d.Update(ctx, spanner.NewStatement(`UPDATE Measure SET Col2 = "" WHERE Col1 IS NULL`)); err == nil || !strings.Contains(err.Error(), "unsupported predicate") {
+		t.Errorf("want unsupported predicate but got %v", err)
+	}
+}
+
+func TestDryRun_CommitStats(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := applier.NewDryRun(sc, 0)
+	defer d.Close()
+
+	// 見積もった Mutation 数を Commit Stats の代わりに記録する
+	rec := &commitstats.Recorder{}
+	rctx := commitstats.WithRecorder(ctx, rec)
+	ms := []*spanner.Mutation{
+		spanner.InsertMap("Measure", map[string]interface{}{"ID": "a", "Mark": "run/1", "Col1": ""}),
+		spanner.InsertMap("Measure", map[string]interface{}{"ID": "b", "Mark": "run/1", "Col1": ""}),
+	}
+	if _, err := d.Apply(rctx, ms); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Update(rctx, spanner.NewStatement(`UPDATE Measure SET Col2 = "" WHERE Mark = "run/1"`)); err != nil {
+		t.Fatal(err)
+	}
+	got := rec.Counts()
+	want := []int64{12, 4}
+	if e, g := len(want), len(got); e != g {
+		t.Fatalf("want counts %v but got %v", want, got)
+	}
+	for i := range want {
+		if e, g := want[i], got[i]; e != g {
+			t.Errorf("want count %d but got %d", e, g)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+	"github.com/sinmetal/mutation_count_playground/dml"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DryRun is Spanner に接続せず、estimator で見積もった Mutation 数が Limit を超えるかどうかだけを返す Applier
+// DML の WHERE を評価するために Apply した行の値を覚えておく
+// Key の重複、NOT NULL、Interleave の親の有無などの制約は確かめず、KeyRange の Delete で行は消さない
+type DryRun struct {
+	Schema *schema.Schema
+
+	// Limit is Mutation 数の上限. 0 の場合は estimator.DefaultLimit
+	Limit int
+
+	mu     sync.Mutex
+	tables map[string]map[string]dryRunRow
+}
+
+// dryRunRow is 1 行の値. Column 名は小文字にしておく
+type dryRunRow map[string]interface{}
+
+// NewDryRun is s の Table に書き込む DryRun を作成する
+func NewDryRun(s *schema.Schema, limit int) *DryRun {
+	return &DryRun{Schema: s, Limit: limit}
+}
+
+func (d *DryRun) limit() int {
+	if d.Limit > 0 {
+		return d.Limit
+	}
+	return estimator.DefaultLimit
+}
+
+// Apply is ms の Mutation 数を見積もり、Limit 以下であれば行の値を覚えて現在時刻を返す
+// ctx に commitstats.Recorder がある場合は、見積もった Mutation 数を Commit Stats の代わりに記録する
+func (d *DryRun) Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error) {
+	list, err := estimator.FromSpannerAll(ms)
+	if err != nil {
+		return time.Time{}, err
+	}
+	n, err := estimator.CountMutations(d.Schema, list)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n > d.limit() {
+		return time.Time{}, status.Errorf(codes.InvalidArgument, spanerr.TooManyMutationsFormat, d.limit())
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, m := range list {
+		d.write(d.Schema.Table(m.Table), m, ms[i])
+	}
+	if rec := commitstats.FromContext(ctx); rec != nil {
+		rec.Record(int64(n))
+	}
+	return time.Now(), nil
+}
+
+// Update is stmt が更新する行を Apply で覚えた行から数え、見積もった Mutation 数が Limit 以下であれば SET の値を書き込む
+// Apply と同じく、見積もった Mutation 数を ctx の commitstats.Recorder に記録する
+func (d *DryRun) Update(ctx context.Context, stmt spanner.Statement) (int64, error) {
+	u, err := dml.ParseUpdate(stmt.SQL)
+	if err != nil {
+		return 0, err
+	}
+	m, err := estimator.DMLMutation(d.Schema, stmt.SQL)
+	if err != nil {
+		return 0, err
+	}
+	perRow, err := estimator.CountMutation(d.Schema, m)
+	if err != nil {
+		return 0, err
+	}
+	t := d.Schema.Table(m.Table)
+	for _, c := range u.Where {
+		if t.Column(c.Column) == nil {
+			return 0, fmt.Errorf("column %s is not found in table %s", c.Column, t.Name)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var matched []dryRunRow
+	for _, r := range d.rows(t.Name) {
+		ok, err := matchRow(r, u.Where, stmt.Params)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			matched = append(matched, r)
+		}
+	}
+	n := perRow * len(matched)
+	if n > d.limit() {
+		return 0, status.Errorf(codes.InvalidArgument, spanerr.TooManyMutationsFormat, d.limit())
+	}
+	for _, a := range u.Set {
+		v, err := sqlValue(a.Value, stmt.Params)
+		if err != nil {
+			return 0, err
+		}
+		for _, r := range matched {
+			r[strings.ToLower(a.Column)] = v
+		}
+	}
+	if rec := commitstats.FromContext(ctx); rec != nil {
+		rec.Record(int64(n))
+	}
+	return int64(len(matched)), nil
+}
+
+// RowCount is Apply で覚えている table の行数
+func (d *DryRun) RowCount(table string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.tables[strings.ToLower(table)])
+}
+
+// Close is 覚えている行を捨てる
+func (d *DryRun) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tables = nil
+}
+
+func (d *DryRun) rows(table string) map[string]dryRunRow {
+	if d.tables == nil {
+		d.tables = make(map[string]map[string]dryRunRow)
+	}
+	name := strings.ToLower(table)
+	rows, ok := d.tables[name]
+	if !ok {
+		rows = make(map[string]dryRunRow)
+		d.tables[name] = rows
+	}
+	return rows
+}
+
+// write is 1 つの Mutation を覚えている行に反映する
+// spanner.Mutation は値を参照する API を持たないので、estimator.FromSpanner と同じく reflect で unexported な field を読み出す
+func (d *DryRun) write(t *schema.Table, m *estimator.Mutation, sm *spanner.Mutation) {
+	rows := d.rows(t.Name)
+	v := reflect.ValueOf(sm).Elem()
+	if m.Op == estimator.OpDelete {
+		deleteKeySet(rows, v.FieldByName("keySet"))
+		return
+	}
+
+	values := v.FieldByName("values")
+	row := make(dryRunRow)
+	for i, c := range m.Columns {
+		row[strings.ToLower(c)] = valueOf(values.Index(i))
+	}
+	key := make([]interface{}, len(t.PrimaryKey))
+	for i, k := range t.PrimaryKey {
+		key[i] = row[strings.ToLower(k.Column)]
+	}
+	id := fmt.Sprint(key)
+
+	old, ok := rows[id]
+	switch {
+	case !ok, m.Op == estimator.OpInsert, m.Op == estimator.OpReplace:
+		rows[id] = row
+	default:
+		for c, v := range row {
+			old[c] = v
+		}
+	}
+}
+
+var (
+	keyType     = reflect.TypeOf(spanner.Key{})
+	allKeysType = reflect.TypeOf(spanner.AllKeys())
+	keySetsType = reflect.TypeOf(spanner.KeySets())
+)
+
+// deleteKeySet is KeySet に含まれる Key の行を削除する. AllKeys の場合はすべての行を削除し、KeyRange は無視する
+func deleteKeySet(rows map[string]dryRunRow, ks reflect.Value) {
+	for ks.Kind() == reflect.Interface || ks.Kind() == reflect.Ptr {
+		if ks.IsNil() {
+			return
+		}
+		ks = ks.Elem()
+	}
+	switch ks.Type() {
+	case keyType:
+		key := make([]interface{}, ks.Len())
+		for i := range key {
+			key[i] = valueOf(ks.Index(i))
+		}
+		delete(rows, fmt.Sprint(key))
+	case allKeysType:
+		for id := range rows {
+			delete(rows, id)
+		}
+	case keySetsType:
+		for i := 0; i < ks.Len(); i++ {
+			deleteKeySet(rows, ks.Index(i))
+		}
+	}
+}
+
+// valueOf is 書き込んだ値を DML の値と比べられるように、string, int64, float64, bool, nil, []interface{} に揃える
+// それ以外の型は文字列にする
+func valueOf(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = valueOf(v.Index(i))
+		}
+		return list
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sqlValue is DML に書かれた値. @param の場合は params から引く
+func sqlValue(v dml.Value, params map[string]interface{}) (interface{}, error) {
+	if v.Param == "" {
+		return valueOf(reflect.ValueOf(v.Literal)), nil
+	}
+	p, ok := params[v.Param]
+	if !ok {
+		return nil, fmt.Errorf("no value for query parameter @%s", v.Param)
+	}
+	return valueOf(reflect.ValueOf(p)), nil
+}
+
+// matchRow is r が where の条件をすべて満たすかどうか. NULL の Column はどの条件にも一致しない
+func matchRow(r dryRunRow, where []*dml.Condition, params map[string]interface{}) (bool, error) {
+	for _, c := range where {
+		want, err := sqlValue(c.Value, params)
+		if err != nil {
+			return false, err
+		}
+		got := r[strings.ToLower(c.Column)]
+		if got == nil {
+			return false, nil
+		}
+		switch c.Op {
+		case dml.Equal:
+			if !reflect.DeepEqual(got, want) {
+				return false, nil
+			}
+		case dml.StartsWith:
+			g, gok := got.(string)
+			w, wok := want.(string)
+			if !gok || !wok || !strings.HasPrefix(g, w) {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("unsupported condition %v", c.Op)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,27 @@
+package applier
+
+import (
+	"context"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+)
+
+// Fake is in-process の fakespanner の Database に接続した Applier
+// Server は呼び出し側が持ち、Close では停止しない
+type Fake struct {
+	*Client
+
+	Server   *fakespanner.Server
+	Database *fakespanner.Database
+}
+
+// NewFake is s の database に接続する Fake を作成する
+func NewFake(ctx context.Context, s *fakespanner.Server, database string) (*Fake, error) {
+	db := s.Database(database)
+	c, err := s.NewClient(ctx, database, spanner.ClientConfig{})
+	if err != nil {
+		return nil, err
+	}
+	return &Fake{Client: NewClient(c), Server: s, Database: db}, nil
+}
@@ -0,0 +1,693 @@
+// Package applylimit is Loop で spanner.InsertMap などを slice に append して 1 回の Apply で Commit する Code のうち、
+// Mutation 数の上限を超えそうなものを見つける go/analysis の Analyzer
+//
+// measure_*_test.go の createInsertMutation のように Loop で作った slice を Apply に渡すと、行数によっては上限を超える
+// Table 名と Column (map の Key) が定数の場合に、DDL の Schema と estimator のルールで 1 行の Mutation 数を求め、
+// Loop の回数か、Loop で range している make した slice の len が定数の場合に、行数 * 1 行の Mutation 数が上限を超える Apply と BufferWrite を報告する
+//
+// slice を返す関数は Builder の Fact になるので、行数を引数で受け取る関数でも、呼び出し側で定数を渡していれば報告する
+//
+// golang.org/x/tools の go/packages は build する Go の version に合わせて新しくする必要があり、go 1.20 の module には入れられないので、
+// この package は別の module にしている
+package applylimit
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"golang.org/x/tools/go/analysis"
+)
+
+const doc = `report Apply calls whose mutations built in a loop are likely to exceed the mutation limit
+
+The table name and the keys of the column map passed to spanner.InsertMap and
+the like must be constant. The per row mutation count is estimated from the
+DDL given by -ddl, and the row count is taken from a constant loop bound or a
+constant length of the slice.`
+
+// spannerPath is cloud.google.com/go/spanner の import path
+const spannerPath = "cloud.google.com/go/spanner"
+
+var (
+	ddlFlag   string
+	limitFlag string
+)
+
+// Analyzer is -ddl の Schema と -limit の Profile で見積もる Analyzer
+var Analyzer = &analysis.Analyzer{
+	Name:      "applylimit",
+	Doc:       doc,
+	Run:       runFlags,
+	FactTypes: []analysis.Fact{new(Builder)},
+}
+
+func init() {
+	Analyzer.Flags.StringVar(&ddlFlag, "ddl", "ddl", "DDL file or directory of the tables")
+	Analyzer.Flags.StringVar(&limitFlag, "limit", os.Getenv(estimator.EnvLimit), "mutation limit profile. legacy, current or a number")
+}
+
+// NewAnalyzer is s と p で見積もる Analyzer を返す. -ddl と -limit の flag は持たない
+func NewAnalyzer(s *schema.Schema, p estimator.Profile) *analysis.Analyzer {
+	c := &checker{schema: s, profile: p}
+	return &analysis.Analyzer{
+		Name:      Analyzer.Name,
+		Doc:       doc,
+		Run:       c.run,
+		FactTypes: []analysis.Fact{new(Builder)},
+	}
+}
+
+var (
+	flagOnce    sync.Once
+	flagChecker *checker
+	flagErr     error
+)
+
+// runFlags is flag で指定された Schema と Profile を 1 回だけ読み込んで run する
+func runFlags(pass *analysis.Pass) (interface{}, error) {
+	flagOnce.Do(func() {
+		p, err := estimator.ParseProfile(limitFlag)
+		if err != nil {
+			flagErr = err
+			return
+		}
+		s, err := loadSchema(ddlFlag)
+		if err != nil {
+			flagErr = err
+			return
+		}
+		flagChecker = &checker{schema: s, profile: p}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+	return flagChecker.run(pass)
+}
+
+// loadSchema is path が Directory の場合は LoadDir, File の場合は ParseFile で Schema を読み込む
+func loadSchema(path string) (*schema.Schema, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return schema.LoadDir(path)
+	}
+	return schema.ParseFile(path)
+}
+
+// Part is 1 つの Loop で slice に追加する 1 種類の Mutation
+type Part struct {
+	Table  string
+	Op     string
+	PerRow int
+	// Rows is Loop の回数. 分からない場合は 0
+	Rows int
+	// RowsParam is Loop の回数を決める関数の引数の位置. 引数で決まらない場合は -1
+	RowsParam int
+}
+
+func (p Part) String() string {
+	switch {
+	case p.Rows > 0:
+		return fmt.Sprintf("%s %s %d rows * %d", p.Table, p.Op, p.Rows, p.PerRow)
+	case p.RowsParam >= 0:
+		return fmt.Sprintf("%s %s rows of param %d * %d", p.Table, p.Op, p.RowsParam, p.PerRow)
+	default:
+		return fmt.Sprintf("%s %s ? rows * %d", p.Table, p.Op, p.PerRow)
+	}
+}
+
+// Builder is Loop で作った Mutation の slice を返す関数の Fact
+type Builder struct {
+	Parts []Part
+}
+
+// AFact is analysis.Fact の実装
+func (*Builder) AFact() {}
+
+func (b *Builder) String() string {
+	list := make([]string, len(b.Parts))
+	for i, p := range b.Parts {
+		list[i] = p.String()
+	}
+	return "builds " + strings.Join(list, ", ")
+}
+
+type checker struct {
+	schema  *schema.Schema
+	profile estimator.Profile
+}
+
+func (c *checker) run(pass *analysis.Pass) (interface{}, error) {
+	var funcs []*ast.FuncDecl
+	for _, f := range pass.Files {
+		for _, d := range f.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Body != nil {
+				funcs = append(funcs, fd)
+			}
+		}
+	}
+
+	// 同じ package の中で後に定義されている関数も呼び出せるので、先にすべての関数の Builder の Fact を作る
+	slices := make(map[*ast.FuncDecl]map[types.Object][]Part)
+	for _, fd := range funcs {
+		slices[fd] = c.buildSlices(pass, fd)
+		if parts := returnedParts(pass, fd, slices[fd]); len(parts) > 0 {
+			if fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func); ok {
+				pass.ExportObjectFact(fn, &Builder{Parts: parts})
+			}
+		}
+	}
+	for _, fd := range funcs {
+		c.checkApply(pass, fd, slices[fd])
+	}
+	return nil, nil
+}
+
+// buildSlices is fd の中の Loop で Mutation を追加している slice ごとに Part を返す
+func (c *checker) buildSlices(pass *analysis.Pass, fd *ast.FuncDecl) map[types.Object][]Part {
+	slices := make(map[types.Object][]Part)
+	var stack []ast.Node
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+
+		as, ok := n.(*ast.AssignStmt)
+		if !ok || len(as.Lhs) != 1 || len(as.Rhs) != 1 {
+			return true
+		}
+		loop := innermostLoop(stack)
+		if loop == nil {
+			return true
+		}
+		slice, calls := mutationAssign(pass, as)
+		if slice == nil {
+			return true
+		}
+		for _, call := range calls {
+			m, ok := mutationOf(pass, fd, call)
+			if !ok {
+				continue
+			}
+			perRow, err := estimator.CountMutation(c.schema, m)
+			if err != nil {
+				// Schema に無い Table と Column は見積もれないので報告しない
+				continue
+			}
+			rows, param := loopRows(pass, fd, loop)
+			if rows == 0 && param < 0 {
+				rows, param = sliceRows(pass, fd, loop, slice)
+			}
+			slices[slice] = append(slices[slice], Part{Table: m.Table, Op: m.Op.String(), PerRow: perRow, Rows: rows, RowsParam: param})
+		}
+		return true
+	})
+	return slices
+}
+
+// checkApply is fd の中の Apply と BufferWrite に渡している slice を見積もり、上限を超える場合に報告する
+func (c *checker) checkApply(pass *analysis.Pass, fd *ast.FuncDecl, slices map[types.Object][]Part) {
+	// Builder の関数の戻り値を代入した変数
+	built := make(map[types.Object][]Part)
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		as, ok := n.(*ast.AssignStmt)
+		if !ok || len(as.Lhs) != 1 || len(as.Rhs) != 1 {
+			return true
+		}
+		id, ok := as.Lhs[0].(*ast.Ident)
+		if !ok {
+			return true
+		}
+		call, ok := as.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if parts := builderParts(pass, call); parts != nil {
+			if obj := pass.TypesInfo.ObjectOf(id); obj != nil {
+				built[obj] = parts
+			}
+		}
+		return true
+	})
+
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Apply" && sel.Sel.Name != "BufferWrite") {
+			return true
+		}
+		for _, arg := range call.Args {
+			if !isMutationSlice(pass.TypesInfo.TypeOf(arg)) {
+				continue
+			}
+			var parts []Part
+			switch arg := arg.(type) {
+			case *ast.Ident:
+				obj := pass.TypesInfo.ObjectOf(arg)
+				parts = append(append(parts, slices[obj]...), built[obj]...)
+			case *ast.CallExpr:
+				parts = builderParts(pass, arg)
+			}
+			c.report(pass, call, sel.Sel.Name, parts)
+		}
+		return true
+	})
+}
+
+// report is 行数が分かっている Part の合計が上限を超える場合に報告する. 行数が分からない Part は数えないので、合計は下限になる
+func (c *checker) report(pass *analysis.Pass, call *ast.CallExpr, name string, parts []Part) {
+	var total int
+	var known []string
+	for _, p := range parts {
+		if p.Rows == 0 {
+			continue
+		}
+		total += p.Rows * p.PerRow
+		known = append(known, p.String())
+	}
+	if c.profile.Fits(total) {
+		return
+	}
+	msg := fmt.Sprintf("%s may exceed the mutation limit: estimated %d mutations (%s) > %s", name, total, strings.Join(known, " + "), c.profile)
+	if len(known) == 1 {
+		for _, p := range parts {
+			if p.Rows > 0 {
+				msg += fmt.Sprintf(", at most %d rows per commit", c.profile.MaxRows(p.PerRow))
+			}
+		}
+	}
+	pass.Reportf(call.Pos(), "%s", msg)
+}
+
+// builderParts is Builder の関数の呼び出しの Part を返す. 行数を引数で受け取る Part は、引数が定数の場合に行数を埋める
+func builderParts(pass *analysis.Pass, call *ast.CallExpr) []Part {
+	fn := calledFunc(pass, call)
+	if fn == nil {
+		return nil
+	}
+	var b Builder
+	if !pass.ImportObjectFact(fn, &b) {
+		return nil
+	}
+	parts := make([]Part, len(b.Parts))
+	for i, p := range b.Parts {
+		if p.Rows == 0 && p.RowsParam >= 0 && p.RowsParam < len(call.Args) {
+			if n, ok := constInt(pass, call.Args[p.RowsParam]); ok && n > 0 {
+				p.Rows = n
+			}
+		}
+		p.RowsParam = -1
+		parts[i] = p
+	}
+	return parts
+}
+
+// returnedParts is fd が return している slice の Part を返す. Closure の中の return は見ない
+func returnedParts(pass *analysis.Pass, fd *ast.FuncDecl, slices map[types.Object][]Part) []Part {
+	var parts []Part
+	seen := make(map[types.Object]bool)
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			for _, r := range n.Results {
+				id, ok := r.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				obj := pass.TypesInfo.ObjectOf(id)
+				if obj == nil || seen[obj] {
+					continue
+				}
+				seen[obj] = true
+				parts = append(parts, slices[obj]...)
+			}
+		}
+		return true
+	})
+	return parts
+}
+
+// innermostLoop is stack の中で一番内側の for 文を返す. Closure の外の Loop は含めない
+func innermostLoop(stack []ast.Node) ast.Stmt {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch n := stack[i].(type) {
+		case *ast.ForStmt:
+			return n
+		case *ast.RangeStmt:
+			return n
+		case *ast.FuncLit:
+			return nil
+		}
+	}
+	return nil
+}
+
+// mutationAssign is "s = append(s, spanner.InsertMap(...))" と "s[i] = spanner.InsertMap(...)" の s と Mutation を作る呼び出しを返す
+func mutationAssign(pass *analysis.Pass, as *ast.AssignStmt) (types.Object, []*ast.CallExpr) {
+	switch lhs := as.Lhs[0].(type) {
+	case *ast.Ident:
+		call, ok := as.Rhs[0].(*ast.CallExpr)
+		if !ok || !isBuiltin(pass, call.Fun, "append") || len(call.Args) < 2 {
+			return nil, nil
+		}
+		if first, ok := call.Args[0].(*ast.Ident); !ok || pass.TypesInfo.ObjectOf(first) != pass.TypesInfo.ObjectOf(lhs) {
+			return nil, nil
+		}
+		var calls []*ast.CallExpr
+		for _, arg := range call.Args[1:] {
+			if c, ok := arg.(*ast.CallExpr); ok {
+				calls = append(calls, c)
+			}
+		}
+		return pass.TypesInfo.ObjectOf(lhs), calls
+	case *ast.IndexExpr:
+		id, ok := lhs.X.(*ast.Ident)
+		if !ok || !isMutationSlice(pass.TypesInfo.TypeOf(id)) {
+			return nil, nil
+		}
+		call, ok := as.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return nil, nil
+		}
+		return pass.TypesInfo.ObjectOf(id), []*ast.CallExpr{call}
+	}
+	return nil, nil
+}
+
+// mutationOps is Mutation を作る spanner の関数と Op. Map が付くものは Column を map の Key で指定する
+var mutationOps = map[string]estimator.Op{
+	"Insert":            estimator.OpInsert,
+	"InsertMap":         estimator.OpInsert,
+	"InsertOrUpdate":    estimator.OpInsertOrUpdate,
+	"InsertOrUpdateMap": estimator.OpInsertOrUpdate,
+	"Replace":           estimator.OpReplace,
+	"ReplaceMap":        estimator.OpReplace,
+	"Update":            estimator.OpUpdate,
+	"UpdateMap":         estimator.OpUpdate,
+	"Delete":            estimator.OpDelete,
+}
+
+// mutationOf is spanner.InsertMap などの呼び出しから 1 行分の Mutation を作る. Table 名と Column が定数でない場合は false
+func mutationOf(pass *analysis.Pass, fd *ast.FuncDecl, call *ast.CallExpr) (*estimator.Mutation, bool) {
+	fn := calledFunc(pass, call)
+	if fn == nil || fn.Pkg() == nil || fn.Pkg().Path() != spannerPath || len(call.Args) < 2 {
+		return nil, false
+	}
+	op, ok := mutationOps[fn.Name()]
+	if !ok {
+		return nil, false
+	}
+	table, ok := constString(pass, call.Args[0])
+	if !ok {
+		return nil, false
+	}
+	m := &estimator.Mutation{Op: op, Table: table}
+	switch {
+	case op == estimator.OpDelete:
+		m.Keys = 1
+		return m, true
+	case strings.HasSuffix(fn.Name(), "Map"):
+		m.Columns, ok = mapKeys(pass, fd, call.Args[1])
+	default:
+		m.Columns, ok = stringList(pass, call.Args[1])
+	}
+	return m, ok
+}
+
+// mapKeys is map の Key を返す. map の literal か、literal か make で作った変数に定数の Key で代入したものだけを扱う
+func mapKeys(pass *analysis.Pass, fd *ast.FuncDecl, e ast.Expr) ([]string, bool) {
+	if lit, ok := e.(*ast.CompositeLit); ok {
+		return literalKeys(pass, lit)
+	}
+	id, ok := e.(*ast.Ident)
+	if !ok {
+		return nil, false
+	}
+	obj := pass.TypesInfo.ObjectOf(id)
+	var keys []string
+	resolved := true
+	add := func(k string) {
+		for _, v := range keys {
+			if v == k {
+				return
+			}
+		}
+		keys = append(keys, k)
+	}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		as, ok := n.(*ast.AssignStmt)
+		if !ok || len(as.Lhs) != len(as.Rhs) {
+			return true
+		}
+		for i, lhs := range as.Lhs {
+			switch lhs := lhs.(type) {
+			case *ast.Ident:
+				if pass.TypesInfo.ObjectOf(lhs) != obj {
+					continue
+				}
+				switch rhs := as.Rhs[i].(type) {
+				case *ast.CompositeLit:
+					list, ok := literalKeys(pass, rhs)
+					if !ok {
+						resolved = false
+					}
+					for _, k := range list {
+						add(k)
+					}
+				case *ast.CallExpr:
+					if !isBuiltin(pass, rhs.Fun, "make") {
+						resolved = false
+					}
+				default:
+					resolved = false
+				}
+			case *ast.IndexExpr:
+				if x, ok := lhs.X.(*ast.Ident); !ok || pass.TypesInfo.ObjectOf(x) != obj {
+					continue
+				}
+				k, ok := constString(pass, lhs.Index)
+				if !ok {
+					resolved = false
+					continue
+				}
+				add(k)
+			}
+		}
+		return true
+	})
+	return keys, resolved
+}
+
+func literalKeys(pass *analysis.Pass, lit *ast.CompositeLit) ([]string, bool) {
+	keys := make([]string, 0, len(lit.Elts))
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, false
+		}
+		k, ok := constString(pass, kv.Key)
+		if !ok {
+			return nil, false
+		}
+		keys = append(keys, k)
+	}
+	return keys, true
+}
+
+// stringList is []string{"ID", "Col1"} の要素を返す
+func stringList(pass *analysis.Pass, e ast.Expr) ([]string, bool) {
+	lit, ok := e.(*ast.CompositeLit)
+	if !ok {
+		return nil, false
+	}
+	list := make([]string, 0, len(lit.Elts))
+	for _, elt := range lit.Elts {
+		v, ok := constString(pass, elt)
+		if !ok {
+			return nil, false
+		}
+		list = append(list, v)
+	}
+	return list, true
+}
+
+// loopRows is for 文の回数を返す. "for i := 0; i < n; i++" の n が定数の場合は rows, fd の引数の場合は引数の位置を返す
+func loopRows(pass *analysis.Pass, fd *ast.FuncDecl, loop ast.Stmt) (rows int, param int) {
+	f, ok := loop.(*ast.ForStmt)
+	if !ok {
+		return 0, -1
+	}
+	init, ok := f.Init.(*ast.AssignStmt)
+	if !ok || len(init.Lhs) != 1 || len(init.Rhs) != 1 {
+		return 0, -1
+	}
+	v, ok := init.Lhs[0].(*ast.Ident)
+	if !ok {
+		return 0, -1
+	}
+	start, ok := constInt(pass, init.Rhs[0])
+	if !ok {
+		return 0, -1
+	}
+	cond, ok := f.Cond.(*ast.BinaryExpr)
+	if !ok {
+		return 0, -1
+	}
+	x, ok := cond.X.(*ast.Ident)
+	if !ok || pass.TypesInfo.ObjectOf(x) != pass.TypesInfo.ObjectOf(v) {
+		return 0, -1
+	}
+	var inclusive bool
+	switch cond.Op.String() {
+	case "<":
+	case "<=":
+		inclusive = true
+	default:
+		return 0, -1
+	}
+	if n, ok := constInt(pass, cond.Y); ok {
+		if inclusive {
+			n++
+		}
+		return n - start, -1
+	}
+	// 引数の場合は 0 から n - 1 まで, 1 から n まで回す Loop だけを扱う
+	if (start == 0 && !inclusive) || (start == 1 && inclusive) {
+		return 0, paramIndex(pass, fd, cond.Y)
+	}
+	return 0, -1
+}
+
+// sliceRows is loop が make で作った slice を range している場合に、その slice の len を返す. 定数の場合は rows, fd の引数の場合は引数の位置を返す
+// cap は行数ではなく、別の値を range して append する場合は slice の長さと Loop の回数が関係ないので数えない
+func sliceRows(pass *analysis.Pass, fd *ast.FuncDecl, loop ast.Stmt, slice types.Object) (rows int, param int) {
+	rows, param = 0, -1
+	r, ok := loop.(*ast.RangeStmt)
+	if !ok {
+		return rows, param
+	}
+	if id, ok := r.X.(*ast.Ident); !ok || pass.TypesInfo.ObjectOf(id) != slice {
+		return rows, param
+	}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		as, ok := n.(*ast.AssignStmt)
+		if !ok || len(as.Lhs) != 1 || len(as.Rhs) != 1 {
+			return true
+		}
+		id, ok := as.Lhs[0].(*ast.Ident)
+		if !ok || pass.TypesInfo.ObjectOf(id) != slice {
+			return true
+		}
+		call, ok := as.Rhs[0].(*ast.CallExpr)
+		if !ok || !isBuiltin(pass, call.Fun, "make") || len(call.Args) < 2 {
+			return true
+		}
+		size := call.Args[1]
+		if n, ok := constInt(pass, size); ok {
+			rows = n
+		} else {
+			param = paramIndex(pass, fd, size)
+		}
+		return true
+	})
+	return rows, param
+}
+
+// paramIndex is e が fd の引数の場合に引数の位置を返す. 引数でない場合は -1
+func paramIndex(pass *analysis.Pass, fd *ast.FuncDecl, e ast.Expr) int {
+	id, ok := e.(*ast.Ident)
+	if !ok {
+		return -1
+	}
+	obj := pass.TypesInfo.ObjectOf(id)
+	var i int
+	for _, field := range fd.Type.Params.List {
+		for _, name := range field.Names {
+			if pass.TypesInfo.ObjectOf(name) == obj {
+				return i
+			}
+			i++
+		}
+		if len(field.Names) == 0 {
+			i++
+		}
+	}
+	return -1
+}
+
+func calledFunc(pass *analysis.Pass, call *ast.CallExpr) *types.Func {
+	var id *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return nil
+	}
+	fn, _ := pass.TypesInfo.ObjectOf(id).(*types.Func)
+	return fn
+}
+
+func isBuiltin(pass *analysis.Pass, e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	b, ok := pass.TypesInfo.ObjectOf(id).(*types.Builtin)
+	return ok && b.Name() == name
+}
+
+// isMutationSlice is t が []*spanner.Mutation かどうか
+func isMutationSlice(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	s, ok := t.Underlying().(*types.Slice)
+	if !ok {
+		return false
+	}
+	p, ok := s.Elem().(*types.Pointer)
+	if !ok {
+		return false
+	}
+	n, ok := p.Elem().(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := n.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == spannerPath && obj.Name() == "Mutation"
+}
+
+func constString(pass *analysis.Pass, e ast.Expr) (string, bool) {
+	tv, ok := pass.TypesInfo.Types[e]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+func constInt(pass *analysis.Pass, e ast.Expr) (int, bool) {
+	tv, ok := pass.TypesInfo.Types[e]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.Int {
+		return 0, false
+	}
+	n, ok := constant.Int64Val(tv.Value)
+	return int(n), ok
+}
@@ -0,0 +1,28 @@
+package applylimit_test
+
+import (
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/applylimit"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	if err := applylimit.Analyzer.Flags.Set("ddl", "../ddl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := applylimit.Analyzer.Flags.Set("limit", "legacy"); err != nil {
+		t.Fatal(err)
+	}
+	analysistest.Run(t, analysistest.TestData(), applylimit.Analyzer, "a")
+}
+
+func TestNewAnalyzer(t *testing.T) {
+	s, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysistest.Run(t, analysistest.TestData(), applylimit.NewAnalyzer(s, estimator.Current), "b")
+}
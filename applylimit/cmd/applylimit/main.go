@@ -0,0 +1,16 @@
+// Command applylimit is applylimit.Analyzer を実行する
+//
+// applylimit は Spanner に依存する module とは別の module なので、install してから計測の module で実行する
+//
+//	go install ./cmd/applylimit
+//	applylimit -ddl ddl -limit current ./...
+package main
+
+import (
+	"github.com/sinmetal/mutation_count_playground/applylimit"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(applylimit.Analyzer)
+}
@@ -0,0 +1,127 @@
+package a
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+)
+
+const table = "Measure"
+
+// 1 行 [1:ID, 2:Col1, 3:MeasureWithIndex1_1, 4:MeasureWithIndex2_1, 5:MeasureWithIndex2_2]
+func insertLoop(ctx context.Context, client *spanner.Client) {
+	var ms []*spanner.Mutation
+	for i := 0; i < 4001; i++ {
+		ms = append(ms, spanner.InsertMap(table, map[string]interface{}{"ID": fmt.Sprint(i), "Col1": ""}))
+	}
+	client.Apply(ctx, ms) // want `Apply may exceed the mutation limit: estimated 20005 mutations \(Measure Insert 4001 rows \* 5\) > legacy\(20000\), at most 4000 rows per commit`
+}
+
+func insertUnderLimit(ctx context.Context, client *spanner.Client) {
+	var ms []*spanner.Mutation
+	for i := 1; i <= 4000; i++ {
+		ms = append(ms, spanner.InsertMap(table, map[string]interface{}{"ID": fmt.Sprint(i), "Col1": ""}))
+	}
+	client.Apply(ctx, ms)
+}
+
+// map に定数の Key で代入する. [1:ID, 2:Col1, 3:WithIndex1] + 3 index
+func insertMapVar(ctx context.Context, client *spanner.Client) {
+	ms := make([]*spanner.Mutation, 3334)
+	for i := range ms {
+		v := make(map[string]interface{})
+		v["ID"] = fmt.Sprint(i)
+		v["Col1"] = ""
+		v["WithIndex1"] = ""
+		ms[i] = spanner.InsertMap("Measure", v)
+	}
+	client.Apply(ctx, ms) // want `estimated 20004 mutations \(Measure Insert 3334 rows \* 6\)`
+}
+
+// [1:ID, 2:WithIndex1, 3:MeasureWithIndex1_1 delete, 4:MeasureWithIndex1_1 insert]
+func updateLen(ctx context.Context, tx *spanner.ReadWriteTransaction) {
+	ms := make([]*spanner.Mutation, 5001, 10000)
+	for i := range ms {
+		ms[i] = spanner.UpdateMap("Measure", map[string]interface{}{"ID": fmt.Sprint(i), "WithIndex1": ""})
+	}
+	tx.BufferWrite(ms) // want `BufferWrite may exceed the mutation limit: estimated 20004 mutations \(Measure Update 5001 rows \* 4\)`
+}
+
+// cap は行数ではなく、range しているのは別の slice なので見積もらない
+func updateInTransaction(ctx context.Context, tx *spanner.ReadWriteTransaction) {
+	ms := make([]*spanner.Mutation, 0, 5001)
+	for _, id := range []string{"a"} {
+		ms = append(ms, spanner.UpdateMap("Measure", map[string]interface{}{"ID": id, "WithIndex1": ""}))
+	}
+	tx.BufferWrite(ms)
+}
+
+// Column の Key が定数でないので見積もらない
+func notConstantKeys(ctx context.Context, client *spanner.Client) {
+	var ms []*spanner.Mutation
+	for i := 0; i < 100000; i++ {
+		v := make(map[string]interface{})
+		for j := 1; j <= 4; j++ {
+			v[fmt.Sprintf("Col%d", j)] = ""
+		}
+		ms = append(ms, spanner.InsertMap(table, v))
+	}
+	client.Apply(ctx, ms)
+}
+
+// 行数が定数でないので見積もらない
+func notConstantRows(ctx context.Context, client *spanner.Client, ids []string) {
+	var ms []*spanner.Mutation
+	for _, id := range ids {
+		ms = append(ms, spanner.InsertMap(table, map[string]interface{}{"ID": id}))
+	}
+	client.Apply(ctx, ms)
+}
+
+// Schema に無い Table は見積もらない
+func unknownTable(ctx context.Context, client *spanner.Client) {
+	var ms []*spanner.Mutation
+	for i := 0; i < 100000; i++ {
+		ms = append(ms, spanner.InsertMap("Hoge", map[string]interface{}{"ID": ""}))
+	}
+	client.Apply(ctx, ms)
+}
+
+// 行数を引数で受け取る関数は Builder の Fact になる
+func createInsertMutation(rowCount int) []*spanner.Mutation { // want createInsertMutation:`builds Measure Insert rows of param 0 \* 5`
+	list := make([]*spanner.Mutation, rowCount)
+	for i := 0; i < rowCount; i++ {
+		list[i] = spanner.Insert("Measure", []string{"ID", "Col1"}, []interface{}{fmt.Sprint(i), ""})
+	}
+	return list
+}
+
+func applyBuilder(ctx context.Context, client *spanner.Client) {
+	client.Apply(ctx, createInsertMutation(4000))
+	client.Apply(ctx, createInsertMutation(4001)) // want `Apply may exceed the mutation limit: estimated 20005 mutations`
+
+	ms := createInsertMutation(10000)
+	client.Apply(ctx, ms) // want `estimated 50000 mutations`
+}
+
+// [1:Measure, 2:MeasureWithIndex1_1, 3:MeasureWithIndex2_1, 4:MeasureWithIndex2_2] と Insert の合計
+func deleteAndInsert(ctx context.Context, client *spanner.Client) {
+	var ms []*spanner.Mutation
+	for i := 0; i < 2500; i++ {
+		ms = append(ms, spanner.Delete("Measure", spanner.Key{fmt.Sprint(i)}))
+	}
+	for i := 0; i < 2001; i++ {
+		ms = append(ms, spanner.InsertMap(table, map[string]interface{}{"ID": fmt.Sprint(i), "Col1": ""}))
+	}
+	client.Apply(ctx, ms) // want `estimated 20005 mutations \(Measure Delete 2500 rows \* 4 \+ Measure Insert 2001 rows \* 5\)`
+}
+
+// CreateRows is 別の package から呼ぶ Builder
+func CreateRows(n int) []*spanner.Mutation { // want CreateRows:`builds Measure Insert rows of param 0 \* 5`
+	var ms []*spanner.Mutation
+	for i := 0; i < n; i++ {
+		ms = append(ms, spanner.InsertMap(table, map[string]interface{}{"ID": fmt.Sprint(i), "Col1": ""}))
+	}
+	return ms
+}
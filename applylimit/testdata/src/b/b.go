@@ -0,0 +1,14 @@
+package b
+
+import (
+	"context"
+
+	"a"
+	"cloud.google.com/go/spanner"
+)
+
+// 別の package の Builder の Fact も使う
+func applyOtherPackage(ctx context.Context, client *spanner.Client) {
+	client.Apply(ctx, a.CreateRows(16000))
+	client.Apply(ctx, a.CreateRows(16001)) // want `estimated 80005 mutations \(Measure Insert 16001 rows \* 5\) > current\(80000\), at most 16000 rows per commit`
+}
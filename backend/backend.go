@@ -0,0 +1,277 @@
+// Package backend is 計測に使う Spanner の接続先を環境変数や設定ファイルから選ぶ
+//
+// 接続先は以下の 4 種類
+//
+//	spanner  : 本物の Cloud Spanner の Database
+//	emulator : Cloud Spanner Emulator
+//	fake     : in-process の fakespanner
+//	dryrun   : どこにも接続せず、estimator の見積もりだけで結果を返す (applier.DryRun)
+//
+// 環境変数は以下を見る. MUTATION_COUNT_CONFIG が指定されている場合は JSON の設定ファイルを読み込み、他の環境変数で上書きする
+//
+//	MUTATION_COUNT_CONFIG   : 設定ファイルの path
+//	MUTATION_COUNT_BACKEND  : spanner, emulator, fake, dryrun のいずれか
+//	MUTATION_COUNT_DATABASE : projects/PROJECT_ID/instances/INSTANCE_ID/databases/DATABASE_ID
+//	MUTATION_COUNT_INSTANCE : projects/PROJECT_ID/instances/INSTANCE_ID. MUTATION_COUNT_PROVISION と一緒に指定すると Database を作成する
+//	MUTATION_COUNT_PROVISION: 空でなければ ddl/*.sql を Database Admin API で適用する
+//	MUTATION_COUNT_FAKE     : 空でなければ fake を使う (MUTATION_COUNT_BACKEND=fake と同じ)
+//	MUTATION_COUNT_DRYRUN   : 空でなければ dryrun を使う (MUTATION_COUNT_BACKEND=dryrun と同じ)
+//	MUTATION_COUNT_LIMIT    : Mutation 数の上限の Profile. legacy (20000), current (80000) または数値. 省略した場合は legacy
+//	MUTATION_COUNT_CASSETTE : record か replay. Commit と ExecuteSql を Test ごとに記録か再生する. replay で接続先が指定されていなければ fake を使う
+//	MUTATION_COUNT_CASSETTE_DIR: Cassette の Directory. 省略した場合は testdata/cassettes
+//	MUTATION_COUNT_CASSETTE_SKIP_MISSING: 空でなければ replay で Cassette の無い Test を失敗にせずに Skip する
+//	SPANNER_EMULATOR_HOST   : Emulator の host:port. MUTATION_COUNT_BACKEND が指定されていなければ emulator を使う
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sinmetal/mutation_count_playground/cassette"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+)
+
+// Kind is 接続先の種類
+type Kind string
+
+const (
+	// Spanner is 本物の Cloud Spanner
+	Spanner Kind = "spanner"
+	// Emulator is Cloud Spanner Emulator
+	Emulator Kind = "emulator"
+	// Fake is in-process の fakespanner
+	Fake Kind = "fake"
+	// DryRun is estimator の見積もりだけで結果を返す. Spanner には接続しない
+	DryRun Kind = "dryrun"
+)
+
+// 環境変数の名前
+const (
+	EnvConfig              = "MUTATION_COUNT_CONFIG"
+	EnvBackend             = "MUTATION_COUNT_BACKEND"
+	EnvDatabase            = "MUTATION_COUNT_DATABASE"
+	EnvInstance            = "MUTATION_COUNT_INSTANCE"
+	EnvProvision           = "MUTATION_COUNT_PROVISION"
+	EnvFake                = "MUTATION_COUNT_FAKE"
+	EnvDryRun              = "MUTATION_COUNT_DRYRUN"
+	EnvLimit               = estimator.EnvLimit
+	EnvCassette            = "MUTATION_COUNT_CASSETTE"
+	EnvCassetteDir         = "MUTATION_COUNT_CASSETTE_DIR"
+	EnvCassetteSkipMissing = "MUTATION_COUNT_CASSETTE_SKIP_MISSING"
+	EnvEmulatorHost        = "SPANNER_EMULATOR_HOST"
+)
+
+// DefaultCassetteDir is CassetteDir を省略した時の Directory
+const DefaultCassetteDir = "testdata/cassettes"
+
+// DefaultFakeDatabase is fake で Database が指定されていない時に使う Database の名前
+const DefaultFakeDatabase = "projects/fake/instances/fake/databases/fake"
+
+// ErrNotConfigured is 接続先が指定されていない
+var ErrNotConfigured = errors.New("spanner backend is not configured. set MUTATION_COUNT_BACKEND, MUTATION_COUNT_DATABASE, MUTATION_COUNT_FAKE, MUTATION_COUNT_DRYRUN, SPANNER_EMULATOR_HOST or MUTATION_COUNT_CONFIG")
+
+// Config is 接続先の設定
+type Config struct {
+	Kind Kind `json:"kind"`
+
+	// Database is 接続する Database の名前. fake の場合は省略できる
+	Database string `json:"database"`
+
+	// Instance is Provision で Database を作成する Instance. projects/PROJECT_ID/instances/INSTANCE_ID の形式
+	Instance string `json:"instance"`
+
+	// Provision is DDLDir の DDL を Database Admin API で適用する
+	// Database が指定されていない場合は Instance に新しい Database を作成して Close で削除する
+	// Database が指定されている場合はまだ無い Table と Index だけを作成する
+	// fake は常に Admin API で Database を作成する
+	Provision bool `json:"provision"`
+
+	// EmulatorHost is emulator の host:port
+	EmulatorHost string `json:"emulatorHost"`
+
+	// DDLDir is fake の Database を作成する時と、dryrun で見積もる時に読み込む DDL の Directory. 省略した場合は ddl
+	DDLDir string `json:"ddlDir"`
+
+	// NumChannels is spanner.ClientConfig.NumChannels. 0 の場合は 12
+	NumChannels int `json:"numChannels"`
+
+	// MinOpened is spanner.SessionPoolConfig.MinOpened. 0 の場合は 50
+	MinOpened uint64 `json:"minOpened"`
+
+	// Limit is 接続先の Mutation 数の上限の Profile. legacy, current または数値. 省略した場合は legacy
+	// fake の場合は Server の上限になり、measure_*_test.go の期待値もこの Profile から求める
+	Limit string `json:"limit"`
+
+	// Cassette is record か replay. 空の場合は記録も再生もしない
+	// record は接続先への Commit と ExecuteSql を記録し、replay は fake の Server の上で記録した Response を返す
+	Cassette string `json:"cassette"`
+
+	// CassetteDir is Cassette の Directory. 省略した場合は DefaultCassetteDir
+	CassetteDir string `json:"cassetteDir"`
+
+	// CassetteSkipMissing is replay で Cassette が記録されていない Test を Skip する. false の場合は失敗にする
+	CassetteSkipMissing bool `json:"cassetteSkipMissing"`
+}
+
+// LoadFile is JSON の設定ファイルを読み込む
+func LoadFile(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("failed parse %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// FromEnv is 環境変数から設定を作成する
+// 接続先が指定されていない場合は ErrNotConfigured を返す
+func FromEnv() (*Config, error) {
+	return FromLookup(os.LookupEnv)
+}
+
+// FromLookup is os.LookupEnv の代わりに lookup で値を引いて設定を作成する
+func FromLookup(lookup func(string) (string, bool)) (*Config, error) {
+	env := func(key string) string {
+		v, _ := lookup(key)
+		return v
+	}
+
+	c := &Config{}
+	if path := env(EnvConfig); path != "" {
+		var err error
+		c, err = LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v := env(EnvDatabase); v != "" {
+		c.Database = v
+	}
+	if v := env(EnvInstance); v != "" {
+		c.Instance = v
+	}
+	if env(EnvProvision) != "" {
+		c.Provision = true
+	}
+	if v := env(EnvEmulatorHost); v != "" {
+		c.EmulatorHost = v
+	}
+	if v := env(EnvLimit); v != "" {
+		c.Limit = v
+	}
+	if v := env(EnvCassette); v != "" {
+		c.Cassette = v
+	}
+	if v := env(EnvCassetteDir); v != "" {
+		c.CassetteDir = v
+	}
+	if env(EnvCassetteSkipMissing) != "" {
+		c.CassetteSkipMissing = true
+	}
+	switch {
+	case env(EnvBackend) != "":
+		c.Kind = Kind(env(EnvBackend))
+	case env(EnvFake) != "":
+		c.Kind = Fake
+	case env(EnvDryRun) != "":
+		c.Kind = DryRun
+	case c.Kind != "":
+	case c.EmulatorHost != "":
+		c.Kind = Emulator
+	case c.Database != "", c.Instance != "":
+		c.Kind = Spanner
+	case strings.EqualFold(c.Cassette, string(cassette.Replay)):
+		// 再生は Credential の無い CI でも実行できるように、接続先が無くても fake で行う
+		c.Kind = Fake
+	default:
+		return nil, ErrNotConfigured
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate is 設定に必要な値が揃っているかを確認する
+func (c *Config) Validate() error {
+	if _, err := c.LimitProfile(); err != nil {
+		return err
+	}
+	if c.Cassette != "" {
+		mode, err := cassette.ParseMode(c.Cassette)
+		if err != nil {
+			return err
+		}
+		switch {
+		case mode == cassette.Replay && c.Kind != Fake:
+			return fmt.Errorf("cassette replay requires backend %s, got %s", Fake, c.Kind)
+		case mode == cassette.Record && c.Kind == DryRun:
+			return fmt.Errorf("cassette record can not be used with backend %s", c.Kind)
+		case mode == cassette.Record && c.CassetteSkipMissing:
+			return fmt.Errorf("cassette skip missing can be used only with replay")
+		}
+	} else if c.CassetteSkipMissing {
+		return fmt.Errorf("cassette skip missing can be used only with replay")
+	}
+	switch c.Kind {
+	case Spanner:
+		if err := c.validateDatabase(); err != nil {
+			return err
+		}
+	case Emulator:
+		if err := c.validateDatabase(); err != nil {
+			return err
+		}
+		if c.EmulatorHost == "" {
+			return fmt.Errorf("backend %s requires emulatorHost", c.Kind)
+		}
+	case Fake, DryRun:
+	default:
+		return fmt.Errorf("unknown backend %q", c.Kind)
+	}
+	return nil
+}
+
+func (c *Config) validateDatabase() error {
+	if c.Database != "" {
+		return nil
+	}
+	if c.Provision && c.Instance != "" {
+		return nil
+	}
+	return fmt.Errorf("backend %s requires database, or instance with provision", c.Kind)
+}
+
+// LimitProfile is Limit の Profile
+func (c *Config) LimitProfile() (estimator.Profile, error) {
+	return estimator.ParseProfile(c.Limit)
+}
+
+// DatabaseName is 接続する Database の名前. Provision で作成する場合は Open するまで分からないので空になる
+func (c *Config) DatabaseName() string {
+	if c.Database == "" && c.Kind == Fake {
+		return DefaultFakeDatabase
+	}
+	return c.Database
+}
+
+func (c *Config) cassetteDir() string {
+	if c.CassetteDir != "" {
+		return c.CassetteDir
+	}
+	return DefaultCassetteDir
+}
+
+func (c *Config) ddlDir() string {
+	if c.DDLDir != "" {
+		return c.DDLDir
+	}
+	return "ddl"
+}
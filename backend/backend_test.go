@@ -0,0 +1,197 @@
+package backend_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/applier"
+	"github.com/sinmetal/mutation_count_playground/backend"
+	"github.com/sinmetal/mutation_count_playground/cassette"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+)
+
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestFromLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"kind":"spanner","database":"projects/p/instances/i/databases/file","numChannels":4}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name         string
+		env          map[string]string
+		wantKind     backend.Kind
+		wantDatabase string
+		wantErr      bool
+	}{
+		{"database", map[string]string{backend.EnvDatabase: "projects/p/instances/i/databases/d"}, backend.Spanner, "projects/p/instances/i/databases/d", false},
+		{"emulator", map[string]string{backend.EnvDatabase: "projects/p/instances/i/databases/d", backend.EnvEmulatorHost: "localhost:9010"}, backend.Emulator, "projects/p/instances/i/databases/d", false},
+		{"emulator without database", map[string]string{backend.EnvEmulatorHost: "localhost:9010"}, "", "", true},
+		{"fake", map[string]string{backend.EnvFake: "1"}, backend.Fake, backend.DefaultFakeDatabase, false},
+		{"backend", map[string]string{backend.EnvBackend: "fake", backend.EnvDatabase: "projects/p/instances/i/databases/d"}, backend.Fake, "projects/p/instances/i/databases/d", false},
+		{"dryrun", map[string]string{backend.EnvDryRun: "1"}, backend.DryRun, "", false},
+		{"unknown backend", map[string]string{backend.EnvBackend: "hoge"}, "", "", true},
+		{"config file", map[string]string{backend.EnvConfig: path}, backend.Spanner, "projects/p/instances/i/databases/file", false},
+		{"config file with env", map[string]string{backend.EnvConfig: path, backend.EnvDatabase: "projects/p/instances/i/databases/env"}, backend.Spanner, "projects/p/instances/i/databases/env", false},
+		{"limit", map[string]string{backend.EnvFake: "1", backend.EnvLimit: "current"}, backend.Fake, backend.DefaultFakeDatabase, false},
+		{"invalid limit", map[string]string{backend.EnvFake: "1", backend.EnvLimit: "hoge"}, "", "", true},
+		{"cassette record", map[string]string{backend.EnvDatabase: "projects/p/instances/i/databases/d", backend.EnvCassette: "record"}, backend.Spanner, "projects/p/instances/i/databases/d", false},
+		{"cassette replay", map[string]string{backend.EnvCassette: "replay"}, backend.Fake, backend.DefaultFakeDatabase, false},
+		{"cassette replay with database", map[string]string{backend.EnvDatabase: "projects/p/instances/i/databases/d", backend.EnvCassette: "replay"}, "", "", true},
+		{"cassette record with dryrun", map[string]string{backend.EnvDryRun: "1", backend.EnvCassette: "record"}, "", "", true},
+		{"invalid cassette", map[string]string{backend.EnvFake: "1", backend.EnvCassette: "hoge"}, "", "", true},
+		{"cassette skip missing", map[string]string{backend.EnvCassette: "replay", backend.EnvCassetteSkipMissing: "1"}, backend.Fake, backend.DefaultFakeDatabase, false},
+		{"cassette skip missing with record", map[string]string{backend.EnvDatabase: "projects/p/instances/i/databases/d", backend.EnvCassette: "record", backend.EnvCassetteSkipMissing: "1"}, "", "", true},
+		{"cassette skip missing without cassette", map[string]string{backend.EnvFake: "1", backend.EnvCassetteSkipMissing: "1"}, "", "", true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := backend.FromLookup(lookup(tt.env))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want err but got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantKind, got.Kind; e != g {
+				t.Errorf("want kind %s but got %s", e, g)
+			}
+			if e, g := tt.wantDatabase, got.DatabaseName(); e != g {
+				t.Errorf("want database %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestFromLookup_NotConfigured(t *testing.T) {
+	_, err := backend.FromLookup(lookup(map[string]string{}))
+	if e, g := backend.ErrNotConfigured, err; e != g {
+		t.Errorf("want %v but got %v", e, g)
+	}
+}
+
+func TestOpen_Fake(t *testing.T) {
+	ctx := context.Background()
+	b, err := backend.Open(ctx, &backend.Config{Kind: backend.Fake, DDLDir: "../ddl", NumChannels: 1, MinOpened: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close(ctx)
+
+	client, err := b.NewClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Apply(ctx, []*spanner.Mutation{spanner.InsertMap("Measure", map[string]interface{}{"ID": "a"})}); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 1, b.FakeServer().Database(b.Database()).RowCount("Measure"); e != g {
+		t.Errorf("want rows %d but got %d", e, g)
+	}
+}
+
+func TestOpen_FakeLimit(t *testing.T) {
+	ctx := context.Background()
+	b, err := backend.Open(ctx, &backend.Config{Kind: backend.Fake, DDLDir: "../ddl", NumChannels: 1, MinOpened: 1, Limit: "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close(ctx)
+
+	if e, g := 100, b.FakeServer().Limit; e != g {
+		t.Errorf("want limit %d but got %d", e, g)
+	}
+}
+
+func TestOpen_Cassette(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := backend.Open(ctx, &backend.Config{Kind: backend.Fake, DDLDir: "../ddl", NumChannels: 1, MinOpened: 1, Cassette: "record", CassetteDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Cassette() == nil {
+		t.Fatal("want cassette but got nil")
+	}
+	a, err := b.NewApplier(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &cassette.Applier{Applier: a, Name: t.Name()}
+	if _, err := ca.Apply(ctx, []*spanner.Mutation{spanner.InsertMap("Measure", map[string]interface{}{"ID": "a"})}); err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+
+	// Close で Cassette を書き込む
+	if err := b.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c, err := cassette.Load(cassette.Path(dir, t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 1, len(c.Interactions); e != g {
+		t.Errorf("want %d interactions but got %d", e, g)
+	}
+}
+
+func TestOpen_DryRun(t *testing.T) {
+	ctx := context.Background()
+	b, err := backend.Open(ctx, &backend.Config{Kind: backend.DryRun, DDLDir: "../ddl", Limit: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close(ctx)
+
+	if !b.Temporary() {
+		t.Errorf("want temporary but got false")
+	}
+	if _, err := b.NewClient(ctx); err == nil {
+		t.Errorf("want err but got nil")
+	}
+	a, err := b.NewApplier(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if _, ok := a.(*applier.DryRun); !ok {
+		t.Fatalf("want *applier.DryRun but got %T", a)
+	}
+
+	// MeasureNoIndex の ID と Col1 で 2 なので、上限の 2 に収まる
+	if _, err := a.Apply(ctx, []*spanner.Mutation{spanner.InsertMap("MeasureNoIndex", map[string]interface{}{"ID": "a", "Col1": ""})}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.Apply(ctx, []*spanner.Mutation{spanner.InsertMap("MeasureNoIndex", map[string]interface{}{"ID": "b", "Col1": "", "Col2": ""})})
+	if !spanerr.IsMutationLimit(err) {
+		t.Errorf("want mutation limit error but got %v", err)
+	}
+}
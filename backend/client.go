@@ -0,0 +1,219 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"github.com/sinmetal/mutation_count_playground/applier"
+	"github.com/sinmetal/mutation_count_playground/cassette"
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/provision"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+// Backend is Config の接続先. fake の場合は Server を起動している
+type Backend struct {
+	Config *Config
+
+	server   *fakespanner.Server
+	deck     *cassette.Deck
+	database string
+	// created is Open で Database を作成したかどうか. 作成した場合は Close で削除する
+	created bool
+}
+
+// Open is Config の接続先を開く
+// fake の場合は Server を起動して、Provision が指定されている場合と同じく DDLDir の Schema を持つ Database を作成する
+func Open(ctx context.Context, c *Config) (*Backend, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	b := &Backend{Config: c, database: c.DatabaseName()}
+	if c.Kind == DryRun {
+		return b, nil
+	}
+	if c.Cassette != "" {
+		mode, _ := cassette.ParseMode(c.Cassette)
+		b.deck = cassette.NewDeck(c.cassetteDir(), mode)
+	}
+	if c.Kind == Fake {
+		var err error
+		b.server, err = fakespanner.NewServer()
+		if err != nil {
+			return nil, err
+		}
+		profile, _ := c.LimitProfile()
+		b.server.Limit = profile.Limit
+	}
+	if c.Kind != Fake && !c.Provision {
+		return b, nil
+	}
+
+	p, err := b.provisioner(ctx)
+	if err != nil {
+		b.Close(ctx)
+		return nil, err
+	}
+	defer p.Admin.Close()
+
+	switch {
+	case c.Kind == Fake:
+		instance, id, err := splitDatabase(b.database)
+		if err == nil {
+			b.database, err = p.Create(ctx, instance, id)
+		}
+		if err != nil {
+			b.Close(ctx)
+			return nil, err
+		}
+	case c.Database == "":
+		b.database, err = p.Create(ctx, c.Instance, provision.NewDatabaseID("mutcount"))
+		if err != nil {
+			return nil, err
+		}
+		b.created = true
+	default:
+		if _, err := p.Apply(ctx, c.Database); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// splitDatabase is projects/PROJECT_ID/instances/INSTANCE_ID/databases/DATABASE_ID を Instance と Database ID に分ける
+func splitDatabase(name string) (string, string, error) {
+	i := strings.LastIndex(name, "/databases/")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid database name %s", name)
+	}
+	return name[:i], name[i+len("/databases/"):], nil
+}
+
+func (b *Backend) provisioner(ctx context.Context) (*provision.Provisioner, error) {
+	admin, err := database.NewDatabaseAdminClient(ctx, b.ClientOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return &provision.Provisioner{Admin: admin, DDLDir: b.Config.ddlDir()}, nil
+}
+
+// Database is 接続する Database の名前. Provision で作成した場合は作成した Database の名前
+func (b *Backend) Database() string {
+	return b.database
+}
+
+// Temporary is Close で無くなる Database かどうか. Open で作成した Database と fake の Database が該当する
+// dryrun は Database を持たないので常に true
+func (b *Backend) Temporary() bool {
+	return b.created || b.Config.Kind == Fake || b.Config.Kind == DryRun
+}
+
+// FakeServer is fake の場合に起動した Server を返す. fake 以外の場合は nil
+func (b *Backend) FakeServer() *fakespanner.Server {
+	return b.server
+}
+
+// ClientConfig is NumChannels と MinOpened を反映した spanner.ClientConfig
+func (b *Backend) ClientConfig() spanner.ClientConfig {
+	config := spanner.ClientConfig{
+		NumChannels: 12,
+		SessionPoolConfig: spanner.SessionPoolConfig{
+			MinOpened: 50,
+		},
+	}
+	if b.Config.NumChannels > 0 {
+		config.NumChannels = b.Config.NumChannels
+	}
+	if b.Config.MinOpened > 0 {
+		config.SessionPoolConfig.MinOpened = b.Config.MinOpened
+	}
+	return config
+}
+
+// Cassette is Cassette を記録か再生する Deck. Config.Cassette が指定されていない場合は nil
+// Commit と ExecuteSql の ctx に cassette.WithName で Test 名を入れる
+func (b *Backend) Cassette() *cassette.Deck {
+	return b.deck
+}
+
+// ClientOptions is 接続先に合わせた option. Commit Stats を受け取る commitstats.ClientOption と、Cassette の option を含む
+func (b *Backend) ClientOptions() []option.ClientOption {
+	var opts []option.ClientOption
+	switch b.Config.Kind {
+	case Fake:
+		opts = b.server.ClientOptions()
+	case Emulator:
+		opts = []option.ClientOption{
+			option.WithEndpoint(b.Config.EmulatorHost),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithInsecure()),
+			commitstats.ClientOption(),
+		}
+	default:
+		opts = []option.ClientOption{commitstats.ClientOption()}
+	}
+	if b.deck != nil {
+		opts = append(opts, b.deck.ClientOption())
+	}
+	return opts
+}
+
+// NewClient is 接続先の Database の spanner.Client を作成する. dryrun の場合は error を返す
+func (b *Backend) NewClient(ctx context.Context) (*spanner.Client, error) {
+	if b.Config.Kind == DryRun {
+		return nil, fmt.Errorf("backend %s does not have a spanner client", b.Config.Kind)
+	}
+	return spanner.NewClientWithConfig(ctx, b.database, b.ClientConfig(), b.ClientOptions()...)
+}
+
+// NewApplier is 接続先の applier.Applier を作成する
+// spanner と emulator は applier.Client, fake は applier.Fake, dryrun は DDLDir の Schema と Limit で見積もる applier.DryRun を返す
+func (b *Backend) NewApplier(ctx context.Context) (applier.Applier, error) {
+	if b.Config.Kind == DryRun {
+		sc, err := schema.LoadDir(b.Config.ddlDir())
+		if err != nil {
+			return nil, err
+		}
+		profile, _ := b.Config.LimitProfile()
+		return applier.NewDryRun(sc, profile.Limit), nil
+	}
+	c, err := b.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b.Config.Kind == Fake {
+		return &applier.Fake{Client: applier.NewClient(c), Server: b.server, Database: b.server.Database(b.database)}, nil
+	}
+	return applier.NewClient(c), nil
+}
+
+// Close is Open で作成した Database を削除して、fake の Server を停止する
+// Cassette を記録している場合は file に書き込み、再生している場合は記録と一致しなかった Request を error にする
+func (b *Backend) Close(ctx context.Context) error {
+	var err error
+	if b.deck != nil {
+		err = b.deck.Close()
+		b.deck = nil
+	}
+	if b.created {
+		p, perr := b.provisioner(ctx)
+		if perr == nil {
+			perr = p.Drop(ctx, b.database)
+			p.Admin.Close()
+		}
+		if err == nil {
+			err = perr
+		}
+		b.created = false
+	}
+	if b.server != nil {
+		b.server.Close()
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+// Package batch is Mutation を Mutation 数の上限に収まるように複数の Commit に分けて Apply する
+package batch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// Applier is Mutation を 1 つの Commit で Apply する. *spanner.Client が満たす
+type Applier interface {
+	Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error)
+}
+
+// Writer is Mutation を Limit 以下の Batch に分けて Apply する
+type Writer struct {
+	Applier Applier
+	Schema  *schema.Schema
+
+	// Limit is 1 Commit の Mutation 数の上限. 0 の場合は estimator.DefaultLimit を使う
+	Limit int
+
+	// StopOnError is true の場合は、Batch の Apply が失敗したらそれより後の Batch を Apply しない
+	StopOnError bool
+}
+
+// Batch is 1 つの Commit で Apply する Mutation の集まり
+type Batch struct {
+	Mutations []*spanner.Mutation
+	// Count is 見積もった Mutation 数
+	Count int
+}
+
+// Result is 1 つの Batch を Apply した結果
+type Result struct {
+	Batch
+	CommitTimestamp time.Time
+	Err             error
+}
+
+func (w *Writer) limit() int {
+	if w.Limit > 0 {
+		return w.Limit
+	}
+	return estimator.DefaultLimit
+}
+
+// Split is ms を順序を保ったまま Limit 以下の Batch に分ける
+// 順序を変えないので、Interleave の親の Insert は子の Insert より前の Batch か同じ Batch に入る
+// 前から詰めていくので、順序を保つ分け方の中では Batch の数が最小になる
+func (w *Writer) Split(ms []*spanner.Mutation) ([]*Batch, error) {
+	limit := w.limit()
+	var batches []*Batch
+	cur := &Batch{}
+	for i, m := range ms {
+		v, err := estimator.FromSpanner(m)
+		if err != nil {
+			return nil, err
+		}
+		c, err := estimator.CountMutation(w.Schema, v)
+		if err != nil {
+			return nil, err
+		}
+		if c > limit {
+			return nil, fmt.Errorf("mutation[%d] has %d mutations, over the limit %d", i, c, limit)
+		}
+		if cur.Count+c > limit {
+			batches = append(batches, cur)
+			cur = &Batch{}
+		}
+		cur.Mutations = append(cur.Mutations, m)
+		cur.Count += c
+	}
+	if len(cur.Mutations) > 0 {
+		batches = append(batches, cur)
+	}
+	return batches, nil
+}
+
+// Apply is ms を Split して Batch ごとに Apply する
+// Batch の Apply が失敗しても残りの Batch は Apply し、結果は Batch ごとに Result で返す
+// StopOnError の場合は失敗した Batch で止め、Result はそこまでの Batch の分だけ返す. 最後の Result が失敗した Batch になる
+// error を返すのは Split に失敗して 1 つも Apply しなかった場合のみ
+func (w *Writer) Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) ([]*Result, error) {
+	batches, err := w.Split(ms)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*Result, 0, len(batches))
+	for _, b := range batches {
+		ts, err := w.Applier.Apply(ctx, b.Mutations, opts...)
+		results = append(results, &Result{Batch: *b, CommitTimestamp: ts, Err: err})
+		if err != nil && w.StopOnError {
+			break
+		}
+	}
+	return results, nil
+}
+
+// FirstError is results の中で最初に失敗した Batch の error を返す
+func FirstError(results []*Result) error {
+	for i, r := range results {
+		if r.Err != nil {
+			return fmt.Errorf("batch[%d]: %v", i, r.Err)
+		}
+	}
+	return nil
+}
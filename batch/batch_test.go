@@ -0,0 +1,184 @@
+package batch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/batch"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// recordApplier is Apply された Mutation を記録する Applier
+// failAt 番目の Apply だけ失敗させる
+type recordApplier struct {
+	applied [][]*spanner.Mutation
+	failAt  int
+}
+
+func (a *recordApplier) Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error) {
+	a.applied = append(a.applied, ms)
+	if len(a.applied) == a.failAt {
+		return time.Time{}, errors.New("failed")
+	}
+	return time.Unix(int64(len(a.applied)), 0), nil
+}
+
+func loadSchema(t *testing.T) *schema.Schema {
+	s, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestWriter_Apply(t *testing.T) {
+	ctx := context.Background()
+	s := loadSchema(t)
+
+	cases := []struct {
+		name       string
+		mutations  []*spanner.Mutation
+		limit      int
+		wantCounts []int
+	}{
+		// 1 行 10 mutation
+		{"measure insert", createInsertMutation("Measure", 4, 4500), 0, []int{20000, 20000, 5000}},
+		{"measure insert just limit", createInsertMutation("Measure", 4, 2000), 0, []int{20000}},
+		{"custom limit", createInsertMutation("Measure", 4, 25), 100, []int{100, 100, 50}},
+		// 1 行 11 mutation なので 20000 ぴったりには詰められない
+		{"measure update withIndexAll", createUpdateMutation("Measure", 2000), 0, []int{1818 * 11, 182 * 11}},
+		{"empty", nil, 0, nil},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := &recordApplier{}
+			w := &batch.Writer{Applier: a, Schema: s, Limit: tt.limit}
+			results, err := w.Apply(ctx, tt.mutations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := batch.FirstError(results); err != nil {
+				t.Fatal(err)
+			}
+			if e, g := len(tt.wantCounts), len(results); e != g {
+				t.Fatalf("want batches %d but got %d", e, g)
+			}
+			var total int
+			for i, r := range results {
+				if e, g := tt.wantCounts[i], r.Count; e != g {
+					t.Errorf("batches[%d] want count %d but got %d", i, e, g)
+				}
+				c, err := estimator.Count(s, a.applied[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if e, g := r.Count, c; e != g {
+					t.Errorf("batches[%d] applied %d mutations but result count is %d", i, g, e)
+				}
+				if e, g := time.Unix(int64(i+1), 0), r.CommitTimestamp; !e.Equal(g) {
+					t.Errorf("batches[%d] want commit timestamp %v but got %v", i, e, g)
+				}
+				total += len(r.Mutations)
+			}
+			if e, g := len(tt.mutations), total; e != g {
+				t.Errorf("want mutations %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestWriter_Apply_BatchError(t *testing.T) {
+	ctx := context.Background()
+	s := loadSchema(t)
+
+	a := &recordApplier{failAt: 2}
+	w := &batch.Writer{Applier: a, Schema: s}
+	results, err := w.Apply(ctx, createInsertMutation("Measure", 4, 4500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 3, len(a.applied); e != g {
+		t.Errorf("want apply %d but got %d", e, g)
+	}
+	if results[0].Err != nil || results[1].Err == nil || results[2].Err != nil {
+		t.Errorf("unexpected errors %v, %v, %v", results[0].Err, results[1].Err, results[2].Err)
+	}
+	if batch.FirstError(results) == nil {
+		t.Errorf("want err but got err is nil")
+	}
+}
+
+func TestWriter_Apply_StopOnError(t *testing.T) {
+	ctx := context.Background()
+	s := loadSchema(t)
+
+	a := &recordApplier{failAt: 2}
+	w := &batch.Writer{Applier: a, Schema: s, StopOnError: true}
+	results, err := w.Apply(ctx, createInsertMutation("Measure", 4, 4500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 つに分けたうちの 2 つ目で止まり、3 つ目は Apply しない
+	if e, g := 2, len(a.applied); e != g {
+		t.Errorf("want apply %d but got %d", e, g)
+	}
+	if e, g := 2, len(results); e != g {
+		t.Fatalf("want results %d but got %d", e, g)
+	}
+	if results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("unexpected errors %v, %v", results[0].Err, results[1].Err)
+	}
+}
+
+func TestWriter_Apply_MutationOverLimit(t *testing.T) {
+	ctx := context.Background()
+	s := loadSchema(t)
+
+	a := &recordApplier{}
+	w := &batch.Writer{Applier: a, Schema: s, Limit: 5}
+	if _, err := w.Apply(ctx, createInsertMutation("Measure", 4, 1)); err == nil {
+		t.Errorf("want err but got err is nil")
+	}
+	if e, g := 0, len(a.applied); e != g {
+		t.Errorf("want apply %d but got %d", e, g)
+	}
+}
+
+// createInsertMutation is 1 行 normalColumnCount + 6 mutation の Insert を作る
+func createInsertMutation(table string, normalColumnCount int, rowCount int) []*spanner.Mutation {
+	list := make([]*spanner.Mutation, rowCount)
+	for i := 0; i < rowCount; i++ {
+		v := make(map[string]interface{})
+		v["ID"] = uuid.New().String()
+		for j := 1; j <= normalColumnCount; j++ {
+			v[fmt.Sprintf("Col%d", j)] = ""
+		}
+		v["Arr1"] = []string{}
+		v["CommitedAt"] = spanner.CommitTimestamp
+		list[i] = spanner.InsertMap(table, v)
+	}
+	return list
+}
+
+// createUpdateMutation is WithIndex1, WithIndex2 を更新する 1 行 11 mutation の Update を作る
+func createUpdateMutation(table string, rowCount int) []*spanner.Mutation {
+	list := make([]*spanner.Mutation, rowCount)
+	for i := 0; i < rowCount; i++ {
+		v := make(map[string]interface{})
+		v["ID"] = uuid.New().String()
+		v["WithIndex1"] = ""
+		v["WithIndex2"] = ""
+		v["Arr1"] = []string{}
+		v["CommitedAt"] = spanner.CommitTimestamp
+		list[i] = spanner.UpdateMap(table, v)
+	}
+	return list
+}
@@ -0,0 +1,193 @@
+// Package boundary is 1 Commit に含めることができる行数の境界を二分探索で求める
+//
+// measure_*_test.go の "empty : 4-2000" / "empty : 4-2001" のような N と N+1 の組は手で探したものなので、
+// Probe に rowCount を渡して Commit できたかどうかを返してもらい、Commit できる最大の行数と失敗する最小の行数を求める
+package boundary
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sinmetal/mutation_count_playground/estimator"
+)
+
+// Probe is rowCount 行を 1 つの Commit で書き込み、Commit できたかどうかを返す
+// Mutation 数の上限で失敗した場合は false と nil を返し、それ以外の error は err で返す
+type Probe func(ctx context.Context, rowCount int) (ok bool, err error)
+
+// Spec is 探索する対象
+type Spec struct {
+	Table string `json:"table"`
+	Op    string `json:"op"`
+	// Columns is 値を指定する Column
+	Columns []string `json:"columns"`
+
+	// Low is 探索を始める行数. 0 の場合は 1
+	Low int `json:"-"`
+	// High is 探索する最大の行数. 0 の場合は Limit
+	High int `json:"-"`
+	// Limit is Mutation 数の上限. 0 の場合は estimator.DefaultLimit
+	Limit int `json:"limit"`
+}
+
+// Result is 探索の結果
+type Result struct {
+	Spec
+
+	// MaxOK is Commit できた最大の行数. 1 行も Commit できなかった場合は 0
+	MaxOK int `json:"maxOK"`
+	// MinFail is Commit できなかった最小の行数. High まで Commit できた場合は 0
+	MinFail int `json:"minFail"`
+	// PerRow is MaxOK と MinFail から求めた 1 行あたりの Mutation 数. 1 つに決まらない場合は 0
+	PerRow int `json:"perRow"`
+
+	// Probes is Probe を呼んだ回数
+	Probes int `json:"probes"`
+	// MeasuredAt is 探索した時刻
+	MeasuredAt time.Time `json:"measuredAt"`
+	// Backend is 探索した接続先
+	Backend string `json:"backend,omitempty"`
+	// KeyGen is 行の Key を作った Generator. keygen.Parse で作り直すと同じ Key で再現できる
+	KeyGen string `json:"keygen,omitempty"`
+}
+
+func (s *Spec) limit() int {
+	if s.Limit > 0 {
+		return s.Limit
+	}
+	return estimator.DefaultLimit
+}
+
+// Search is probe を使って spec の境界を探す
+// Low から倍々に増やして失敗する行数を見つけ、その間を二分探索する
+func Search(ctx context.Context, spec Spec, probe Probe) (*Result, error) {
+	r := &Result{Spec: spec, MeasuredAt: time.Now()}
+	r.Limit = spec.limit()
+	low := spec.Low
+	if low < 1 {
+		low = 1
+	}
+	high := spec.High
+	if high < 1 {
+		high = r.Limit
+	}
+	if low > high {
+		return nil, fmt.Errorf("low %d is greater than high %d", low, high)
+	}
+
+	try := func(n int) (bool, error) {
+		r.Probes++
+		ok, err := probe(ctx, n)
+		if err != nil {
+			return false, fmt.Errorf("failed probe %d rows: %v", n, err)
+		}
+		return ok, nil
+	}
+
+	// okN は Commit できた行数、failN は Commit できなかった行数. 0 はまだ見つかっていない
+	var okN, failN int
+	for n := low; ; n *= 2 {
+		if n > high {
+			n = high
+		}
+		ok, err := try(n)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			failN = n
+			break
+		}
+		okN = n
+		if n == high {
+			break
+		}
+	}
+	if failN == 0 {
+		r.MaxOK = okN
+		return r, nil
+	}
+	if okN == 0 && failN > 1 {
+		// low で失敗したので 1 から探す
+		ok, err := try(1)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			r.MinFail = 1
+			return r, nil
+		}
+		okN = 1
+	}
+	for failN-okN > 1 {
+		mid := okN + (failN-okN)/2
+		ok, err := try(mid)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			okN = mid
+		} else {
+			failN = mid
+		}
+	}
+	r.MaxOK = okN
+	r.MinFail = failN
+	r.PerRow = perRow(r.Limit, r.MaxOK, r.MinFail)
+	return r, nil
+}
+
+// perRow is maxOK * c <= limit < minFail * c を満たす整数 c を返す. 1 つに決まらない場合は 0
+func perRow(limit, maxOK, minFail int) int {
+	if maxOK == 0 || minFail == 0 {
+		return 0
+	}
+	c := limit / maxOK
+	if limit/minFail+1 != c {
+		// limit / minFail < c <= limit / maxOK の範囲に整数が無いか、複数ある
+		return 0
+	}
+	return c
+}
+
+// WriteJSON is Result を 1 行 1 つの JSON で w に書き込む
+func WriteJSON(w io.Writer, results ...*Result) error {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendFile is Result を path の末尾に追記する. path が無い場合は作成する
+func AppendFile(path string, results ...*Result) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := WriteJSON(f, results...); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadJSON is WriteJSON で書き込んだ Result を読み込む
+func ReadJSON(r io.Reader) ([]*Result, error) {
+	dec := json.NewDecoder(r)
+	var list []*Result
+	for dec.More() {
+		var v Result
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		list = append(list, &v)
+	}
+	return list, nil
+}
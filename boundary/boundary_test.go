@@ -0,0 +1,101 @@
+package boundary_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/boundary"
+)
+
+// limitProbe is 1 行あたり perRow の Mutation 数で limit を超えると失敗する Probe
+func limitProbe(perRow, limit int) boundary.Probe {
+	return func(ctx context.Context, rowCount int) (bool, error) {
+		return rowCount*perRow <= limit, nil
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name        string
+		spec        boundary.Spec
+		perRow      int
+		wantMaxOK   int
+		wantMinFail int
+		wantPerRow  int
+	}{
+		{"10 per row", boundary.Spec{}, 10, 2000, 2001, 10},
+		{"11 per row", boundary.Spec{}, 11, 1818, 1819, 11},
+		{"4 per row", boundary.Spec{Low: 100}, 4, 5000, 5001, 4},
+		{"1 per row", boundary.Spec{}, 1, 20000, 0, 0},
+		{"low is too high", boundary.Spec{Low: 3000}, 10, 2000, 2001, 10},
+		{"custom limit", boundary.Spec{Limit: 80000}, 10, 8000, 8001, 10},
+		{"too many per row", boundary.Spec{}, 20001, 0, 1, 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			limit := tt.spec.Limit
+			if limit == 0 {
+				limit = 20000
+			}
+			got, err := boundary.Search(ctx, tt.spec, limitProbe(tt.perRow, limit))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantMaxOK, got.MaxOK; e != g {
+				t.Errorf("want maxOK %d but got %d", e, g)
+			}
+			if e, g := tt.wantMinFail, got.MinFail; e != g {
+				t.Errorf("want minFail %d but got %d", e, g)
+			}
+			if e, g := tt.wantPerRow, got.PerRow; e != g {
+				t.Errorf("want perRow %d but got %d", e, g)
+			}
+			if got.Probes > 40 {
+				t.Errorf("too many probes %d", got.Probes)
+			}
+		})
+	}
+}
+
+func TestSearch_ProbeError(t *testing.T) {
+	_, err := boundary.Search(context.Background(), boundary.Spec{}, func(ctx context.Context, rowCount int) (bool, error) {
+		return false, errors.New("unavailable")
+	})
+	if err == nil {
+		t.Fatal("want err but got nil")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	ctx := context.Background()
+	r, err := boundary.Search(ctx, boundary.Spec{Table: "Measure", Op: "Insert", Columns: []string{"ID", "Col1"}}, limitProbe(10, 20000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := boundary.WriteJSON(&buf, r, r); err != nil {
+		t.Fatal(err)
+	}
+	got, err := boundary.ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 2, len(got); e != g {
+		t.Fatalf("want results %d but got %d", e, g)
+	}
+	if e, g := "Measure", got[0].Table; e != g {
+		t.Errorf("want table %s but got %s", e, g)
+	}
+	if e, g := 2, len(got[0].Columns); e != g {
+		t.Errorf("want columns %d but got %d", e, g)
+	}
+	if e, g := 10, got[1].PerRow; e != g {
+		t.Errorf("want perRow %d but got %d", e, g)
+	}
+}
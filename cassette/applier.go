@@ -0,0 +1,26 @@
+package cassette
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/applier"
+)
+
+// Applier is 操作の ctx に Name を入れて、Name の Cassette で記録か再生する applier.Applier
+type Applier struct {
+	applier.Applier
+
+	Name string
+}
+
+// Apply is ctx に Name を入れて Apply する
+func (a *Applier) Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error) {
+	return a.Applier.Apply(WithName(ctx, a.Name), ms, opts...)
+}
+
+// Update is ctx に Name を入れて Update する
+func (a *Applier) Update(ctx context.Context, stmt spanner.Statement) (int64, error) {
+	return a.Applier.Update(WithName(ctx, a.Name), stmt)
+}
@@ -0,0 +1,114 @@
+// Package cassette is Spanner への Commit と ExecuteSql の Request と Response を Test ごとに file に記録して、後で network を使わずに再生する
+//
+// 本物の Database に対して一度 Record で実行し、Dir/<Test 名>.json に記録する
+// Replay では fakespanner が Session と Transaction を扱い、Commit と ExecuteSql は記録した Response (too many mutations の error も含む) を返す
+// Request は UUID や Mark のような実行ごとに変わる値と、Mutation 数に関係しない値を除いた形で比べ、記録と一致しない場合は error を返す
+//
+//	deck := cassette.NewDeck("testdata/cassettes", cassette.Replay)
+//	client, err := spanner.NewClient(ctx, database, append(opts, deck.ClientOption())...)
+//	_, err = client.Apply(cassette.WithName(ctx, "TestInsert"), ms)
+//	err = deck.Close()
+//
+// Test 名は WithName で ctx に入れる. Test 名が無い Commit と ExecuteSql は記録も再生もせず、そのまま接続先に送る
+// 1 つの Test の中の順番で Request を比べるので、Test の中で並列に書き込む場合は使えない
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+)
+
+// Method の名前
+const (
+	CommitMethod     = commitstats.CommitMethod
+	ExecuteSQLMethod = "/google.spanner.v1.Spanner/ExecuteSql"
+)
+
+// Mode is 記録するか再生するか
+type Mode string
+
+const (
+	// Record is 接続先に送った Request と Response を記録する
+	Record Mode = "record"
+	// Replay is 記録した Response を返す
+	Replay Mode = "replay"
+)
+
+// ParseMode is record か replay を Mode にする
+func ParseMode(v string) (Mode, error) {
+	switch m := Mode(strings.ToLower(v)); m {
+	case Record, Replay:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid cassette mode %q. use record or replay", v)
+}
+
+// Interaction is 1 回の Commit か ExecuteSql
+type Interaction struct {
+	Method string `json:"method"`
+	// Request is Normalize した Request. Replay の時にこれが一致することを確かめる
+	Request string `json:"request"`
+	// Response is 成功した時の Response の proto. Commit Stats のような unknown field も残る
+	Response []byte `json:"response,omitempty"`
+	// Status is 失敗した時の google.rpc.Status の proto. Details も残る
+	Status []byte `json:"status,omitempty"`
+}
+
+// Cassette is 1 つの Test で記録した Interaction
+type Cassette struct {
+	Name         string         `json:"name"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Path is dir の下の name の Cassette の path. Test 名の / は _ にする
+func Path(dir, name string) string {
+	return filepath.Join(dir, unsafeFileChars.ReplaceAllString(name, "_")+".json")
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// Load is path の Cassette を読み込む
+func Load(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("failed parse %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// Save is Cassette を path に書き込む. Directory が無い場合は作成する
+func (c *Cassette) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+type nameKey struct{}
+
+// WithName is ctx で行う Commit と ExecuteSql を name の Cassette で記録か再生する
+func WithName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, nameKey{}, name)
+}
+
+// NameFromContext is ctx の Cassette の名前を返す. 無い場合は空
+func NameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(nameKey{}).(string)
+	return name
+}
@@ -0,0 +1,132 @@
+package cassette_test
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/sinmetal/mutation_count_playground/cassette"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+func TestParseMode(t *testing.T) {
+	cases := []struct {
+		name    string
+		v       string
+		want    cassette.Mode
+		wantErr bool
+	}{
+		{"record", "record", cassette.Record, false},
+		{"replay", "Replay", cassette.Replay, false},
+		{"empty", "", "", true},
+		{"invalid", "rewind", "", true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cassette.ParseMode(tt.v)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want err but got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"TestInsert", "testdata/TestInsert.json"},
+		{"TestInsert/N+1 rows", "testdata/TestInsert_N_1_rows.json"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if e, g := tt.want, cassette.Path("testdata", tt.name); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	insert := func(table string, columns ...string) *sppb.Mutation {
+		return &sppb.Mutation{Operation: &sppb.Mutation_Insert{Insert: &sppb.Mutation_Write{
+			Table:   table,
+			Columns: columns,
+			Values:  []*structpb.ListValue{{}},
+		}}}
+	}
+	del := &sppb.Mutation{Operation: &sppb.Mutation_Delete_{Delete: &sppb.Mutation_Delete{
+		Table:  "MeasureInterleaveParent",
+		KeySet: &sppb.KeySet{Keys: []*structpb.ListValue{{}, {}}},
+	}}}
+	sql := func(sql string, params ...string) *sppb.ExecuteSqlRequest {
+		req := &sppb.ExecuteSqlRequest{Session: "session", Sql: sql}
+		if len(params) > 0 {
+			req.Params = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+			req.ParamTypes = map[string]*sppb.Type{}
+			for _, p := range params {
+				req.Params.Fields[p] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: "v"}}
+				req.ParamTypes[p] = &sppb.Type{Code: sppb.TypeCode_STRING}
+			}
+		}
+		return req
+	}
+
+	cases := []struct {
+		name string
+		req  proto.Message
+		want string
+	}{
+		{"commit",
+			&sppb.CommitRequest{Session: "session", Mutations: []*sppb.Mutation{
+				insert("Measure", "ID", "Mark", "Col1"),
+				insert("Measure", "Col1", "ID", "Mark"),
+				del,
+			}},
+			"delete MeasureInterleaveParent keys=2 ranges=0 all=false\ninsert Measure (Col1, ID, Mark) rows=1 * 2",
+		},
+		{"empty commit",
+			&sppb.CommitRequest{Session: "session"},
+			"",
+		},
+		{"sql",
+			sql(`UPDATE Measure SET Col1 = "a" WHERE Mark = "run-20261017T093000Z-0123abcd" AND ID = "0b8e4c4e-2d4a-4a53-9f1c-3f3c3c1d0e9a"`),
+			"sql: UPDATE Measure SET Col1 = \"a\" WHERE Mark = \"<mark>\" AND ID = \"<uuid>\"\nparams: ",
+		},
+		{"sql params",
+			sql(`UPDATE Measure SET Col1 = @col1 WHERE Mark = @mark`, "mark", "col1"),
+			"sql: UPDATE Measure SET Col1 = @col1 WHERE Mark = @mark\nparams: col1 STRING, mark STRING",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cassette.Normalize(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != g {
+				t.Errorf("want\n%s\nbut got\n%s", e, g)
+			}
+		})
+	}
+
+	if _, err := cassette.Normalize(&sppb.BeginTransactionRequest{}); err == nil {
+		t.Errorf("want err but got err is nil")
+	}
+}
@@ -0,0 +1,195 @@
+package cassette
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/api/option"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Deck is Mode に従って Test ごとの Cassette を記録か再生する
+type Deck struct {
+	// Dir is Cassette を置く Directory
+	Dir  string
+	Mode Mode
+
+	mu        sync.Mutex
+	cassettes map[string]*Cassette
+	// pos is Replay で次に返す Interaction の位置
+	pos map[string]int
+	// errs is Replay で記録と一致しなかった Request
+	errs []error
+}
+
+// NewDeck is dir の Cassette を mode で扱う Deck を作成する
+func NewDeck(dir string, mode Mode) *Deck {
+	return &Deck{Dir: dir, Mode: mode, cassettes: make(map[string]*Cassette), pos: make(map[string]int)}
+}
+
+// ClientOption is spanner.NewClient に UnaryClientInterceptor を指定する option
+// commitstats.ClientOption の後に実行されるので、Commit Stats を要求した Response を記録して、再生した Response から mutation_count を読める
+func (d *Deck) ClientOption() option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(d.UnaryClientInterceptor))
+}
+
+// UnaryClientInterceptor is ctx に名前がある Commit と ExecuteSql を記録か再生する
+func (d *Deck) UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	name := NameFromContext(ctx)
+	if name == "" || (method != CommitMethod && method != ExecuteSQLMethod) {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	request, err := Normalize(req)
+	if err != nil {
+		return err
+	}
+	if d.Mode == Replay {
+		return d.replay(name, method, request, reply)
+	}
+
+	err = invoker(ctx, method, req, reply, cc, opts...)
+	it := &Interaction{Method: method, Request: request}
+	if err != nil {
+		b, merr := proto.Marshal(status.Convert(err).Proto())
+		if merr != nil {
+			return merr
+		}
+		it.Status = b
+	} else {
+		b, merr := proto.Marshal(reply.(proto.Message))
+		if merr != nil {
+			return merr
+		}
+		it.Response = b
+	}
+	d.mu.Lock()
+	c, ok := d.cassettes[name]
+	if !ok {
+		c = &Cassette{Name: name}
+		d.cassettes[name] = c
+	}
+	c.Interactions = append(c.Interactions, it)
+	d.mu.Unlock()
+	return err
+}
+
+// Recorded is name の Cassette が記録済みかどうか. Replay で記録していない Test を、Request を送る前に見つけるために使う
+func (d *Deck) Recorded(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.cassettes[name]; ok {
+		return true
+	}
+	_, err := os.Stat(Path(d.Dir, name))
+	return err == nil
+}
+
+// replay is name の Cassette の次の Interaction と Request が一致すれば、記録した Response か error を返す
+// 一致しない場合は FailedPrecondition を返し、Err でも分かるように残しておく
+func (d *Deck) replay(name, method, request string, reply interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.load(name)
+	if err != nil {
+		return d.fail(err)
+	}
+	i := d.pos[name]
+	if i >= len(c.Interactions) {
+		return d.fail(fmt.Errorf("cassette %s: no more recorded interactions for %s\n--- got\n%s", name, method, request))
+	}
+	it := c.Interactions[i]
+	if it.Method != method || it.Request != request {
+		return d.fail(fmt.Errorf("cassette %s: interaction %d does not match the recording\n--- recorded %s\n%s\n--- got %s\n%s", name, i, it.Method, it.Request, method, request))
+	}
+	d.pos[name] = i + 1
+
+	if it.Status != nil {
+		var st spb.Status
+		if err := proto.Unmarshal(it.Status, &st); err != nil {
+			return d.fail(fmt.Errorf("cassette %s: interaction %d: %v", name, i, err))
+		}
+		return status.ErrorProto(&st)
+	}
+	if err := proto.Unmarshal(it.Response, reply.(proto.Message)); err != nil {
+		return d.fail(fmt.Errorf("cassette %s: interaction %d: %v", name, i, err))
+	}
+	return nil
+}
+
+// load is Replay で name の Cassette を初めて使う時に file から読み込む
+func (d *Deck) load(name string) (*Cassette, error) {
+	if c, ok := d.cassettes[name]; ok {
+		return c, nil
+	}
+	c, err := Load(Path(d.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("cassette %s is not recorded in %s", name, d.Dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.cassettes[name] = c
+	return c, nil
+}
+
+func (d *Deck) fail(err error) error {
+	d.errs = append(d.errs, err)
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+// Err is Replay で記録と一致しなかった Request をまとめた error. 無い場合は nil
+func (d *Deck) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return joinErrors(d.errs)
+}
+
+// Close is Record の場合は Cassette を file に書き込む
+// Replay の場合は、記録と一致しなかった Request と、使った Cassette のうち最後まで再生しなかった Interaction を error にする
+func (d *Deck) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	names := make([]string, 0, len(d.cassettes))
+	for name := range d.cassettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := append([]error{}, d.errs...)
+	for _, name := range names {
+		c := d.cassettes[name]
+		switch d.Mode {
+		case Record:
+			if err := c.Save(Path(d.Dir, name)); err != nil {
+				errs = append(errs, err)
+			}
+		case Replay:
+			if n := len(c.Interactions) - d.pos[name]; n > 0 {
+				errs = append(errs, fmt.Errorf("cassette %s: %d recorded interactions were not replayed", name, n))
+			}
+		}
+	}
+	return joinErrors(errs)
+}
+
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	list := make([]string, len(errs))
+	for i, err := range errs {
+		list[i] = err.Error()
+	}
+	return fmt.Errorf("%s", strings.Join(list, "\n"))
+}
@@ -0,0 +1,159 @@
+package cassette_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/cassette"
+	"github.com/sinmetal/mutation_count_playground/cleanup"
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+)
+
+const database = "projects/fake/instances/fake/databases/fake"
+
+// limit is 記録する時の上限. Measure の 1 行 (ID, Mark, Col1 と 3 つの Index) が 6 なので 16 行まで入る
+const limit = 100
+
+// scenario is 記録と再生で同じ操作を行い、成否と Commit Stats の mutation_count を文字列で返す
+func scenario(ctx context.Context, client *spanner.Client, mark string, insert int) string {
+	rec := &commitstats.Recorder{}
+	ctx = commitstats.WithRecorder(ctx, rec)
+
+	var results []string
+	apply := func(n int) {
+		var ms []*spanner.Mutation
+		for i := 0; i < n; i++ {
+			ms = append(ms, spanner.InsertMap("Measure", map[string]interface{}{"ID": fmt.Sprintf("%s-%d-%d", mark, n, i), "Mark": mark, "Col1": ""}))
+		}
+		_, err := client.Apply(ctx, ms)
+		results = append(results, result(err))
+	}
+	apply(insert)
+	apply(17)
+
+	// Mark は実行ごとに変わるが、Normalize で置き換えるので再生できる
+	_, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		n, err := tx.Update(ctx, spanner.NewStatement(fmt.Sprintf(`UPDATE Measure SET Col1 = "a" WHERE Mark = "%s"`, mark)))
+		results = append(results, fmt.Sprintf("updated %d", n))
+		return err
+	})
+	results = append(results, result(err))
+	return fmt.Sprintf("%v counts=%v", results, rec.Counts())
+}
+
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case spanerr.IsMutationLimit(err):
+		return "mutation limit"
+	default:
+		return spanner.ErrCode(err).String()
+	}
+}
+
+func newClient(ctx context.Context, t *testing.T, s *fakespanner.Server, deck *cassette.Deck) *spanner.Client {
+	client, err := spanner.NewClientWithConfig(ctx, database, spanner.ClientConfig{}, append(s.ClientOptions(), deck.ClientOption())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestDeck(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const want = "[ok mutation limit updated 10 ok] counts=[60 20]"
+
+	// Record
+	recording, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recording.Close()
+	recording.Limit = limit
+	recording.AddDatabase(database, sc)
+	deck := cassette.NewDeck(dir, cassette.Record)
+	client := newClient(ctx, t, recording, deck)
+	if e, g := want, scenario(cassette.WithName(ctx, "TestDeck"), client, cleanup.NewMark(), 10); e != g {
+		t.Errorf("record: want %s but got %s", e, g)
+	}
+	// 名前の無い ctx は記録しない
+	if _, err := client.Apply(ctx, []*spanner.Mutation{spanner.InsertMap("Measure", map[string]interface{}{"ID": "unnamed", "Col1": ""})}); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if err := deck.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := cassette.Load(cassette.Path(dir, "TestDeck"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 4, len(c.Interactions); e != g {
+		t.Errorf("want %d interactions but got %d", e, g)
+	}
+	if !cassette.NewDeck(dir, cassette.Replay).Recorded("TestDeck") {
+		t.Errorf("want TestDeck recorded")
+	}
+	if cassette.NewDeck(dir, cassette.Replay).Recorded("TestUnknown") {
+		t.Errorf("want TestUnknown not recorded")
+	}
+
+	// Replay は上限の無い Server でも記録した Response を返し、Server には書き込まない
+	cases := []struct {
+		name     string
+		cassette string
+		insert   int
+		want     string
+		wantErr  bool
+	}{
+		{"replay", "TestDeck", 10, want, false},
+		{"changed request", "TestDeck", 11, "[FailedPrecondition FailedPrecondition updated 0 FailedPrecondition] counts=[]", true},
+		{"not recorded", "TestUnknown", 10, "[FailedPrecondition FailedPrecondition updated 0 FailedPrecondition] counts=[]", true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := fakespanner.NewServer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			db := s.AddDatabase(database, sc)
+			deck := cassette.NewDeck(dir, cassette.Replay)
+			client := newClient(ctx, t, s, deck)
+			defer client.Close()
+
+			if e, g := tt.want, scenario(cassette.WithName(ctx, tt.cassette), client, cleanup.NewMark(), tt.insert); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+			if e, g := 0, db.RowCount("Measure"); e != g {
+				t.Errorf("want %d rows but got %d", e, g)
+			}
+			if e, g := tt.wantErr, deck.Err() != nil; e != g {
+				t.Errorf("want err %v but got %v", e, deck.Err())
+			}
+			if e, g := tt.wantErr, deck.Close() != nil; e != g {
+				t.Errorf("want close err %v", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package cassette
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	// markPattern is cleanup.NewMark の形
+	markPattern = regexp.MustCompile(`run-\d{8}T\d{6}Z-[0-9a-f]{8}`)
+)
+
+// Normalize is Request を記録と比べる文字列にする
+// Commit は Mutation ごとの操作、Table、名前順の Column、行数を、同じものは * N でまとめて並べる. Mutation の順番と値は含めない
+// ExecuteSql は SQL の UUID と Mark を置き換えたものと、Parameter の名前と型を並べる. Parameter の値は含めない
+// Session と Transaction の ID はどちらにも含めない
+func Normalize(req interface{}) (string, error) {
+	switch req := req.(type) {
+	case *sppb.CommitRequest:
+		return normalizeCommit(req)
+	case *sppb.ExecuteSqlRequest:
+		return normalizeSQL(req), nil
+	default:
+		return "", fmt.Errorf("unsupported request %T", req)
+	}
+}
+
+func normalizeCommit(req *sppb.CommitRequest) (string, error) {
+	counts := make(map[string]int)
+	for _, m := range req.Mutations {
+		line, err := mutationLine(m)
+		if err != nil {
+			return "", err
+		}
+		counts[line]++
+	}
+	lines := make([]string, 0, len(counts))
+	for line, n := range counts {
+		if n > 1 {
+			line = fmt.Sprintf("%s * %d", line, n)
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+func mutationLine(m *sppb.Mutation) (string, error) {
+	var op string
+	var w *sppb.Mutation_Write
+	switch v := m.Operation.(type) {
+	case *sppb.Mutation_Insert:
+		op, w = "insert", v.Insert
+	case *sppb.Mutation_InsertOrUpdate:
+		op, w = "insert_or_update", v.InsertOrUpdate
+	case *sppb.Mutation_Replace:
+		op, w = "replace", v.Replace
+	case *sppb.Mutation_Update:
+		op, w = "update", v.Update
+	case *sppb.Mutation_Delete_:
+		var keys, ranges int
+		var all bool
+		if ks := v.Delete.KeySet; ks != nil {
+			keys, ranges, all = len(ks.Keys), len(ks.Ranges), ks.All
+		}
+		return fmt.Sprintf("delete %s keys=%d ranges=%d all=%v", v.Delete.Table, keys, ranges, all), nil
+	default:
+		return "", fmt.Errorf("unsupported mutation operation %T", m.Operation)
+	}
+	// InsertMap などは map の順で Column を並べるので、名前順にする
+	columns := append([]string{}, w.Columns...)
+	sort.Strings(columns)
+	return fmt.Sprintf("%s %s (%s) rows=%d", op, w.Table, strings.Join(columns, ", "), len(w.Values)), nil
+}
+
+func normalizeSQL(req *sppb.ExecuteSqlRequest) string {
+	sql := uuidPattern.ReplaceAllString(req.Sql, "<uuid>")
+	sql = markPattern.ReplaceAllString(sql, "<mark>")
+
+	var params []string
+	if req.Params != nil {
+		for name := range req.Params.Fields {
+			typ := "UNKNOWN"
+			if t, ok := req.ParamTypes[name]; ok {
+				typ = t.Code.String()
+			}
+			params = append(params, name+" "+typ)
+		}
+	}
+	sort.Strings(params)
+	return fmt.Sprintf("sql: %s\nparams: %s", sql, strings.Join(params, ", "))
+}
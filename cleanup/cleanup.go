@@ -0,0 +1,226 @@
+// Package cleanup is 計測で書き込んだ行を、実行ごとに入れた Mark で探して削除する
+//
+// measure_*_test.go や experiment の Runner は、書き込むすべての行の Mark に実行ごとの値を入れる
+// Clean は Mark がその値から始まる行を Table ごとに探して、Mutation 数の上限に収まるように分けて Delete する
+//
+// ON DELETE CASCADE の子の Table は親の行と一緒に削除されるので、親の Table にも Mark がある場合は探さない
+// ON DELETE NO ACTION の子の Table は親より先に削除する. 子の行は親の行と同じ Mark を持っている前提
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/batch"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"google.golang.org/api/iterator"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+// MarkColumn is 実行ごとの値を入れる Column
+const MarkColumn = "Mark"
+
+// EnvMark is 実行の Mark を固定する環境変数. 指定しない場合は NewMark で作る
+const EnvMark = "MUTATION_COUNT_MARK"
+
+// EnvKeepRows is 指定すると measure_*_test.go の後に行を削除しない
+const EnvKeepRows = "MUTATION_COUNT_KEEP_ROWS"
+
+// NewMark is 実行ごとの Mark を作る. 時刻とランダムな値を繋げるので、ある Mark が別の Mark の prefix になることはない
+func NewMark() string {
+	return fmt.Sprintf("run-%s-%s", time.Now().UTC().Format("20060102T150405Z"), uuid.New().String()[:8])
+}
+
+// MarkFromEnv is EnvMark が指定されていればその値を、指定されていなければ NewMark の値を返す
+func MarkFromEnv() string {
+	if v := os.Getenv(EnvMark); v != "" {
+		return v
+	}
+	return NewMark()
+}
+
+// Cleaner is Mark で行を探して削除する
+type Cleaner struct {
+	Client *spanner.Client
+	Schema *schema.Schema
+
+	// Limit is 1 Commit の Mutation 数の上限. 0 の場合は estimator.DefaultLimit を使う
+	Limit int
+}
+
+// Target is 1 つの Table で削除する行の Key
+type Target struct {
+	Table string
+	Keys  []spanner.Key
+}
+
+// Tables is Mark で行を探す Table を削除する順に返す
+// Interleave の深い Table から順に並べるので、NO ACTION の子の行は親の行より先に削除される
+func (c *Cleaner) Tables() []*schema.Table {
+	var list []*schema.Table
+	for _, t := range c.Schema.Tables {
+		if t.Column(MarkColumn) == nil || c.cascaded(t) {
+			continue
+		}
+		list = append(list, t)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		di, dj := c.depth(list[i]), c.depth(list[j])
+		if di != dj {
+			return di > dj
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// cascaded is 親の行を削除すると一緒に削除される Table かどうかを返す
+func (c *Cleaner) cascaded(t *schema.Table) bool {
+	for t.Interleave != nil && t.Interleave.OnDelete == schema.Cascade {
+		parent := c.Schema.Table(t.Interleave.Parent)
+		if parent == nil {
+			return false
+		}
+		if parent.Column(MarkColumn) != nil {
+			return true
+		}
+		t = parent
+	}
+	return false
+}
+
+func (c *Cleaner) depth(t *schema.Table) int {
+	d := 0
+	for t.Interleave != nil {
+		t = c.Schema.Table(t.Interleave.Parent)
+		if t == nil {
+			break
+		}
+		d++
+	}
+	return d
+}
+
+// Find is Mark が mark から始まる行の Key を Tables の順に探す
+func (c *Cleaner) Find(ctx context.Context, mark string) ([]*Target, error) {
+	if mark == "" {
+		return nil, fmt.Errorf("mark is required")
+	}
+	var list []*Target
+	for _, t := range c.Tables() {
+		keys, err := c.keys(ctx, t, mark)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			list = append(list, &Target{Table: t.Name, Keys: keys})
+		}
+	}
+	return list, nil
+}
+
+func (c *Cleaner) keys(ctx context.Context, t *schema.Table, mark string) ([]spanner.Key, error) {
+	columns := make([]string, len(t.PrimaryKey))
+	for i, k := range t.PrimaryKey {
+		columns[i] = k.Column
+	}
+	stmt := spanner.NewStatement(fmt.Sprintf("SELECT %s FROM %s WHERE STARTS_WITH(%s, @mark)", strings.Join(columns, ", "), t.Name, MarkColumn))
+	stmt.Params["mark"] = mark
+
+	var keys []spanner.Key
+	iter := c.Client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed query %s: %v", t.Name, err)
+		}
+		key := make(spanner.Key, row.Size())
+		for i := range key {
+			if key[i], err = keyPart(row, i); err != nil {
+				return nil, fmt.Errorf("failed read key of %s: %v", t.Name, err)
+			}
+		}
+		keys = append(keys, key)
+	}
+}
+
+// keyPart is Primary Key の Column の値を spanner.Key に入れられる値にする
+func keyPart(row *spanner.Row, i int) (interface{}, error) {
+	var v spanner.GenericColumnValue
+	if err := row.Column(i, &v); err != nil {
+		return nil, err
+	}
+	switch v.Type.Code {
+	case sppb.TypeCode_STRING:
+		var s spanner.NullString
+		err := v.Decode(&s)
+		return s, err
+	case sppb.TypeCode_INT64:
+		var n spanner.NullInt64
+		err := v.Decode(&n)
+		return n, err
+	case sppb.TypeCode_BOOL:
+		var b spanner.NullBool
+		err := v.Decode(&b)
+		return b, err
+	case sppb.TypeCode_FLOAT64:
+		var f spanner.NullFloat64
+		err := v.Decode(&f)
+		return f, err
+	case sppb.TypeCode_TIMESTAMP:
+		var ts spanner.NullTime
+		err := v.Decode(&ts)
+		return ts, err
+	case sppb.TypeCode_DATE:
+		var d spanner.NullDate
+		err := v.Decode(&d)
+		return d, err
+	case sppb.TypeCode_BYTES:
+		var b []byte
+		err := v.Decode(&b)
+		return b, err
+	default:
+		return nil, fmt.Errorf("unsupported key type %v", v.Type.Code)
+	}
+}
+
+// Delete is targets の行を順に、Mutation 数の上限に収まるように分けて Delete する
+func (c *Cleaner) Delete(ctx context.Context, targets []*Target) error {
+	var ms []*spanner.Mutation
+	for _, t := range targets {
+		for _, key := range t.Keys {
+			ms = append(ms, spanner.Delete(t.Table, key))
+		}
+	}
+	if len(ms) == 0 {
+		return nil
+	}
+	w := &batch.Writer{Applier: c.Client, Schema: c.Schema, Limit: c.Limit}
+	results, err := w.Apply(ctx, ms)
+	if err != nil {
+		return err
+	}
+	return batch.FirstError(results)
+}
+
+// Clean is Mark が mark から始まる行を探して削除する. 削除した行の Key を返す
+func (c *Cleaner) Clean(ctx context.Context, mark string) ([]*Target, error) {
+	targets, err := c.Find(ctx, mark)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Delete(ctx, targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
@@ -0,0 +1,96 @@
+package cleanup_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/cleanup"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+const database = "projects/fake/instances/fake/databases/fake"
+
+func loadSchema(t *testing.T) *schema.Schema {
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+func TestCleaner_Tables(t *testing.T) {
+	c := &cleanup.Cleaner{Schema: loadSchema(t)}
+	var names []string
+	for _, table := range c.Tables() {
+		names = append(names, table.Name)
+	}
+	// MeasureChild, MeasureChildWithIndex は CASCADE で親と一緒に削除され、MeasureNoIndex は Mark を持たない
+	// NO ACTION の MeasureChildNoCascade は親より前に削除する
+	want := "MeasureChildNoCascade,Measure,MeasureCompositeIndex,MeasureParent,MeasureParentNoCascade,MeasureParentWithIndex,MeasureWithStoring"
+	if e, g := want, strings.Join(names, ","); e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
+
+func TestCleaner_Clean(t *testing.T) {
+	ctx := context.Background()
+	sc := loadSchema(t)
+	s, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddDatabase(database, sc)
+	client, err := s.NewClient(ctx, database, spanner.ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var ms []*spanner.Mutation
+	for _, mark := range []string{"run-a", "run-a/case1", "run-b"} {
+		for i := 0; i < 3000; i++ {
+			id := fmt.Sprintf("%s-%d", mark, i)
+			ms = append(ms,
+				spanner.InsertMap("Measure", map[string]interface{}{"ID": id, "Mark": mark}),
+				spanner.InsertMap("MeasureParent", map[string]interface{}{"ID": id, "Mark": mark}),
+				spanner.InsertMap("MeasureChild", map[string]interface{}{"ID": id, "ChildID": "c", "Mark": mark}),
+				spanner.InsertMap("MeasureParentNoCascade", map[string]interface{}{"ID": id, "Mark": mark}),
+				spanner.InsertMap("MeasureChildNoCascade", map[string]interface{}{"ID": id, "ChildID": "c", "Mark": mark}),
+			)
+		}
+	}
+	for i := 0; i < len(ms); i += 1000 {
+		if _, err := client.Apply(ctx, ms[i:i+1000]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &cleanup.Cleaner{Client: client, Schema: sc}
+	targets, err := c.Clean(ctx, "run-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := make(map[string]int)
+	for _, target := range targets {
+		deleted[target.Table] = len(target.Keys)
+	}
+	if e, g := 6000, deleted["MeasureChildNoCascade"]; e != g {
+		t.Errorf("want deleted MeasureChildNoCascade %d but got %d", e, g)
+	}
+
+	db := s.Database(database)
+	for _, table := range []string{"Measure", "MeasureParent", "MeasureChild", "MeasureParentNoCascade", "MeasureChildNoCascade"} {
+		if e, g := 3000, db.RowCount(table); e != g {
+			t.Errorf("want %s rows %d but got %d", table, e, g)
+		}
+	}
+
+	if _, err := c.Find(ctx, ""); err == nil {
+		t.Error("want err for empty mark but got err is nil")
+	}
+}
@@ -0,0 +1,89 @@
+// Command cleanup is 計測で書き込んだ行を Mark で探して削除する
+//
+// 接続先は measure_*_test.go と同じ環境変数か -database で指定する
+//
+//	go run ./cmd/cleanup -database projects/PROJECT_ID/instances/INSTANCE_ID/databases/DATABASE_ID -mark run-20191201T100000Z-1a2b3c4d
+//
+// -mark には Mark の prefix を指定する. run- を指定すると、すべての実行の行を削除する
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sinmetal/mutation_count_playground/backend"
+	"github.com/sinmetal/mutation_count_playground/cleanup"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+func main() {
+	var (
+		database = flag.String("database", "", "projects/PROJECT_ID/instances/INSTANCE_ID/databases/DATABASE_ID. 省略した場合は環境変数の接続先")
+		mark     = flag.String("mark", "", "削除する行の Mark の prefix")
+		ddlDir   = flag.String("ddl", "ddl", "Table の DDL がある Directory")
+		dryRun   = flag.Bool("dry-run", false, "削除せずに、削除する行の数だけを表示する")
+	)
+	flag.Parse()
+
+	if err := run(context.Background(), *database, *mark, *ddlDir, *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, database, mark, ddlDir string, dryRun bool) error {
+	if mark == "" {
+		return fmt.Errorf("-mark is required")
+	}
+	c, err := config(database)
+	if err != nil {
+		return err
+	}
+	b, err := backend.Open(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer b.Close(ctx)
+
+	sc, err := schema.LoadDir(ddlDir)
+	if err != nil {
+		return err
+	}
+	client, err := b.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	cleaner := &cleanup.Cleaner{Client: client, Schema: sc}
+	targets, err := cleaner.Find(ctx, mark)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		fmt.Printf("%s: %d rows\n", t.Table, len(t.Keys))
+	}
+	if dryRun {
+		return nil
+	}
+	return cleaner.Delete(ctx, targets)
+}
+
+// config is 環境変数の接続先を読み込んで、database が指定されている場合は置き換える
+// 既存の行を削除するだけなので、Database の作成はしない
+func config(database string) (*backend.Config, error) {
+	c, err := backend.FromEnv()
+	switch {
+	case err == backend.ErrNotConfigured && database != "":
+		c = &backend.Config{Kind: backend.Spanner}
+	case err != nil:
+		return nil, err
+	}
+	if database != "" {
+		c.Database = database
+	}
+	c.Provision = false
+	return c, nil
+}
@@ -0,0 +1,191 @@
+// Command conformance is experiments/*.json の Case を複数の接続先で実行して、結果が食い違う Case を表示する
+//
+// 最初の -backend を基準にして、他の接続先の成否と Commit Stats の mutation_count を比べる
+//
+//	go run ./cmd/conformance -backend spanner=spanner.json -backend emulator -backend fake -backend dryrun -format markdown
+//
+// -backend には NAME=VALUE か VALUE を指定する. VALUE は backend の設定ファイルの path (.json) か
+// spanner, emulator, fake, dryrun のいずれかで、Database や Emulator の host は measure_*_test.go と同じ環境変数から読む
+// NAME を省略した場合は VALUE を名前にする
+//
+// -keygen には行の Key を作る Generator (keygen.Parse の形式) を指定する. すべての接続先が同じ Key を書き込むので、食い違った Case を同じ Key で再現できる
+// 省略した場合は MUTATION_COUNT_KEYGEN の値を使い、それも無い場合は random
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sinmetal/mutation_count_playground/backend"
+	"github.com/sinmetal/mutation_count_playground/cleanup"
+	"github.com/sinmetal/mutation_count_playground/conformance"
+	"github.com/sinmetal/mutation_count_playground/experiment"
+	"github.com/sinmetal/mutation_count_playground/keygen"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// backendFlags is 繰り返し指定できる -backend
+type backendFlags []string
+
+func (f *backendFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *backendFlags) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+func main() {
+	var backends backendFlags
+	flag.Var(&backends, "backend", "比較する接続先. NAME=VALUE か VALUE. 2 つ以上指定する")
+	var (
+		experiments = flag.String("experiments", "experiments", "Spec の JSON がある Directory")
+		ddlDir      = flag.String("ddl", "ddl", "Table の DDL がある Directory")
+		format      = flag.String("format", "text", "text, json, markdown")
+		keys        = flag.String("keygen", os.Getenv(keygen.EnvKeyGen), "行の Key を作る Generator. random, uuid[:SEED], sequential[:START], bitreversed[:START]")
+	)
+	flag.Parse()
+
+	if err := run(context.Background(), backends, *experiments, *ddlDir, *format, *keys); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, backends []string, experiments, ddlDir, format, keys string) error {
+	if len(backends) < 2 {
+		return fmt.Errorf("specify -backend at least 2 times")
+	}
+	switch format {
+	case "text", "json", "markdown", "md":
+	default:
+		return fmt.Errorf("invalid format %q. use text, json or markdown", format)
+	}
+	specs, err := experiment.LoadDir(experiments)
+	if err != nil {
+		return err
+	}
+	// uuid の SEED を省略した場合も、String の値から作り直せば接続先ごとに同じ Key になる
+	kg, err := keygen.Parse(keys)
+	if err != nil {
+		return err
+	}
+
+	mark := cleanup.NewMark()
+	var targets []*conformance.Target
+	for _, v := range backends {
+		name, c, err := parseBackend(v)
+		if err != nil {
+			return err
+		}
+		if c.DDLDir == "" {
+			c.DDLDir = ddlDir
+		}
+		b, err := backend.Open(ctx, c)
+		if err != nil {
+			return fmt.Errorf("failed open %s: %v", name, err)
+		}
+		defer closeBackend(ctx, b, mark)
+		a, err := b.NewApplier(ctx)
+		if err != nil {
+			return fmt.Errorf("failed open %s: %v", name, err)
+		}
+		defer a.Close()
+
+		profile, _ := c.LimitProfile()
+		tk, err := keygen.Parse(kg.String())
+		if err != nil {
+			return err
+		}
+		targets = append(targets, &conformance.Target{
+			Name:   name,
+			Runner: &experiment.Runner{Client: a, DDLDir: c.DDLDir, Mark: mark, Limit: profile.Limit, Keys: tk},
+		})
+	}
+
+	r, err := conformance.Run(ctx, specs, targets)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "text":
+		fmt.Print(r.Text())
+	case "json":
+		s, err := r.JSON()
+		if err != nil {
+			return err
+		}
+		fmt.Print(s)
+	default:
+		fmt.Print(r.Markdown())
+	}
+	return nil
+}
+
+// parseBackend is NAME=VALUE か VALUE を名前と設定にする
+// VALUE が .json で終わる場合は設定ファイルとして読み、それ以外は MUTATION_COUNT_BACKEND の値として環境変数と合わせて読む
+func parseBackend(v string) (string, *backend.Config, error) {
+	name := v
+	if i := strings.Index(v, "="); i >= 0 {
+		name, v = v[:i], v[i+1:]
+	} else if strings.HasSuffix(v, ".json") {
+		name = strings.TrimSuffix(filepath.Base(v), ".json")
+	}
+
+	override := map[string]string{
+		backend.EnvConfig:   "",
+		backend.EnvBackend:  v,
+		backend.EnvFake:     "",
+		backend.EnvDryRun:   "",
+		backend.EnvCassette: "",
+	}
+	if strings.HasSuffix(v, ".json") {
+		override[backend.EnvConfig] = v
+		override[backend.EnvBackend] = ""
+	}
+	c, err := backend.FromLookup(func(key string) (string, bool) {
+		if o, ok := override[key]; ok {
+			return o, o != ""
+		}
+		return os.LookupEnv(key)
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid backend %s: %v", name, err)
+	}
+	return name, c, nil
+}
+
+// closeBackend is mark の行を削除して接続先を閉じる. Close で Database ごと無くなる場合は削除しない
+func closeBackend(ctx context.Context, b *backend.Backend, mark string) {
+	if !b.Temporary() {
+		if err := clean(ctx, b, mark); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if err := b.Close(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func clean(ctx context.Context, b *backend.Backend, mark string) error {
+	sc, err := schema.LoadDir(b.Config.DDLDir)
+	if err != nil {
+		return err
+	}
+	client, err := b.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	c := &cleanup.Cleaner{Client: client, Schema: sc}
+	if _, err := c.Clean(ctx, mark); err != nil {
+		return fmt.Errorf("failed cleanup mark=%s: %v", mark, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Command matrix is Table の Index の定義から、値を入れる Column の組み合わせの experiment の Spec を作って JSON で出力する
+//
+//	go run ./cmd/matrix -ddl ddl/measure_storing_index.sql -table MeasureWithStoring > /tmp/matrix.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sinmetal/mutation_count_playground/matrix"
+)
+
+func main() {
+	var (
+		ddl    = flag.String("ddl", "", "Table の DDL の File. ddl/ の下の File を指定する")
+		table  = flag.String("table", "", "対象の Table")
+		name   = flag.String("name", "", "Spec の名前. 省略した場合は Table 名 + matrix")
+		normal = flag.Int("normal", 1, "各 Case で値を入れる Col1, Col2... の数")
+	)
+	flag.Parse()
+
+	if err := run(*ddl, *table, *name, *normal); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ddl, table, name string, normal int) error {
+	if ddl == "" || table == "" {
+		return fmt.Errorf("-ddl and -table are required")
+	}
+	s, err := matrix.Generate(ddl, table, matrix.Options{Name: name, NormalColumnCount: normal})
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,96 @@
+// Command mutcount is DDL から 1 行の Mutation 数と、1 つの Commit に含めることができる最大の行数を表示する
+//
+// Spanner には接続せず、estimator のルールで見積もる
+//
+//	go run ./cmd/mutcount -ddl ddl/measure_composite_index.sql -table MeasureCompositeIndex -op update -columns WithCompositeIndex1
+//
+// -ddl には DDL の File か Directory を指定する. Interleave の子の Table が別の File にある場合は Directory を指定する
+// -format には text, json, markdown を指定できる
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+func main() {
+	var (
+		ddl     = flag.String("ddl", "ddl", "Table の DDL の File か Directory")
+		table   = flag.String("table", "", "Mutation の対象の Table")
+		op      = flag.String("op", "insert", "insert, insert_or_update, replace, update, delete")
+		columns = flag.String("columns", "", "値を書き込む Column を , 区切りで指定する. Primary Key の Column は省略できる")
+		limit   = flag.String("limit", os.Getenv(estimator.EnvLimit), "Mutation 数の上限. legacy, current または数値. 省略した場合は legacy")
+		format  = flag.String("format", "text", "text, json, markdown")
+	)
+	flag.Parse()
+
+	if err := run(*ddl, *table, *op, *columns, *limit, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ddl, table, op, columns, limit, format string) error {
+	if table == "" {
+		return fmt.Errorf("-table is required")
+	}
+	o, err := estimator.ParseOp(op)
+	if err != nil {
+		return err
+	}
+	p, err := estimator.ParseProfile(limit)
+	if err != nil {
+		return err
+	}
+	sc, err := load(ddl)
+	if err != nil {
+		return err
+	}
+
+	r, err := estimator.NewReport(sc, table, o, splitColumns(columns), p)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "text":
+		fmt.Print(r.Text())
+	case "json":
+		s, err := r.JSON()
+		if err != nil {
+			return err
+		}
+		fmt.Print(s)
+	case "markdown", "md":
+		fmt.Print(r.Markdown())
+	default:
+		return fmt.Errorf("invalid format %q. use text, json or markdown", format)
+	}
+	return nil
+}
+
+// load is path が Directory の場合は LoadDir, File の場合は ParseFile で Schema を読み込む
+func load(path string) (*schema.Schema, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return schema.LoadDir(path)
+	}
+	return schema.ParseFile(path)
+}
+
+func splitColumns(v string) []string {
+	var list []string
+	for _, c := range strings.Split(v, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			list = append(list, c)
+		}
+	}
+	return list
+}
@@ -0,0 +1,213 @@
+// Package commitstats is Commit の CommitResponse に入る Commit Stats の mutation_count を受け取る
+//
+// 行数を変えながら Apply が失敗するかどうかで境界を探さなくても、成功した Commit の Mutation 数を直接知ることができる
+// 依存している genproto の CommitRequest と CommitResponse には return_commit_stats と commit_stats の field が無いので、
+// gRPC の Interceptor で proto の field 番号を指定して直接書き込み、読み出す
+//
+//	rec := &commitstats.Recorder{}
+//	_, err := client.Apply(commitstats.WithRecorder(ctx, rec), ms)
+//	n, ok := rec.Last()
+//
+// client は ClientOption を指定して作成する. fakespanner.Server.ClientOptions と backend は指定済み
+package commitstats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/api/option"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc"
+)
+
+// proto の field 番号. google/spanner/v1/spanner.proto と commit_response.proto を参照
+const (
+	// returnCommitStatsField is CommitRequest.return_commit_stats (bool)
+	returnCommitStatsField = 5
+	// commitStatsField is CommitResponse.commit_stats (CommitStats)
+	commitStatsField = 2
+	// mutationCountField is CommitStats.mutation_count (int64)
+	mutationCountField = 1
+)
+
+// CommitMethod is Commit の gRPC の method 名
+const CommitMethod = "/google.spanner.v1.Spanner/Commit"
+
+// Recorder is Commit Stats の mutation_count を記録する
+// ReadWriteTransaction が Abort で Retry された場合は、成功した Commit の分だけが記録される
+type Recorder struct {
+	mu     sync.Mutex
+	counts []int64
+}
+
+// Record is mutation_count を記録する. Interceptor の他に、Commit せずに Mutation 数を見積もる applier.DryRun も使う
+func (r *Recorder) Record(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts = append(r.counts, n)
+}
+
+// Counts is 記録した mutation_count を Commit の順に返す
+func (r *Recorder) Counts() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64{}, r.counts...)
+}
+
+// Last is 最後に記録した mutation_count を返す. 1 つも記録していない場合は false
+func (r *Recorder) Last() (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.counts) == 0 {
+		return 0, false
+	}
+	return r.counts[len(r.counts)-1], true
+}
+
+type recorderKey struct{}
+
+// WithRecorder is ctx で行う Commit の Commit Stats を r に記録する
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// FromContext is ctx の Recorder を返す. 無い場合は nil
+func FromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
+
+// UnaryClientInterceptor is ctx に Recorder がある Commit に return_commit_stats を指定して、返ってきた mutation_count を記録する
+// Recorder が無い場合は何もしない
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	r := FromContext(ctx)
+	if r == nil || method != CommitMethod {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	if req, ok := req.(*sppb.CommitRequest); ok {
+		Request(req)
+	}
+	if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+		return err
+	}
+	if resp, ok := reply.(*sppb.CommitResponse); ok {
+		n, ok, err := MutationCount(resp)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.Record(n)
+		}
+	}
+	return nil
+}
+
+// ClientOption is spanner.NewClient に UnaryClientInterceptor を指定する option
+func ClientOption() option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithUnaryInterceptor(UnaryClientInterceptor))
+}
+
+// Request is req に return_commit_stats = true を指定する
+func Request(req *sppb.CommitRequest) {
+	if Requested(req) {
+		return
+	}
+	b := proto.NewBuffer(req.XXX_unrecognized)
+	b.EncodeVarint(returnCommitStatsField<<3 | proto.WireVarint)
+	b.EncodeVarint(1)
+	req.XXX_unrecognized = b.Bytes()
+}
+
+// Requested is req に return_commit_stats = true が指定されているかどうか
+func Requested(req *sppb.CommitRequest) bool {
+	var requested bool
+	err := walk(req.XXX_unrecognized, func(field int, wire int, v uint64, raw []byte) {
+		if field == returnCommitStatsField && wire == proto.WireVarint {
+			requested = v != 0
+		}
+	})
+	return err == nil && requested
+}
+
+// SetMutationCount is resp に commit_stats.mutation_count を書き込む
+func SetMutationCount(resp *sppb.CommitResponse, n int64) {
+	stats := proto.NewBuffer(nil)
+	stats.EncodeVarint(mutationCountField<<3 | proto.WireVarint)
+	stats.EncodeVarint(uint64(n))
+
+	b := proto.NewBuffer(resp.XXX_unrecognized)
+	b.EncodeVarint(commitStatsField<<3 | proto.WireBytes)
+	b.EncodeRawBytes(stats.Bytes())
+	resp.XXX_unrecognized = b.Bytes()
+}
+
+// MutationCount is resp の commit_stats.mutation_count を返す. commit_stats が無い場合は false
+func MutationCount(resp *sppb.CommitResponse) (int64, bool, error) {
+	var stats []byte
+	var found bool
+	err := walk(resp.XXX_unrecognized, func(field int, wire int, v uint64, raw []byte) {
+		if field == commitStatsField && wire == proto.WireBytes {
+			stats, found = raw, true
+		}
+	})
+	if err != nil || !found {
+		return 0, false, err
+	}
+	var n int64
+	err = walk(stats, func(field int, wire int, v uint64, raw []byte) {
+		if field == mutationCountField && wire == proto.WireVarint {
+			n = int64(v)
+		}
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return n, true, nil
+}
+
+// walk is proto の wire format の field を順に f に渡す. varint と fixed は v に、length-delimited は raw に入る
+func walk(data []byte, f func(field int, wire int, v uint64, raw []byte)) error {
+	for len(data) > 0 {
+		key, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return fmt.Errorf("failed decode field key")
+		}
+		data = data[n:]
+		field, wire := int(key>>3), int(key&7)
+		switch wire {
+		case proto.WireVarint:
+			v, n := proto.DecodeVarint(data)
+			if n == 0 {
+				return fmt.Errorf("failed decode field %d", field)
+			}
+			data = data[n:]
+			f(field, wire, v, nil)
+		case proto.WireFixed64, proto.WireFixed32:
+			size := 8
+			if wire == proto.WireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return fmt.Errorf("failed decode field %d", field)
+			}
+			var v uint64
+			for i := size - 1; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[size:]
+			f(field, wire, v, nil)
+		case proto.WireBytes:
+			l, n := proto.DecodeVarint(data)
+			if n == 0 || uint64(len(data)-n) < l {
+				return fmt.Errorf("failed decode field %d", field)
+			}
+			f(field, wire, 0, data[n:n+int(l)])
+			data = data[n+int(l):]
+		default:
+			return fmt.Errorf("unsupported wire type %d of field %d", wire, field)
+		}
+	}
+	return nil
+}
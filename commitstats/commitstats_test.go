@@ -0,0 +1,154 @@
+package commitstats_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/golang/protobuf/proto"
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+const database = "projects/fake/instances/fake/databases/fake"
+
+func TestRequest(t *testing.T) {
+	req := &sppb.CommitRequest{Session: "s", Mutations: []*sppb.Mutation{}}
+	if commitstats.Requested(req) {
+		t.Errorf("want not requested")
+	}
+	commitstats.Request(req)
+	commitstats.Request(req)
+	if !commitstats.Requested(req) {
+		t.Errorf("want requested")
+	}
+
+	// Marshal して Unmarshal しても残る
+	b, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got sppb.CommitRequest
+	if err := proto.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !commitstats.Requested(&got) {
+		t.Errorf("want requested after unmarshal")
+	}
+	if e, g := "s", got.Session; e != g {
+		t.Errorf("want session %s but got %s", e, g)
+	}
+	// return_commit_stats は 1 回だけ書き込む
+	if e, g := []byte{5<<3 | proto.WireVarint, 1}, got.XXX_unrecognized; string(e) != string(g) {
+		t.Errorf("want %v but got %v", e, g)
+	}
+}
+
+func TestMutationCount(t *testing.T) {
+	resp := &sppb.CommitResponse{}
+	if _, ok, err := commitstats.MutationCount(resp); ok || err != nil {
+		t.Errorf("want no commit stats but got ok=%v err=%v", ok, err)
+	}
+
+	commitstats.SetMutationCount(resp, 20000)
+	b, err := proto.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got sppb.CommitResponse
+	if err := proto.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	n, ok, err := commitstats.MutationCount(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("want commit stats")
+	}
+	if e, g := int64(20000), n; e != g {
+		t.Errorf("want %d but got %d", e, g)
+	}
+
+	broken := &sppb.CommitResponse{XXX_unrecognized: []byte{2<<3 | proto.WireBytes, 10, 1}}
+	if _, _, err := commitstats.MutationCount(broken); err == nil {
+		t.Errorf("want err but got err is nil")
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddDatabase(database, sc)
+	client, err := s.NewClient(ctx, database, spanner.ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 1 行 [1:ID, 2:Col1, 3:MeasureWithIndex1_1, 4:MeasureWithIndex2_1, 5:MeasureWithIndex2_2]
+	rows := func(prefix string, n int) []*spanner.Mutation {
+		var ms []*spanner.Mutation
+		for i := 0; i < n; i++ {
+			ms = append(ms, spanner.InsertMap("Measure", map[string]interface{}{"ID": fmt.Sprintf("%s-%d", prefix, i), "Col1": ""}))
+		}
+		return ms
+	}
+
+	cases := []struct {
+		name string
+		f    func(ctx context.Context) error
+		want []int64
+	}{
+		{"apply", func(ctx context.Context) error {
+			_, err := client.Apply(ctx, rows("apply", 10))
+			return err
+		}, []int64{50}},
+		{"apply at least once", func(ctx context.Context) error {
+			_, err := client.Apply(ctx, rows("once", 3), spanner.ApplyAtLeastOnce())
+			return err
+		}, []int64{15}},
+		// BufferWrite した 2 行 (10) と、前の Case で書き込んだ 13 行を DML で更新した 26 ([1:ID, 2:Col1] * 13)
+		{"read write transaction", func(ctx context.Context) error {
+			_, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+				if err := tx.BufferWrite(rows("rwt", 2)); err != nil {
+					return err
+				}
+				_, err := tx.Update(ctx, spanner.NewStatement(`UPDATE Measure SET Col1 = "a" WHERE Col1 = ""`))
+				return err
+			})
+			return err
+		}, []int64{36}},
+		{"over the limit", func(ctx context.Context) error {
+			_, err := client.Apply(ctx, rows("over", 4001))
+			if err == nil {
+				return fmt.Errorf("want err but got err is nil")
+			}
+			return nil
+		}, nil},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &commitstats.Recorder{}
+			if err := tt.f(commitstats.WithRecorder(ctx, rec)); err != nil {
+				t.Fatal(err)
+			}
+			if e, g := fmt.Sprint(tt.want), fmt.Sprint(rec.Counts()); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
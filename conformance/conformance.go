@@ -0,0 +1,110 @@
+// Package conformance is 同じ experiment の Spec を複数の接続先で実行して、結果が食い違う Case を並べる
+//
+// Emulator は本番の Spanner より Mutation 数の上限の判定が緩いなど、接続先によって結果が異なることがある
+// 最初の Target を基準にして、他の Target の Case ごとの成否と Commit Stats の mutation_count を比べ、
+// ローカルの接続先の結果をどこまで信用できるかを Report にする
+//
+// fake と dryrun はどちらも estimator で Mutation 数を数えるので、この 2 つを比べても食い違うことはない
+// estimator のルールを確かめるには、Cloud Spanner を基準にする
+//
+//	go run ./cmd/conformance -backend spanner=spanner.json -backend emulator -backend fake -backend dryrun
+package conformance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sinmetal/mutation_count_playground/experiment"
+	"github.com/sinmetal/mutation_count_playground/keygen"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+)
+
+// Target is 比較する接続先
+type Target struct {
+	// Name is Report に出す名前
+	Name   string
+	Runner *experiment.Runner
+}
+
+// Outcome is 1 つの Target で 1 つの Case を実行した結果
+type Outcome struct {
+	Target string `json:"target"`
+	// Passed is Case の期待通りだったかどうか. 前準備に失敗した場合は false
+	Passed   bool `json:"passed"`
+	RowCount int  `json:"rowCount"`
+	// MutationCount is Commit Stats の mutation_count. 返ってこなかった場合は 0
+	MutationCount int64 `json:"mutationCount"`
+	// Err is 計測した操作か前準備の error
+	Err string `json:"err,omitempty"`
+	// ErrKind is Err の種類. Diff には長い Err の代わりにこれを出す
+	ErrKind string `json:"errKind,omitempty"`
+}
+
+// Outcome.ErrKind の値
+const (
+	ErrSetup           = "setup"
+	ErrMutationLimit   = "mutation limit"
+	ErrCommitSize      = "commit size"
+	ErrInvalidArgument = "invalid argument"
+	ErrOther           = "other"
+)
+
+// Case is 1 つの Case をすべての Target で実行した結果
+type Case struct {
+	Spec    string `json:"spec"`
+	Case    string `json:"case"`
+	WantErr bool   `json:"wantErr"`
+	// Outcomes is Target の順の結果
+	Outcomes []*Outcome `json:"outcomes"`
+}
+
+// Run is specs のすべての Case を targets で順に実行して Report を作る. 最初の Target を基準にする
+// Case の前準備に失敗した場合も止めずに、その Target の Outcome に error を入れる
+func Run(ctx context.Context, specs []*experiment.Spec, targets []*Target) (*Report, error) {
+	if len(targets) < 2 {
+		return nil, fmt.Errorf("conformance requires at least 2 targets, got %d", len(targets))
+	}
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.Name
+	}
+
+	var cases []*Case
+	for _, s := range specs {
+		for _, c := range s.Cases {
+			row := &Case{Spec: s.Name, Case: c.Name, WantErr: c.WantErr}
+			for _, t := range targets {
+				res, err := t.Runner.RunCase(ctx, s, c)
+				row.Outcomes = append(row.Outcomes, outcome(t.Name, res, err))
+			}
+			cases = append(cases, row)
+		}
+	}
+	r := NewReport(names, cases)
+	r.KeyGen = keygen.KindRandom
+	if k := targets[0].Runner.Keys; k != nil {
+		r.KeyGen = k.String()
+	}
+	return r, nil
+}
+
+func outcome(target string, res *experiment.Result, err error) *Outcome {
+	if err != nil {
+		return &Outcome{Target: target, Err: err.Error(), ErrKind: ErrSetup}
+	}
+	o := &Outcome{Target: target, Passed: res.Passed(), RowCount: res.RowCount, MutationCount: res.MutationCount}
+	if res.Err != nil {
+		o.Err = res.Err.Error()
+		switch spanerr.Classify(res.Err).(type) {
+		case *spanerr.MutationLimitError:
+			o.ErrKind = ErrMutationLimit
+		case *spanerr.CommitSizeError:
+			o.ErrKind = ErrCommitSize
+		case *spanerr.InvalidArgumentError:
+			o.ErrKind = ErrInvalidArgument
+		default:
+			o.ErrKind = ErrOther
+		}
+	}
+	return o
+}
@@ -0,0 +1,192 @@
+package conformance_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/applier"
+	"github.com/sinmetal/mutation_count_playground/conformance"
+	"github.com/sinmetal/mutation_count_playground/experiment"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/keygen"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+const database = "projects/fake/instances/fake/databases/fake"
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// strict は Runner と同じ上限、loose は上限が緩い接続先の代わり
+	// 同じ SEED の Generator を使うので、すべての Target が同じ Key を書き込む
+	targets := []*conformance.Target{
+		{Name: "dryrun", Runner: &experiment.Runner{Client: applier.NewDryRun(sc, 4000), DDLDir: "../ddl", Limit: 4000, Keys: keygen.NewUUID(1)}},
+	}
+	for _, v := range []struct {
+		name  string
+		limit int
+	}{
+		{"strict", 4000},
+		{"loose", 4100},
+	} {
+		s, err := fakespanner.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		s.Limit = v.limit
+		s.AddDatabase(database, sc)
+		client, err := s.NewClient(ctx, database, spanner.ClientConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		targets = append(targets, &conformance.Target{Name: v.name, Runner: &experiment.Runner{Client: applier.NewClient(client), DDLDir: "../ddl", Limit: 4000, Keys: keygen.NewUUID(1)}})
+	}
+
+	spec := &experiment.Spec{
+		Name:  "Measure",
+		DDL:   "measure.sql",
+		Table: "Measure",
+		Cases: []*experiment.Case{
+			// ID, Arr1, CommitedAt, Col1...Col6 と 3 つの Index で 1 行 12 なので 333 行と 334 行になる
+			{Name: "insert N", Op: experiment.Insert, NormalColumnCount: 6, PerRow: 12},
+			{Name: "insert N+1", Op: experiment.Insert, NormalColumnCount: 6, PerRow: 12, WantErr: true},
+			{Name: "delete 10", Op: experiment.Delete, NormalColumnCount: 6, RowCount: 10},
+		},
+	}
+	r, err := conformance.Run(ctx, []*experiment.Spec{spec}, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e, g := "dryrun", r.Reference; e != g {
+		t.Errorf("want reference %s but got %s", e, g)
+	}
+	if e, g := "uuid:1", r.KeyGen; e != g {
+		t.Errorf("want keygen %s but got %s", e, g)
+	}
+	if e, g := 2, len(r.Summaries); e != g {
+		t.Fatalf("want summaries %d but got %d", e, g)
+	}
+	cases := []struct {
+		target       string
+		agreed       int
+		outcomeDiffs int
+		counted      int
+	}{
+		// 失敗した Commit は mutation_count を返さないので、比べられるのは 2 つ
+		{"strict", 3, 0, 2},
+		// 上限が緩いと N+1 が成功してしまう
+		{"loose", 2, 1, 2},
+	}
+	for i, tt := range cases {
+		s := r.Summaries[i]
+		if e, g := tt.target, s.Target; e != g {
+			t.Errorf("want target %s but got %s", e, g)
+		}
+		if e, g := 3, s.Cases; e != g {
+			t.Errorf("%s: want cases %d but got %d", tt.target, e, g)
+		}
+		if e, g := tt.agreed, s.Agreed; e != g {
+			t.Errorf("%s: want agreed %d but got %d", tt.target, e, g)
+		}
+		if e, g := tt.outcomeDiffs, s.OutcomeDiffs; e != g {
+			t.Errorf("%s: want outcome diffs %d but got %d", tt.target, e, g)
+		}
+		if e, g := tt.counted, s.Counted; e != g {
+			t.Errorf("%s: want counted %d but got %d", tt.target, e, g)
+		}
+		if e, g := 0, s.CountDiffs; e != g {
+			t.Errorf("%s: want count diffs %d but got %d", tt.target, e, g)
+		}
+	}
+
+	if e, g := 1, len(r.Diffs); e != g {
+		t.Fatalf("want diffs %d but got %d", e, g)
+	}
+	d := r.Diffs[0]
+	if e, g := "insert N+1", d.Case; e != g {
+		t.Errorf("want case %s but got %s", e, g)
+	}
+	if e, g := "mutation limit (334 rows)", d.Want; e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+	if e, g := "committed (334 rows)", d.Got; e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
+
+func TestRun_Targets(t *testing.T) {
+	if _, err := conformance.Run(context.Background(), nil, []*conformance.Target{{Name: "fake"}}); err == nil {
+		t.Errorf("want err but got nil")
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	cases := []*conformance.Case{
+		{Spec: "s", Case: "a", Outcomes: []*conformance.Outcome{
+			{Target: "spanner", Passed: true, RowCount: 10, MutationCount: 100},
+			{Target: "emulator", Passed: true, RowCount: 10, MutationCount: 90},
+		}},
+		{Spec: "s", Case: "b", WantErr: true, Outcomes: []*conformance.Outcome{
+			{Target: "spanner", Passed: true, RowCount: 11, Err: "too many mutations", ErrKind: conformance.ErrMutationLimit},
+			{Target: "emulator", Passed: false, RowCount: 11},
+		}},
+		{Spec: "s", Case: "c", Outcomes: []*conformance.Outcome{
+			{Target: "spanner", Passed: true, RowCount: 1},
+			{Target: "emulator", Passed: false, Err: "boom", ErrKind: conformance.ErrSetup},
+		}},
+	}
+	r := conformance.NewReport([]string{"spanner", "emulator"}, cases)
+	r.KeyGen = "sequential:1"
+
+	want := []struct {
+		kind conformance.DiffKind
+		want string
+		got  string
+	}{
+		{conformance.CountDiff, "100", "90"},
+		{conformance.OutcomeDiff, "mutation limit (11 rows)", "committed (11 rows)"},
+		{conformance.OutcomeDiff, "committed (1 rows)", "setup failed"},
+	}
+	if e, g := len(want), len(r.Diffs); e != g {
+		t.Fatalf("want diffs %d but got %d", e, g)
+	}
+	for i, w := range want {
+		d := r.Diffs[i]
+		if e, g := w.kind, d.Kind; e != g {
+			t.Errorf("%d: want kind %s but got %s", i, e, g)
+		}
+		if e, g := w.want, d.Want; e != g {
+			t.Errorf("%d: want %s but got %s", i, e, g)
+		}
+		if e, g := w.got, d.Got; e != g {
+			t.Errorf("%d: want %s but got %s", i, e, g)
+		}
+	}
+	s := r.Summaries[0]
+	if e, g := 0, s.Agreed; e != g {
+		t.Errorf("want agreed %d but got %d", e, g)
+	}
+	if e, g := 0.0, s.Agreement(); e != g {
+		t.Errorf("want agreement %v but got %v", e, g)
+	}
+
+	text := r.Text()
+	for _, v := range []string{"reference: spanner", "keygen: sequential:1", "emulator  3", "setup failed"} {
+		if !strings.Contains(text, v) {
+			t.Errorf("want %q in text but got\n%s", v, text)
+		}
+	}
+	md := r.Markdown()
+	if !strings.Contains(md, "| s | b | outcome | emulator | mutation limit (11 rows) | committed (11 rows) |") {
+		t.Errorf("want outcome diff row in markdown but got\n%s", md)
+	}
+}
@@ -0,0 +1,177 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+)
+
+// DiffKind is 食い違いの種類
+type DiffKind string
+
+const (
+	// OutcomeDiff is Case の成否が異なる
+	OutcomeDiff DiffKind = "outcome"
+	// CountDiff is 両方の Target が返した mutation_count が異なる
+	CountDiff DiffKind = "count"
+)
+
+// Diff is 基準の Target と 1 つの Target で食い違った Case
+type Diff struct {
+	Spec   string   `json:"spec"`
+	Case   string   `json:"case"`
+	Kind   DiffKind `json:"kind"`
+	Target string   `json:"target"`
+	// Want is 基準の Target の値
+	Want string `json:"want"`
+	// Got is Target の値
+	Got string `json:"got"`
+}
+
+// Summary is 基準の Target と 1 つの Target の一致の度合い
+type Summary struct {
+	Target string `json:"target"`
+	Cases  int    `json:"cases"`
+	// Agreed is 成否も mutation_count も食い違わなかった Case の数
+	Agreed       int `json:"agreed"`
+	OutcomeDiffs int `json:"outcomeDiffs"`
+	// Counted is 両方の Target が mutation_count を返して比べることができた Case の数
+	Counted    int `json:"counted"`
+	CountDiffs int `json:"countDiffs"`
+}
+
+// Agreement is Agreed の割合 (%)
+func (s *Summary) Agreement() float64 {
+	if s.Cases == 0 {
+		return 0
+	}
+	return float64(s.Agreed) * 100 / float64(s.Cases)
+}
+
+// Report is 複数の Target で同じ Case を実行した結果の比較
+type Report struct {
+	// Reference is 基準の Target. Targets の最初
+	Reference string     `json:"reference"`
+	Targets   []string   `json:"targets"`
+	Summaries []*Summary `json:"summaries"`
+	Diffs     []*Diff    `json:"diffs"`
+	Cases     []*Case    `json:"cases"`
+
+	// KeyGen is 基準の Target の Runner が行の Key を作った Generator. 空の場合は表示しない
+	KeyGen string `json:"keygen,omitempty"`
+}
+
+// NewReport is cases の Outcome を最初の Target と比べて Report を作る. Case の Outcomes は targets の順に並んでいる前提
+func NewReport(targets []string, cases []*Case) *Report {
+	r := &Report{Targets: targets, Cases: cases, Diffs: []*Diff{}}
+	if len(targets) > 0 {
+		r.Reference = targets[0]
+	}
+	for i := 1; i < len(targets); i++ {
+		s := &Summary{Target: targets[i]}
+		for _, c := range cases {
+			if i >= len(c.Outcomes) {
+				continue
+			}
+			want, got := c.Outcomes[0], c.Outcomes[i]
+			s.Cases++
+			agreed := true
+			if want.Passed != got.Passed {
+				agreed = false
+				s.OutcomeDiffs++
+				r.Diffs = append(r.Diffs, &Diff{Spec: c.Spec, Case: c.Case, Kind: OutcomeDiff, Target: got.Target, Want: outcomeString(want), Got: outcomeString(got)})
+			}
+			if want.MutationCount > 0 && got.MutationCount > 0 {
+				s.Counted++
+				if want.MutationCount != got.MutationCount {
+					agreed = false
+					s.CountDiffs++
+					r.Diffs = append(r.Diffs, &Diff{Spec: c.Spec, Case: c.Case, Kind: CountDiff, Target: got.Target, Want: strconv.FormatInt(want.MutationCount, 10), Got: strconv.FormatInt(got.MutationCount, 10)})
+				}
+			}
+			if agreed {
+				s.Agreed++
+			}
+		}
+		r.Summaries = append(r.Summaries, s)
+	}
+	return r
+}
+
+// outcomeString is Outcome で実際に起きたことを Diff に出す文字列にする. 行数が異なる場合に気付けるように行数も付ける
+func outcomeString(o *Outcome) string {
+	switch {
+	case o.ErrKind == ErrSetup:
+		return "setup failed"
+	case o.Err == "":
+		return fmt.Sprintf("committed (%d rows)", o.RowCount)
+	default:
+		return fmt.Sprintf("%s (%d rows)", o.ErrKind, o.RowCount)
+	}
+}
+
+// Text is Summary と Diff を表形式の文字列にする
+func (r *Report) Text() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "reference: %s\n", r.Reference)
+	if r.KeyGen != "" {
+		fmt.Fprintf(&buf, "keygen: %s\n", r.KeyGen)
+	}
+	fmt.Fprintln(&buf)
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tCASES\tAGREED\tAGREEMENT\tOUTCOME DIFFS\tCOUNTED\tCOUNT DIFFS")
+	for _, s := range r.Summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%d\t%d\t%d\n", s.Target, s.Cases, s.Agreed, s.Agreement(), s.OutcomeDiffs, s.Counted, s.CountDiffs)
+	}
+	w.Flush()
+
+	fmt.Fprintln(&buf)
+	if len(r.Diffs) == 0 {
+		fmt.Fprintln(&buf, "no diffs")
+		return buf.String()
+	}
+	w = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SPEC\tCASE\tKIND\tTARGET\tWANT\tGOT")
+	for _, d := range r.Diffs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Spec, d.Case, d.Kind, d.Target, d.Want, d.Got)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// JSON is Report を indent した JSON にする. すべての Case の Outcome を含む
+func (r *Report) JSON() (string, error) {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// Markdown is Summary と Diff を Issue や設計 Doc に貼り付けられる Markdown の表にする
+func (r *Report) Markdown() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "### Conformance (reference: %s)\n\n", r.Reference)
+	if r.KeyGen != "" {
+		fmt.Fprintf(&buf, "keygen: `%s`\n\n", r.KeyGen)
+	}
+	fmt.Fprintln(&buf, "| Target | Cases | Agreed | Agreement | Outcome diffs | Counted | Count diffs |")
+	fmt.Fprintln(&buf, "|---|---:|---:|---:|---:|---:|---:|")
+	for _, s := range r.Summaries {
+		fmt.Fprintf(&buf, "| %s | %d | %d | %.1f%% | %d | %d | %d |\n", s.Target, s.Cases, s.Agreed, s.Agreement(), s.OutcomeDiffs, s.Counted, s.CountDiffs)
+	}
+
+	fmt.Fprintln(&buf)
+	if len(r.Diffs) == 0 {
+		fmt.Fprintln(&buf, "No diffs.")
+		return buf.String()
+	}
+	fmt.Fprintln(&buf, "| Spec | Case | Kind | Target | Want | Got |")
+	fmt.Fprintln(&buf, "|---|---|---|---|---|---|")
+	for _, d := range r.Diffs {
+		fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s | %s |\n", d.Spec, d.Case, d.Kind, d.Target, d.Want, d.Got)
+	}
+	return buf.String()
+}
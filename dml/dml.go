@@ -0,0 +1,409 @@
+// Package dml is Mutation 数の見積もりや Fake Server で扱う単純な DML を Parse する
+//
+// サポートしているのは以下の形だけで、Spanner の SQL をすべて扱えるわけではない
+//
+//	UPDATE table SET column = value, ... WHERE condition [AND condition ...]
+//	SELECT column, ... FROM table [WHERE condition [AND condition ...]]
+//
+// condition は column = value か STARTS_WITH(column, value) で、value は文字列, 数値, BOOL, NULL, 配列, @param のいずれか
+// それ以外の condition は "unsupported predicate" の error になる
+//
+// Mutation 数の見積もりは Table と SET の Column だけで決まるので、ParseUpdateTarget は SET の値と WHERE 句に任意の式を書ける
+//
+//	UPDATE table [[AS] alias] SET column = expression, ... WHERE expression
+package dml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Update is UPDATE Statement
+type Update struct {
+	Table string
+	Set   []*Assignment
+	Where []*Condition
+}
+
+// Target is UPDATE Statement が更新する Table と SET の Column
+type Target struct {
+	Table   string
+	Columns []string
+
+	// where is WHERE の後の token
+	where []*token
+}
+
+// Select is SELECT Statement
+type Select struct {
+	Columns []string
+	Table   string
+	Where   []*Condition
+}
+
+// Assignment is SET 句の column = value
+type Assignment struct {
+	Column string
+	Value  Value
+}
+
+// Condition is WHERE 句の条件の 1 つ
+type Condition struct {
+	Column string
+	Op     CondOp
+	Value  Value
+}
+
+// CondOp is Condition の比較の種類
+type CondOp int
+
+const (
+	// Equal is column = value
+	Equal CondOp = iota
+	// StartsWith is STARTS_WITH(column, value)
+	StartsWith
+)
+
+// Value is SQL に書かれた値
+// Literal には string, int64, float64, bool, nil, []interface{} のいずれかが入る
+// @param の場合は Param に名前が入る
+type Value struct {
+	Literal interface{}
+	Param   string
+}
+
+// ParseUpdate is UPDATE Statement を Parse する
+func ParseUpdate(sql string) (*Update, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("UPDATE"); err != nil {
+		return nil, err
+	}
+	u := &Update{}
+	if u.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		u.Set = append(u.Set, &Assignment{Column: col, Value: v})
+		if !p.eat(",") {
+			break
+		}
+	}
+	if err := p.expectKeyword("WHERE"); err != nil {
+		return nil, err
+	}
+	if u.Where, err = p.where(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// ParseUpdateTarget is UPDATE Statement の Table と SET の Column だけを Parse する
+// SET の値と WHERE 句は式の中身を見ないので、Column の参照や関数、IS NULL などの条件を書ける
+func ParseUpdateTarget(sql string) (*Target, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("UPDATE"); err != nil {
+		return nil, err
+	}
+	t := &Target{}
+	if t.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if !p.eatKeyword("SET") {
+		p.eatKeyword("AS")
+		if _, err := p.ident(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("SET"); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		// alias.column
+		if p.eat(".") {
+			if col, err = p.ident(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		if err := p.skipExpression(); err != nil {
+			return nil, err
+		}
+		t.Columns = append(t.Columns, col)
+		if !p.eat(",") {
+			break
+		}
+	}
+	if err := p.expectKeyword("WHERE"); err != nil {
+		return nil, err
+	}
+	if p.done() {
+		return nil, p.errorf("want condition")
+	}
+	t.where = p.tokens[p.pos:]
+	return t, nil
+}
+
+// Where is WHERE 句を Condition として Parse する. 対象の行を数える時に使う
+// 扱えない条件の場合は "unsupported predicate" の error を返す
+func (t *Target) Where() ([]*Condition, error) {
+	p := &parser{tokens: t.where}
+	return p.where()
+}
+
+// skipExpression is SET の値の式を読み飛ばす. 括弧の外の , か WHERE までを 1 つの式とする
+func (p *parser) skipExpression() error {
+	start := p.pos
+	var depth int
+loop:
+	for ; !p.done(); p.pos++ {
+		t := p.tokens[p.pos]
+		switch {
+		case depth == 0 && t.kind == tokenIdent && strings.EqualFold(t.text, "WHERE"):
+			break loop
+		case t.kind != tokenSymbol:
+		case t.text == "(" || t.text == "[":
+			depth++
+		case t.text == ")" || t.text == "]":
+			if depth == 0 {
+				return p.errorf("unbalanced %s", t.text)
+			}
+			depth--
+		case depth == 0 && t.text == ",":
+			break loop
+		}
+	}
+	if p.pos == start {
+		return p.errorf("want value")
+	}
+	if depth > 0 {
+		return p.errorf("unbalanced parentheses")
+	}
+	return nil
+}
+
+// ParseSelect is SELECT Statement を Parse する. SELECT する Column には Column の名前だけを書ける
+func ParseSelect(sql string) (*Select, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	s := &Select{}
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		s.Columns = append(s.Columns, col)
+		if !p.eat(",") {
+			break
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if s.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if p.eatKeyword("WHERE") {
+		if s.Where, err = p.where(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected token")
+	}
+	return s, nil
+}
+
+// where is WHERE の後の条件を最後まで Parse する. 扱えない条件の場合は "unsupported predicate" の error を返す
+func (p *parser) where() ([]*Condition, error) {
+	list, err := p.conditions()
+	if err == nil && !p.done() {
+		err = p.errorf("unexpected token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unsupported predicate: %v", err)
+	}
+	return list, nil
+}
+
+// conditions is WHERE の後の AND で繋がれた条件を Parse する
+func (p *parser) conditions() ([]*Condition, error) {
+	var list []*Condition
+	for {
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+		if !p.eatKeyword("AND") {
+			break
+		}
+	}
+	return list, nil
+}
+
+func (p *parser) condition() (*Condition, error) {
+	if p.eatKeyword("STARTS_WITH") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &Condition{Column: col, Op: StartsWith, Value: v}, nil
+	}
+	col, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return &Condition{Column: col, Op: Equal, Value: v}, nil
+}
+
+// value is リテラルか @param を Parse する
+func (p *parser) value() (Value, error) {
+	t := p.next()
+	if t == nil {
+		return Value{}, p.errorf("want value")
+	}
+	switch {
+	case t.kind == tokenString:
+		return Value{Literal: t.text}, nil
+	case t.kind == tokenParam:
+		return Value{Param: t.text}, nil
+	case t.kind == tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return Value{Literal: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid number %s", t.text)
+		}
+		return Value{Literal: f}, nil
+	case t.text == "[":
+		list := []interface{}{}
+		for !p.eat("]") {
+			v, err := p.value()
+			if err != nil {
+				return Value{}, err
+			}
+			if v.Param != "" {
+				return Value{}, p.errorf("param in array is not supported")
+			}
+			list = append(list, v.Literal)
+			if !p.eat(",") {
+				if err := p.expect("]"); err != nil {
+					return Value{}, err
+				}
+				break
+			}
+		}
+		return Value{Literal: list}, nil
+	case strings.EqualFold(t.text, "TRUE"):
+		return Value{Literal: true}, nil
+	case strings.EqualFold(t.text, "FALSE"):
+		return Value{Literal: false}, nil
+	case strings.EqualFold(t.text, "NULL"):
+		return Value{Literal: nil}, nil
+	default:
+		p.pos--
+		return Value{}, p.errorf("want value")
+	}
+}
+
+// String is Condition を SQL の形にする
+func (c *Condition) String() string {
+	if c.Op == StartsWith {
+		return fmt.Sprintf("STARTS_WITH(`%s`, %s)", c.Column, c.Value)
+	}
+	return fmt.Sprintf("`%s` = %s", c.Column, c.Value)
+}
+
+// Where is conditions を WHERE 句の AND で繋がれた条件の SQL にする
+func Where(conditions []*Condition) string {
+	list := make([]string, len(conditions))
+	for i, c := range conditions {
+		list[i] = c.String()
+	}
+	return strings.Join(list, " AND ")
+}
+
+// String is Value を SQL のリテラルか @param の形にする
+func (v Value) String() string {
+	if v.Param != "" {
+		return "@" + v.Param
+	}
+	return literalString(v.Literal)
+}
+
+func literalString(l interface{}) string {
+	switch v := l.(type) {
+	case string:
+		return strconv.Quote(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case []interface{}:
+		list := make([]string, len(v))
+		for i, e := range v {
+			list[i] = literalString(e)
+		}
+		return "[" + strings.Join(list, ", ") + "]"
+	default:
+		return "NULL"
+	}
+}
@@ -0,0 +1,224 @@
+package dml_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/dml"
+)
+
+func TestParseUpdate(t *testing.T) {
+	// measure_test.go の createUpdateDML が作る DML
+	sql := `UPDATE Measure SET Arr1 = [],CommitedAt = "2019-01-01 10:00:00",Col1 = "",Col2 = "",withIndex1 = "" WHERE Mark = "hoge"`
+	u, err := dml.ParseUpdate(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "Measure", u.Table; e != g {
+		t.Errorf("want table %s but got %s", e, g)
+	}
+	want := []*dml.Assignment{
+		{Column: "Arr1", Value: dml.Value{Literal: []interface{}{}}},
+		{Column: "CommitedAt", Value: dml.Value{Literal: "2019-01-01 10:00:00"}},
+		{Column: "Col1", Value: dml.Value{Literal: ""}},
+		{Column: "Col2", Value: dml.Value{Literal: ""}},
+		{Column: "withIndex1", Value: dml.Value{Literal: ""}},
+	}
+	if !reflect.DeepEqual(want, u.Set) {
+		t.Errorf("unexpected set %+v", u.Set)
+	}
+	wantWhere := []*dml.Condition{{Column: "Mark", Op: dml.Equal, Value: dml.Value{Literal: "hoge"}}}
+	if !reflect.DeepEqual(wantWhere, u.Where) {
+		t.Errorf("unexpected where %+v", u.Where)
+	}
+}
+
+func TestParseUpdate_Values(t *testing.T) {
+	sql := `update T set A = 1, B = -1.5, C = true, D = NULL, E = ['a', "b"], F = @p1 where STARTS_WITH(Mark, @mark) AND ID = 'x\'y'`
+	u, err := dml.ParseUpdate(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int64(1), -1.5, true, nil, []interface{}{"a", "b"}}
+	for i, w := range want {
+		if g := u.Set[i].Value.Literal; !reflect.DeepEqual(w, g) {
+			t.Errorf("set[%d] want %#v but got %#v", i, w, g)
+		}
+	}
+	if e, g := "p1", u.Set[5].Value.Param; e != g {
+		t.Errorf("want param %s but got %s", e, g)
+	}
+	if e, g := dml.StartsWith, u.Where[0].Op; e != g {
+		t.Errorf("want op %v but got %v", e, g)
+	}
+	if e, g := "mark", u.Where[0].Value.Param; e != g {
+		t.Errorf("want param %s but got %s", e, g)
+	}
+	if e, g := "x'y", u.Where[1].Value.Literal; e != g {
+		t.Errorf("want %v but got %v", e, g)
+	}
+}
+
+func TestParseUpdate_Error(t *testing.T) {
+	cases := []string{
+		`DELETE FROM Measure WHERE true`,
+		`UPDATE Measure SET Col1 = ""`,
+		`UPDATE Measure SET Col1 = "" WHERE Mark > "a"`,
+		`UPDATE Measure SET Col1 = "abc WHERE Mark = "a"`,
+		`UPDATE Measure SET Col1 = "" WHERE Mark = "a" LIMIT 1`,
+	}
+	for _, sql := range cases {
+		if _, err := dml.ParseUpdate(sql); err == nil {
+			t.Errorf("want err but got err is nil. sql=%s", sql)
+		}
+	}
+}
+
+func TestParseUpdateTarget(t *testing.T) {
+	cases := []struct {
+		name        string
+		sql         string
+		wantTable   string
+		wantColumns []string
+	}{
+		{"literal", `UPDATE Measure SET Col1 = "", Col2 = @p WHERE Mark = @mark`, "Measure", []string{"Col1", "Col2"}},
+		{"is null", `UPDATE Measure SET Col1 = "" WHERE Col1 IS NULL`, "Measure", []string{"Col1"}},
+		{"where true", `UPDATE Measure SET Col1 = "" WHERE TRUE`, "Measure", []string{"Col1"}},
+		{"column", `UPDATE Measure SET Col1 = Col2 WHERE Col1 IS NULL`, "Measure", []string{"Col1"}},
+		{"function", `UPDATE Measure SET Col1 = CONCAT(Col2, ",", Col3), Arr1 = ARRAY_CONCAT(Arr1, [1, 2]) WHERE ID IN (SELECT ID FROM Measure WHERE Col2 > "a")`, "Measure", []string{"Col1", "Arr1"}},
+		{"subquery", `UPDATE Measure SET Col1 = (SELECT Col2 FROM Other WHERE Other.ID = Measure.ID) WHERE TRUE`, "Measure", []string{"Col1"}},
+		{"alias", `UPDATE Measure AS m SET m.Col1 = m.Col2 WHERE m.Col1 IS NULL`, "Measure", []string{"Col1"}},
+		{"alias without as", "update `Measure` m set m.Col1 = 1 where true", "Measure", []string{"Col1"}},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := dml.ParseUpdateTarget(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantTable, u.Table; e != g {
+				t.Errorf("want table %s but got %s", e, g)
+			}
+			if !reflect.DeepEqual(tt.wantColumns, u.Columns) {
+				t.Errorf("want columns %v but got %v", tt.wantColumns, u.Columns)
+			}
+		})
+	}
+}
+
+func TestParseUpdateTarget_Error(t *testing.T) {
+	cases := []string{
+		`DELETE FROM Measure WHERE true`,
+		`UPDATE Measure SET Col1 = ""`,
+		`UPDATE Measure SET Col1 = "" WHERE`,
+		`UPDATE Measure SET Col1 = WHERE true`,
+		`UPDATE Measure SET Col1 = CONCAT(Col2 WHERE true`,
+		`UPDATE Measure SET Col1 = Col2) WHERE true`,
+		`UPDATE Measure SET WHERE true`,
+	}
+	for _, sql := range cases {
+		if _, err := dml.ParseUpdateTarget(sql); err == nil {
+			t.Errorf("want err but got err is nil. sql=%s", sql)
+		}
+	}
+}
+
+func TestTarget_Where(t *testing.T) {
+	cases := []struct {
+		name    string
+		sql     string
+		want    []*dml.Condition
+		wantErr bool
+	}{
+		{"equal", `UPDATE Measure SET Col1 = Col2 WHERE Mark = @mark`, []*dml.Condition{{Column: "Mark", Op: dml.Equal, Value: dml.Value{Param: "mark"}}}, false},
+		{"is null", `UPDATE Measure SET Col1 = "" WHERE Col1 IS NULL`, nil, true},
+		{"where true", `UPDATE Measure SET Col1 = "" WHERE TRUE`, nil, true},
+		{"or", `UPDATE Measure SET Col1 = "" WHERE Mark = "a" OR Mark = "b"`, nil, true},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := dml.ParseUpdateTarget(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			where, err := u.Where()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "unsupported predicate") {
+					t.Errorf("want unsupported predicate but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.want, where) {
+				t.Errorf("unexpected where %+v", where)
+			}
+		})
+	}
+}
+
+func TestParseSelect(t *testing.T) {
+	cases := []struct {
+		name        string
+		sql         string
+		wantColumns []string
+		wantWhere   []*dml.Condition
+	}{
+		{"no where", `SELECT ID FROM Measure`, []string{"ID"}, nil},
+		{"starts with", `SELECT ID, ChildID FROM MeasureChild WHERE STARTS_WITH(Mark, @mark)`, []string{"ID", "ChildID"}, []*dml.Condition{{Column: "Mark", Op: dml.StartsWith, Value: dml.Value{Param: "mark"}}}},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := dml.ParseSelect(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.wantColumns, s.Columns) {
+				t.Errorf("want columns %v but got %v", tt.wantColumns, s.Columns)
+			}
+			if !reflect.DeepEqual(tt.wantWhere, s.Where) {
+				t.Errorf("unexpected where %+v", s.Where)
+			}
+		})
+	}
+}
+
+func TestParseSelect_Error(t *testing.T) {
+	cases := []string{
+		`SELECT * FROM Measure`,
+		`SELECT ID Measure`,
+		`SELECT ID FROM Measure WHERE`,
+		`SELECT ID FROM Measure ORDER BY ID`,
+	}
+	for _, sql := range cases {
+		if _, err := dml.ParseSelect(sql); err == nil {
+			t.Errorf("want err but got err is nil. sql=%s", sql)
+		}
+	}
+}
+
+func TestWhere(t *testing.T) {
+	sql := `UPDATE T SET A = 1 WHERE STARTS_WITH(Mark, @mark) AND ID = 'x"y' AND N = -1.5 AND B = true AND Arr = ['a', 1] AND C = NULL`
+	u, err := dml.ParseUpdate(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "STARTS_WITH(`Mark`, @mark) AND `ID` = \"x\\\"y\" AND `N` = -1.5 AND `B` = TRUE AND `Arr` = [\"a\", 1] AND `C` = NULL"
+	if e, g := want, dml.Where(u.Where); e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+
+	// Where の結果は Parse し直すと同じ条件になる
+	s, err := dml.ParseSelect("SELECT ID FROM T WHERE " + dml.Where(u.Where))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(u.Where, s.Where) {
+		t.Errorf("want %+v but got %+v", u.Where, s.Where)
+	}
+}
@@ -0,0 +1,173 @@
+package dml
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenParam
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+type parser struct {
+	sql    string
+	tokens []*token
+	pos    int
+}
+
+func newParser(sql string) (*parser, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{sql: sql, tokens: tokens}, nil
+}
+
+// tokenize is SQL を token に分割する
+func tokenize(s string) ([]*token, error) {
+	var tokens []*token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			v, n, err := readString(s[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, &token{kind: tokenString, text: v})
+			i += n
+		case c == '`':
+			j := strings.IndexByte(s[i+1:], '`')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated quoted identifier")
+			}
+			tokens = append(tokens, &token{kind: tokenIdent, text: s[i+1 : i+1+j]})
+			i += j + 2
+		case c == '@':
+			j := i + 1
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, &token{kind: tokenParam, text: s[i+1 : j]})
+			i = j
+		case ('0' <= c && c <= '9') || (c == '-' && i+1 < len(s) && '0' <= s[i+1] && s[i+1] <= '9'):
+			j := i + 1
+			for j < len(s) && (('0' <= s[j] && s[j] <= '9') || s[j] == '.' || s[j] == 'e' || s[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, &token{kind: tokenNumber, text: s[i:j]})
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, &token{kind: tokenIdent, text: s[i:j]})
+			i = j
+		default:
+			tokens = append(tokens, &token{kind: tokenSymbol, text: string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// readString is 先頭の文字列リテラルを読み取り、値と読み進めた byte 数を返す
+func readString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(s[i])
+			}
+		case c == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string literal")
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) next() *token {
+	if p.done() {
+		return nil
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.done() {
+		return fmt.Errorf("unexpected end of sql: %s", msg)
+	}
+	return fmt.Errorf("near %q: %s", p.tokens[p.pos].text, msg)
+}
+
+func (p *parser) eat(want string) bool {
+	if p.done() || p.tokens[p.pos].kind != tokenSymbol || p.tokens[p.pos].text != want {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) expect(want string) error {
+	if !p.eat(want) {
+		return p.errorf("want %s", want)
+	}
+	return nil
+}
+
+func (p *parser) eatKeyword(keyword string) bool {
+	if p.done() || p.tokens[p.pos].kind != tokenIdent || !strings.EqualFold(p.tokens[p.pos].text, keyword) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.eatKeyword(keyword) {
+		return p.errorf("want %s", keyword)
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	if p.done() || p.tokens[p.pos].kind != tokenIdent {
+		return "", p.errorf("want identifier")
+	}
+	return p.next().text, nil
+}
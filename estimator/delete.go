@@ -0,0 +1,94 @@
+package estimator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// DeleteTarget is 親の Table の行を削除した時に影響を受ける子孫の Table
+type DeleteTarget struct {
+	Table *schema.Table
+	// Parent is Table の Interleave の親
+	Parent *schema.Table
+	// Cascade is 親の行と一緒に ON DELETE CASCADE で削除されるかどうか
+	// false の場合は ON DELETE NO ACTION なので、親の行を削除する前に明示的に削除する必要がある
+	Cascade bool
+	// Depth is 削除する Table から数えた階層. 子が 1, 孫が 2
+	Depth int
+}
+
+// DeleteTree is table の行を削除した時に影響を受ける子孫の Table を親から順に返す
+// CASCADE で繋がっている子孫は一緒に削除されるので、その子孫もたどる
+// NO ACTION の子は明示的に削除する必要があり、その子孫は子を削除する時に数えるので、たどらない
+func DeleteTree(s *schema.Schema, table string) ([]*DeleteTarget, error) {
+	t := s.Table(table)
+	if t == nil {
+		return nil, fmt.Errorf("table %s is not found in schema", table)
+	}
+	return deleteTree(s, t, 1), nil
+}
+
+func deleteTree(s *schema.Schema, parent *schema.Table, depth int) []*DeleteTarget {
+	var list []*DeleteTarget
+	for _, child := range s.Tables {
+		if child.Interleave == nil || !strings.EqualFold(child.Interleave.Parent, parent.Name) {
+			continue
+		}
+		cascade := child.Interleave.OnDelete == schema.Cascade
+		list = append(list, &DeleteTarget{Table: child, Parent: parent, Cascade: cascade, Depth: depth})
+		if cascade {
+			list = append(list, deleteTree(s, child, depth+1)...)
+		}
+	}
+	return list
+}
+
+// ChildDelete is NO ACTION の子の Table の Delete が同じ Commit に無い、親の Table の Delete
+type ChildDelete struct {
+	// Parent is Delete している Table
+	Parent string
+	// Child is 明示的に削除する必要がある NO ACTION の子の Table
+	Child string
+}
+
+func (d *ChildDelete) String() string {
+	return fmt.Sprintf("%s has ON DELETE NO ACTION child %s", d.Parent, d.Child)
+}
+
+// MissingChildDeletes is ms に含まれる Delete のうち、NO ACTION の子の Table の Delete が ms に無いものを返す
+// 子の行が残っていると Spanner は Commit を FailedPrecondition で失敗させる
+// 子の行が無い場合は成功するので、返ってきたものが必ず失敗するとは限らない
+func MissingChildDeletes(s *schema.Schema, ms []*Mutation) ([]*ChildDelete, error) {
+	deleted := make(map[string]bool)
+	for _, m := range ms {
+		if m.Op == OpDelete {
+			deleted[strings.ToLower(m.Table)] = true
+		}
+	}
+
+	var list []*ChildDelete
+	seen := make(map[ChildDelete]bool)
+	for _, m := range ms {
+		if m.Op != OpDelete {
+			continue
+		}
+		tree, err := DeleteTree(s, m.Table)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range tree {
+			if d.Cascade || deleted[strings.ToLower(d.Table.Name)] {
+				continue
+			}
+			v := ChildDelete{Parent: d.Parent.Name, Child: d.Table.Name}
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			list = append(list, &v)
+		}
+	}
+	return list, nil
+}
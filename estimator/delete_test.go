@@ -0,0 +1,250 @@
+package estimator_test
+
+import (
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// multiLevelDDL is 3 階層の CASCADE と、途中に NO ACTION を含む Schema
+//
+//	Singer
+//	├── Album (CASCADE, Index 1)
+//	│   └── Song (CASCADE, Index 2)
+//	│       └── Lyric (NO ACTION)
+//	└── Concert (NO ACTION)
+//	    └── Ticket (CASCADE, Index 1)
+const multiLevelDDL = `
+CREATE TABLE Singer (
+    SingerID STRING(MAX) NOT NULL,
+    Name STRING(MAX),
+) PRIMARY KEY (SingerID);
+
+CREATE INDEX SingerByName ON Singer (Name);
+
+CREATE TABLE Album (
+    SingerID STRING(MAX) NOT NULL,
+    AlbumID STRING(MAX) NOT NULL,
+    Title STRING(MAX),
+) PRIMARY KEY (SingerID, AlbumID),
+  INTERLEAVE IN PARENT Singer ON DELETE CASCADE;
+
+CREATE INDEX AlbumByTitle ON Album (Title);
+
+CREATE TABLE Song (
+    SingerID STRING(MAX) NOT NULL,
+    AlbumID STRING(MAX) NOT NULL,
+    SongID STRING(MAX) NOT NULL,
+    Title STRING(MAX),
+    Length INT64,
+) PRIMARY KEY (SingerID, AlbumID, SongID),
+  INTERLEAVE IN PARENT Album ON DELETE CASCADE;
+
+CREATE INDEX SongByTitle ON Song (Title);
+
+CREATE INDEX SongByLength ON Song (Length DESC);
+
+CREATE TABLE Lyric (
+    SingerID STRING(MAX) NOT NULL,
+    AlbumID STRING(MAX) NOT NULL,
+    SongID STRING(MAX) NOT NULL,
+    LyricID STRING(MAX) NOT NULL,
+) PRIMARY KEY (SingerID, AlbumID, SongID, LyricID),
+  INTERLEAVE IN PARENT Song ON DELETE NO ACTION;
+
+CREATE TABLE Concert (
+    SingerID STRING(MAX) NOT NULL,
+    ConcertID STRING(MAX) NOT NULL,
+) PRIMARY KEY (SingerID, ConcertID),
+  INTERLEAVE IN PARENT Singer ON DELETE NO ACTION;
+
+CREATE TABLE Ticket (
+    SingerID STRING(MAX) NOT NULL,
+    ConcertID STRING(MAX) NOT NULL,
+    TicketID STRING(MAX) NOT NULL,
+    Seat STRING(MAX),
+) PRIMARY KEY (SingerID, ConcertID, TicketID),
+  INTERLEAVE IN PARENT Concert ON DELETE CASCADE;
+
+CREATE INDEX TicketBySeat ON Ticket (Seat);
+`
+
+func multiLevelSchema(t *testing.T) *schema.Schema {
+	s, err := schema.Parse(multiLevelDDL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDeleteTree(t *testing.T) {
+	s := multiLevelSchema(t)
+
+	cases := []struct {
+		table string
+		want  string
+	}{
+		{"Singer", "[Album(1,cascade) Song(2,cascade) Lyric(3,no action) Concert(1,no action)]"},
+		{"Song", "[Lyric(1,no action)]"},
+		{"Concert", "[Ticket(1,cascade)]"},
+		{"Lyric", "[]"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.table, func(t *testing.T) {
+			tree, err := estimator.DeleteTree(s, tt.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range tree {
+				onDelete := "no action"
+				if d.Cascade {
+					onDelete = "cascade"
+				}
+				got = append(got, fmt.Sprintf("%s(%d,%s)", d.Table.Name, d.Depth, onDelete))
+			}
+			if e, g := tt.want, fmt.Sprint(got); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+
+	if _, err := estimator.DeleteTree(s, "Hoge"); err == nil {
+		t.Errorf("want err but got err is nil")
+	}
+}
+
+func TestCount_Delete(t *testing.T) {
+	s := multiLevelSchema(t)
+	measure := measureSchema(t)
+
+	key := spanner.Key{"a"}
+	keyRange := spanner.KeyRange{Start: spanner.Key{"a"}, End: spanner.Key{"b"}, Kind: spanner.ClosedOpen}
+
+	cases := []struct {
+		name   string
+		schema *schema.Schema
+		ms     []*spanner.Mutation
+		want   int
+	}{
+		// [1:Singer, 2:SingerByName, 3:AlbumByTitle, 4:SongByTitle, 5:SongByLength]. Concert は NO ACTION なので数えない
+		{"multi level cascade", s, []*spanner.Mutation{spanner.Delete("Singer", key)}, 5},
+		// [1:Concert, 2:TicketBySeat]
+		{"cascade under no action", s, []*spanner.Mutation{spanner.Delete("Concert", spanner.Key{"a", "c"})}, 2},
+		// 明示的に削除した NO ACTION の子は、子の Table の Delete として数える
+		{"explicit no action child", s, []*spanner.Mutation{
+			spanner.Delete("Concert", spanner.Key{"a", "c"}),
+			spanner.Delete("Singer", key),
+		}, 7},
+		// KeyRange は範囲に含まれる行の数によらず 1 つとして数える [1:Measure, 2:MeasureWithIndex1_1, 3:MeasureWithIndex2_1, 4:MeasureWithIndex2_2]
+		{"key range", measure, []*spanner.Mutation{spanner.Delete("Measure", keyRange)}, 4},
+		{"all keys", measure, []*spanner.Mutation{spanner.Delete("Measure", spanner.AllKeys())}, 4},
+		{"key sets", measure, []*spanner.Mutation{spanner.Delete("Measure", spanner.KeySets(spanner.Key{"a"}, spanner.Key{"b"}, keyRange))}, 12},
+		{"multi level key range", s, []*spanner.Mutation{spanner.Delete("Singer", keyRange)}, 5},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := estimator.Count(tt.schema, tt.ms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != g {
+				t.Errorf("want %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+// TestMeasureInterleaveNoCascade_Delete is measure_interleave_no_cascade_test.go の TestMeasureInterleaveNoCascade_Delete の期待値を見積もりで再現する
+func TestMeasureInterleaveNoCascade_Delete(t *testing.T) {
+	s, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		rowCount int
+		wantErr  bool
+	}{
+		// [1:MeasureParentNoCascade Table ,2:MeasureChildNoCascade Table]で、 2 になる
+		{"empty : 7-10000", 10000, false},
+		{"empty : 7-10001", 10001, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var children, parents []*spanner.Mutation
+			for i := 0; i < tt.rowCount; i++ {
+				id := fmt.Sprintf("p%d", i)
+				children = append(children, spanner.Delete("MeasureChildNoCascade", spanner.Key{id, "c"}))
+				parents = append(parents, spanner.Delete("MeasureParentNoCascade", spanner.Key{id}))
+			}
+			ms := append(children, parents...)
+			got, err := estimator.Count(s, ms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantErr, got > estimator.DefaultLimit; e != g {
+				t.Errorf("want over limit %v but got %v. count=%d", e, g, got)
+			}
+
+			list, err := estimator.FromSpannerAll(ms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			missing, err := estimator.MissingChildDeletes(s, list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(missing) > 0 {
+				t.Errorf("unexpected missing child deletes %v", missing)
+			}
+		})
+	}
+}
+
+func TestMissingChildDeletes(t *testing.T) {
+	s := multiLevelSchema(t)
+
+	cases := []struct {
+		name string
+		ms   []*spanner.Mutation
+		want string
+	}{
+		{"no delete", []*spanner.Mutation{spanner.InsertMap("Singer", map[string]interface{}{"SingerID": "a"})}, "[]"},
+		{"parent only", []*spanner.Mutation{spanner.Delete("Singer", spanner.Key{"a"}), spanner.Delete("Singer", spanner.Key{"b"})},
+			"[Song has ON DELETE NO ACTION child Lyric Singer has ON DELETE NO ACTION child Concert]"},
+		{"with child", []*spanner.Mutation{
+			spanner.Delete("Lyric", spanner.AllKeys()),
+			spanner.Delete("Concert", spanner.Key{"a", "c"}),
+			spanner.Delete("Singer", spanner.Key{"a"}),
+		}, "[]"},
+		{"cascade only", []*spanner.Mutation{spanner.Delete("Concert", spanner.Key{"a", "c"})}, "[]"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := estimator.FromSpannerAll(tt.ms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := estimator.MissingChildDeletes(s, list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, fmt.Sprint(got); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
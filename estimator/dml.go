@@ -0,0 +1,143 @@
+package estimator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/dml"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"google.golang.org/api/iterator"
+)
+
+// DMLMutation is DML の UPDATE が 1 行ごとに作る Update Mutation を返す
+// DML も UpdateMap と同じく Primary Key と SET の Column を書き込んだものとして数えられる (measure_test.go TestUpdateDML)
+// Mutation 数は Table と SET の Column だけで決まるので、SET の値と WHERE 句にはどんな式を書いてもよい
+func DMLMutation(s *schema.Schema, sql string) (*Mutation, error) {
+	u, err := dml.ParseUpdateTarget(sql)
+	if err != nil {
+		return nil, err
+	}
+	t := s.Table(u.Table)
+	if t == nil {
+		return nil, fmt.Errorf("table %s is not found in schema", u.Table)
+	}
+	m := &Mutation{Op: OpUpdate, Table: t.Name}
+	for _, k := range t.PrimaryKey {
+		m.Columns = append(m.Columns, k.Column)
+	}
+	for _, c := range u.Columns {
+		col := t.Column(c)
+		if col == nil {
+			return nil, fmt.Errorf("column %s is not found in table %s", c, t.Name)
+		}
+		if t.IsKeyColumn(col.Name) {
+			return nil, fmt.Errorf("column %s is primary key of %s and can not be updated", col.Name, t.Name)
+		}
+		m.Columns = append(m.Columns, col.Name)
+	}
+	return m, nil
+}
+
+// DMLEstimate is DML の UPDATE の Mutation 数の見積もり
+type DMLEstimate struct {
+	Table string
+	// Rows is 更新する行数
+	Rows int
+	// PerRow is 1 行の Mutation 数
+	PerRow int
+	// Total is Rows 行を 1 つの Transaction で更新した時の Mutation 数
+	Total int
+	Limit int
+	// MaxRows is 1 つの Transaction で更新できる最大の行数
+	MaxRows int
+}
+
+// FitsInTransaction is 1 つの Transaction で実行できるかどうか. false の場合は Partitioned DML を使う
+func (e *DMLEstimate) FitsInTransaction() bool {
+	return e.Total <= e.Limit
+}
+
+func (e *DMLEstimate) String() string {
+	if e.FitsInTransaction() {
+		return fmt.Sprintf("%s: %d rows * %d = %d mutations, fits in one transaction (limit %d, max %d rows)", e.Table, e.Rows, e.PerRow, e.Total, e.Limit, e.MaxRows)
+	}
+	return fmt.Sprintf("%s: %d rows * %d = %d mutations, over the limit %d (max %d rows). use Partitioned DML", e.Table, e.Rows, e.PerRow, e.Total, e.Limit, e.MaxRows)
+}
+
+// EstimateDML is rows 行を更新する DML の UPDATE の Mutation 数を見積もる. limit が 0 の場合は DefaultLimit を使う
+func EstimateDML(s *schema.Schema, sql string, rows, limit int) (*DMLEstimate, error) {
+	m, err := DMLMutation(s, sql)
+	if err != nil {
+		return nil, err
+	}
+	perRow, err := CountMutation(s, m)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &DMLEstimate{
+		Table:   m.Table,
+		Rows:    rows,
+		PerRow:  perRow,
+		Total:   perRow * rows,
+		Limit:   limit,
+		MaxRows: limit / perRow,
+	}, nil
+}
+
+// ExplainDML is rows 行を更新する DML の UPDATE の Mutation 数の内訳を返す
+func ExplainDML(s *schema.Schema, sql string, rows int) (*Explanation, error) {
+	m, err := DMLMutation(s, sql)
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]*Mutation, rows)
+	for i := range ms {
+		ms[i] = m
+	}
+	return ExplainMutations(s, ms)
+}
+
+// AffectedRows is DML の UPDATE が更新する行数を、同じ WHERE 句の SELECT で数える
+// fakespanner でも実行できるように、COUNT(*) ではなく Primary Key を SELECT して数える
+// WHERE 句は dml で扱える条件だけを書ける. それ以外の場合は "unsupported predicate" の error を返す
+func AffectedRows(ctx context.Context, client *spanner.Client, s *schema.Schema, stmt spanner.Statement) (int, error) {
+	u, err := dml.ParseUpdateTarget(stmt.SQL)
+	if err != nil {
+		return 0, err
+	}
+	where, err := u.Where()
+	if err != nil {
+		return 0, err
+	}
+	t := s.Table(u.Table)
+	if t == nil {
+		return 0, fmt.Errorf("table %s is not found in schema", u.Table)
+	}
+	columns := make([]string, len(t.PrimaryKey))
+	for i, k := range t.PrimaryKey {
+		columns[i] = k.Column
+	}
+	q := spanner.Statement{
+		SQL:    fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(columns, ", "), t.Name, dml.Where(where)),
+		Params: stmt.Params,
+	}
+
+	var n int
+	iter := client.Single().Query(ctx, q)
+	defer iter.Stop()
+	for {
+		_, err := iter.Next()
+		if err == iterator.Done {
+			return n, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed count rows of %s: %v", t.Name, err)
+		}
+		n++
+	}
+}
@@ -0,0 +1,190 @@
+package estimator_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+)
+
+// TestUpdateDML is measure_test.go の TestUpdateDML の期待値を見積もりで再現する
+func TestUpdateDML(t *testing.T) {
+	s := measureSchema(t)
+
+	empty := make(map[string]interface{})
+	withIndex1 := map[string]interface{}{"withIndex1": ""}
+	withIndex2 := map[string]interface{}{"withIndex2": ""}
+	withIndexAll := map[string]interface{}{"withIndex1": "", "withIndex2": ""}
+
+	cases := []struct {
+		name              string
+		normalColumnCount int
+		updateColumn      map[string]interface{}
+		rowCount          int
+		wantPerRow        int
+		wantErr           bool
+	}{
+		{"empty : 7-2000", 7, empty, 2000, 10, false},
+		{"empty : 7-2001", 7, empty, 2001, 10, true},
+		{"withIndex1 : 4-2000", 4, withIndex1, 2000, 10, false},
+		{"withIndex1 : 4-2001", 4, withIndex1, 2001, 10, true},
+		{"withIndex2 : 2-2000", 2, withIndex2, 2000, 10, false},
+		{"withIndex2 : 2-2001", 2, withIndex2, 2001, 10, true},
+		{"withIndexAll : 0-1818", 0, withIndexAll, 1818, 11, false},
+		{"withIndexAll : 0-1819", 0, withIndexAll, 1819, 11, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sql := createUpdateDML("hoge", tt.normalColumnCount, tt.updateColumn)
+			est, err := estimator.EstimateDML(s, sql, tt.rowCount, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantPerRow, est.PerRow; e != g {
+				t.Errorf("want per row %d but got %d", e, g)
+			}
+			if e, g := tt.wantErr, !est.FitsInTransaction(); e != g {
+				t.Errorf("want over limit %v but got %v. %s", e, g, est)
+			}
+			if e, g := 20000/tt.wantPerRow, est.MaxRows; e != g {
+				t.Errorf("want max rows %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+// TestEstimateDML_AnyExpression is SET の値と WHERE 句に dml で扱えない式を書いても、SET の Column から見積もれる
+func TestEstimateDML_AnyExpression(t *testing.T) {
+	s := measureSchema(t)
+
+	cases := []struct {
+		name       string
+		sql        string
+		wantPerRow int
+	}{
+		// [1:ID, 2:Col1]
+		{"is null", `UPDATE Measure SET Col1 = "" WHERE Col1 IS NULL`, 2},
+		{"where true", `UPDATE Measure SET Col1 = "" WHERE TRUE`, 2},
+		{"column", `UPDATE Measure SET Col1 = Col2 WHERE Col1 IS NULL`, 2},
+		// [1:ID, 2:WithIndex1, 3:MeasureWithIndex1_1 (U2), 4:MeasureWithIndex1_1 (U3)]
+		{"function", `UPDATE Measure SET WithIndex1 = CONCAT(Col1, "-", Col2) WHERE STARTS_WITH(Mark, @mark) OR Mark IS NULL`, 4},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			est, err := estimator.EstimateDML(s, tt.sql, 100, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantPerRow, est.PerRow; e != g {
+				t.Errorf("want per row %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestEstimateDML_Error(t *testing.T) {
+	s := measureSchema(t)
+
+	cases := []struct {
+		name string
+		sql  string
+	}{
+		{"unknown table", `UPDATE Hoge SET Col1 = "" WHERE Mark = "a"`},
+		{"unknown column", `UPDATE Measure SET Hoge = "" WHERE Mark = "a"`},
+		{"primary key", `UPDATE Measure SET ID = "" WHERE Mark = "a"`},
+		{"not update", `SELECT ID FROM Measure`},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := estimator.EstimateDML(s, tt.sql, 1, 0); err == nil {
+				t.Errorf("want err but got err is nil")
+			}
+		})
+	}
+}
+
+func TestExplainDML(t *testing.T) {
+	s := measureSchema(t)
+
+	ex, err := estimator.ExplainDML(s, `UPDATE Measure SET WithIndex1 = "a" WHERE Mark = @mark`, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// [1:ID, 2:WithIndex1, 3:MeasureWithIndex1_1 (U2), 4:MeasureWithIndex1_1 (U3)]
+	if e, g := 400, ex.Total; e != g {
+		t.Errorf("want total %d but got %d", e, g)
+	}
+}
+
+func TestAffectedRows(t *testing.T) {
+	ctx := context.Background()
+	s := measureSchema(t)
+	server, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	const database = "projects/fake/instances/fake/databases/fake"
+	server.AddDatabase(database, s)
+	client, err := server.NewClient(ctx, database, spanner.ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var ms []*spanner.Mutation
+	for i := 0; i < 30; i++ {
+		mark := "backfill"
+		if i%3 == 0 {
+			mark = "other"
+		}
+		ms = append(ms, spanner.InsertMap("Measure", map[string]interface{}{"ID": fmt.Sprintf("id-%d", i), "Mark": mark}))
+	}
+	if _, err := client.Apply(ctx, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt := spanner.NewStatement(`UPDATE Measure SET Col1 = Col2 WHERE Mark = @mark`)
+	stmt.Params["mark"] = "backfill"
+	rows, err := estimator.AffectedRows(ctx, client, s, stmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 20, rows; e != g {
+		t.Errorf("want rows %d but got %d", e, g)
+	}
+
+	// 見積もりはできるが、WHERE 句を SELECT にできないので行数は数えられない
+	_, err = estimator.AffectedRows(ctx, client, s, spanner.NewStatement(`UPDATE Measure SET Col1 = "" WHERE Col1 IS NULL`))
+	if err == nil || !strings.Contains(err.Error(), "unsupported predicate") {
+		t.Errorf("want unsupported predicate but got %v", err)
+	}
+}
+
+// createUpdateDML is measure_test.go の createUpdateDML と同じ DML を作成する
+func createUpdateDML(mark string, normalColumnCount int, updateColumn map[string]interface{}) string {
+	var sqlSets []string
+	sqlSets = append(sqlSets, "Arr1 = []")
+	sqlSets = append(sqlSets, `CommitedAt = "2019-01-01 10:00:00"`)
+	for j := 1; j <= normalColumnCount; j++ {
+		sqlSets = append(sqlSets, fmt.Sprintf(`Col%d = ""`, j))
+	}
+	var keys []string
+	for k := range updateColumn {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sqlSets = append(sqlSets, fmt.Sprintf(`%s = "%v"`, k, updateColumn[k]))
+	}
+	return fmt.Sprintf(`UPDATE Measure SET %s WHERE Mark = "%s"`, strings.Join(sqlSets, ","), mark)
+}
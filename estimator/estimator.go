@@ -0,0 +1,153 @@
+// Package estimator is Commit に含まれる Mutation 数を Spanner に送る前に見積もる
+//
+// 見積もりのルールは measure_*_test.go で実測した結果を元にしている
+//
+//	INSERT : 値を指定した Column の数 + Table が持つ Secondary Index の数 (Index の Column が NULL でも数えられる)
+//	UPDATE : 値を指定した Column の数
+//	         + 値を指定した Column を Key に持つ Secondary Index ごとに 1 (古い Entry の削除) + 1 + STORING の Column の数 (新しい Entry の追加)
+//	         + Key は変わらず STORING の Column に値を指定した Secondary Index ごとに 1 + 値を指定した STORING の Column の数
+//	DELETE : 削除する Key と KeyRange の数 * (1 + Table が持つ Secondary Index の数 + ON DELETE CASCADE で削除される子孫の Table が持つ Secondary Index の数)
+//	         ON DELETE NO ACTION の子の行は数えられないので、子の Table の Delete を同じ Commit に入れて、その分を数える (MissingChildDeletes で確認できる)
+//
+// ルールの詳細と根拠にした Case は Rules にある. Explain の Unit にはどのルールで数えたかが入る
+package estimator
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// DefaultLimit is 1 Commit に含めることができる Mutation 数の上限. Limit を指定しない時に使う Legacy の上限
+const DefaultLimit = 20000
+
+// Count is ms を 1 つの Commit で Apply した時の Mutation 数を見積もる
+func Count(s *schema.Schema, ms []*spanner.Mutation) (int, error) {
+	list, err := FromSpannerAll(ms)
+	if err != nil {
+		return 0, err
+	}
+	return CountMutations(s, list)
+}
+
+// CountMutations is ms を 1 つの Commit で Apply した時の Mutation 数を見積もる
+func CountMutations(s *schema.Schema, ms []*Mutation) (int, error) {
+	var sum int
+	for _, m := range ms {
+		c, err := CountMutation(s, m)
+		if err != nil {
+			return 0, err
+		}
+		sum += c
+	}
+	return sum, nil
+}
+
+// CountMutation is 1 つの Mutation の Mutation 数を見積もる
+func CountMutation(s *schema.Schema, m *Mutation) (int, error) {
+	units, err := unitsOf(s, m)
+	if err != nil {
+		return 0, err
+	}
+	var sum int
+	for _, u := range units {
+		sum += u.Count
+	}
+	return sum, nil
+}
+
+// unitsOf is 1 つの Mutation を Mutation 数を構成する Unit に分解する
+func unitsOf(s *schema.Schema, m *Mutation) ([]*Unit, error) {
+	t := s.Table(m.Table)
+	if t == nil {
+		return nil, fmt.Errorf("table %s is not found in schema", m.Table)
+	}
+	for _, c := range m.Columns {
+		if t.Column(c) == nil {
+			return nil, fmt.Errorf("column %s is not found in table %s", c, t.Name)
+		}
+	}
+
+	var units []*Unit
+	switch m.Op {
+	case OpInsert, OpInsertOrUpdate, OpReplace:
+		units = append(units, columnUnits(t, m, RuleInsertColumn)...)
+		for _, idx := range t.Indexes {
+			units = append(units, &Unit{Table: t.Name, Op: m.Op, Kind: KindIndexEntry, Name: idx.Name, Count: 1, Rule: RuleInsertIndexEntry})
+		}
+	case OpUpdate:
+		units = append(units, columnUnits(t, m, RuleUpdateColumn)...)
+		for _, idx := range t.Indexes {
+			if indexKeyUpdated(idx, m.Columns) {
+				units = append(units,
+					&Unit{Table: t.Name, Op: m.Op, Kind: KindIndexEntry, Name: idx.Name, Count: 1, Rule: RuleUpdateIndexDelete},
+					&Unit{Table: t.Name, Op: m.Op, Kind: KindIndexEntry, Name: idx.Name, Count: 1 + len(idx.Storing), Rule: RuleUpdateIndexInsert},
+				)
+				continue
+			}
+			if n := storingUpdated(idx, m.Columns); n > 0 {
+				units = append(units, &Unit{Table: t.Name, Op: m.Op, Kind: KindIndexEntry, Name: idx.Name, Count: 1 + n, Rule: RuleUpdateStoring})
+			}
+		}
+	case OpDelete:
+		rows := m.Keys + m.Ranges
+		if rows == 0 {
+			return nil, nil
+		}
+		units = append(units, &Unit{Table: t.Name, Op: m.Op, Kind: KindRow, Name: t.Name, Count: rows, Rule: RuleDeleteRow})
+		for _, idx := range t.Indexes {
+			units = append(units, &Unit{Table: t.Name, Op: m.Op, Kind: KindIndexEntry, Name: idx.Name, Count: rows, Rule: RuleDeleteIndexEntry})
+		}
+		units = append(units, cascadeUnits(s, t, m.Op, rows)...)
+	default:
+		return nil, fmt.Errorf("unsupported op %s", m.Op)
+	}
+	return units, nil
+}
+
+// columnUnits is 値を指定した Column を 1 つずつ Unit にする
+// Column 名は Mutation の指定ではなく Schema の表記に揃える
+func columnUnits(t *schema.Table, m *Mutation, rule RuleID) []*Unit {
+	units := make([]*Unit, len(m.Columns))
+	for i, c := range m.Columns {
+		units[i] = &Unit{Table: t.Name, Op: m.Op, Kind: KindColumn, Name: t.Column(c).Name, Count: 1, Rule: rule}
+	}
+	return units
+}
+
+// indexKeyUpdated is columns に idx の Key Column が含まれるかどうかを返す
+func indexKeyUpdated(idx *schema.Index, columns []string) bool {
+	for _, c := range columns {
+		if idx.HasColumn(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// storingUpdated is columns に含まれる idx の STORING の Column の数を返す
+func storingUpdated(idx *schema.Index, columns []string) int {
+	var n int
+	for _, c := range columns {
+		if idx.Stores(c) {
+			n++
+		}
+	}
+	return n
+}
+
+// cascadeUnits is parent の行を削除した時に ON DELETE CASCADE で削除される子孫の Table の Secondary Index の Unit を返す
+// 子孫の行の削除自体は数えられないが、子孫の Table の Secondary Index は親の Key ごとに 1 つ数えられる
+func cascadeUnits(s *schema.Schema, parent *schema.Table, op Op, rows int) []*Unit {
+	var units []*Unit
+	for _, d := range deleteTree(s, parent, 1) {
+		if !d.Cascade {
+			continue
+		}
+		for _, idx := range d.Table.Indexes {
+			units = append(units, &Unit{Table: d.Table.Name, Op: op, Kind: KindIndexEntry, Name: idx.Name, Count: rows, Rule: RuleDeleteCascadeIndexEntry})
+		}
+	}
+	return units
+}
@@ -0,0 +1,266 @@
+package estimator_test
+
+import (
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// measureSchema is ddl/measure.sql を読み込む
+func measureSchema(t *testing.T) *schema.Schema {
+	s, err := schema.ParseFile("../ddl/measure.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestInsert is measure_test.go の TestInsert の期待値を見積もりで再現する
+func TestInsert(t *testing.T) {
+	s := measureSchema(t)
+
+	empty := make(map[string]interface{})
+	wihtIndex1 := map[string]interface{}{"withIndex1": ""}
+	wihtIndex2 := map[string]interface{}{"withIndex2": ""}
+	wihtIndexAll := map[string]interface{}{"withIndex1": "", "withIndex2": ""}
+
+	cases := []struct {
+		name              string
+		normalColumnCount int
+		addColumn         map[string]interface{}
+		rowCount          int
+		wantErr           bool
+	}{
+		{"empty : 4-2000", 4, empty, 2000, false},
+		{"empty : 4-2001", 4, empty, 2001, true},
+		{"withIndex1 : 3-2000", 3, wihtIndex1, 2000, false},
+		{"withIndex1 : 3-2001", 3, wihtIndex1, 2001, true},
+		{"withIndex2 : 3-2000", 3, wihtIndex2, 2000, false},
+		{"withIndex2 : 3-2001", 3, wihtIndex2, 2001, true},
+		{"withIndexAll : 2-2000", 2, wihtIndexAll, 2000, false},
+		{"withIndexAll : 2-2001", 2, wihtIndexAll, 2001, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mu := createInsertMutation("Measure", tt.normalColumnCount, tt.addColumn, tt.rowCount)
+			got, err := estimator.Count(s, mu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantErr, got > estimator.DefaultLimit; e != g {
+				t.Errorf("want over limit %v but got %v. count=%d", e, g, got)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := measureSchema(t)
+
+	empty := make(map[string]interface{})
+	withIndex1 := map[string]interface{}{"withIndex1": ""}
+	withIndex2 := map[string]interface{}{"withIndex2": ""}
+	withIndexAll := map[string]interface{}{"withIndex1": "", "withIndex2": ""}
+
+	cases := []struct {
+		name              string
+		normalColumnCount int
+		updateColumn      map[string]interface{}
+		rowCount          int
+		wantErr           bool
+	}{
+		{"empty : 7-2000", 7, empty, 2000, false},
+		{"empty : 7-2001", 7, empty, 2001, true},
+		{"withIndex1 : 4-2000", 4, withIndex1, 2000, false},
+		{"withIndex1 : 4-2001", 4, withIndex1, 2001, true},
+		{"withIndex2 : 2-2000", 2, withIndex2, 2000, false},
+		{"withIndex2 : 2-2001", 2, withIndex2, 2001, true},
+		{"withIndexAll : 0-1500", 0, withIndexAll, 1500, false},
+		{"withIndexAll : 0-1600", 0, withIndexAll, 1600, false},
+		{"withIndexAll : 0-1700", 0, withIndexAll, 1700, false},
+		{"withIndexAll : 0-1818", 0, withIndexAll, 1818, false},
+		{"withIndexAll : 0-1819", 0, withIndexAll, 1819, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mu := createUpdateMutation("Measure", tt.normalColumnCount, tt.updateColumn, tt.rowCount)
+			got, err := estimator.Count(s, mu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantErr, got > estimator.DefaultLimit; e != g {
+				t.Errorf("want over limit %v but got %v. count=%d", e, g, got)
+			}
+		})
+	}
+}
+
+func TestMeasure_Delete(t *testing.T) {
+	s := measureSchema(t)
+
+	cases := []struct {
+		name     string
+		rowCount int
+		wantErr  bool
+	}{
+		{"2000", 2000, false},
+		{"5000", 5000, false},
+		{"5001", 5001, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mu := make([]*spanner.Mutation, tt.rowCount)
+			for i := 0; i < tt.rowCount; i++ {
+				mu[i] = spanner.Delete("Measure", spanner.Key{uuid.New().String()})
+			}
+			got, err := estimator.Count(s, mu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantErr, got > estimator.DefaultLimit; e != g {
+				t.Errorf("want over limit %v but got %v. count=%d", e, g, got)
+			}
+		})
+	}
+}
+
+// TestMeasureStoringIndex_Update is measure_storing_index_test.go の TestMeasureStoringIndex_Update の期待値を見積もりで再現する
+func TestMeasureStoringIndex_Update(t *testing.T) {
+	s, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty := make(map[string]interface{})
+	withStoringIndex := map[string]interface{}{"WithIndex1": ""}
+	withStoringColumn1 := map[string]interface{}{"Storing1": ""}
+	withStoringColumn2 := map[string]interface{}{"Storing2": ""}
+
+	cases := []struct {
+		name              string
+		normalColumnCount int
+		updateColumn      map[string]interface{}
+		rowCount          int
+		wantErr           bool
+	}{
+		{"empty : 7-2000", 7, empty, 2000, false},
+		{"empty : 7-2001", 7, empty, 2001, true},
+		{"withIndex1 : 3-2000", 3, withStoringIndex, 2000, false},
+		{"withIndex1 : 3-2001", 3, withStoringIndex, 2001, true},
+		{"withStoringColumn1 : 2-2000", 2, withStoringColumn1, 2000, false},
+		{"withStoringColumn1 : 2-2001", 2, withStoringColumn1, 2001, true},
+		{"withStoringColumn2 : 4-2000", 4, withStoringColumn2, 2000, false},
+		{"withStoringColumn2 : 4-2001", 4, withStoringColumn2, 2001, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mu := createUpdateMutation("MeasureWithStoring", tt.normalColumnCount, tt.updateColumn, tt.rowCount)
+			got, err := estimator.Count(s, mu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantErr, got > estimator.DefaultLimit; e != g {
+				t.Errorf("want over limit %v but got %v. count=%d", e, g, got)
+			}
+		})
+	}
+}
+
+// TestMeasureInterleaveWithIndex_Delete is 親の行を削除した時に CASCADE で削除される子の Table の Index が数えられることを確認する
+func TestMeasureInterleaveWithIndex_Delete(t *testing.T) {
+	s, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		table    string
+		rowCount int
+		want     int
+	}{
+		{"cascade", "MeasureParent", 10000, 10000},
+		{"cascade with child index", "MeasureParentWithIndex", 10000, 20000},
+		{"no cascade", "MeasureParentNoCascade", 10000, 10000},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mu := make([]*spanner.Mutation, tt.rowCount)
+			for i := range mu {
+				mu[i] = spanner.Delete(tt.table, spanner.Key{uuid.New().String()})
+			}
+			got, err := estimator.Count(s, mu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != g {
+				t.Errorf("want %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestCount_UnknownColumn(t *testing.T) {
+	s := measureSchema(t)
+
+	mu := []*spanner.Mutation{spanner.InsertMap("Measure", map[string]interface{}{"ID": "a", "Hoge": ""})}
+	if _, err := estimator.Count(s, mu); err == nil {
+		t.Errorf("want err but got err is nil")
+	}
+}
+
+// createInsertMutation is measure_test.go の createInsertMutation と同じ Mutation を作成する
+func createInsertMutation(table string, normalColumnCount int, addColumn map[string]interface{}, rowCount int) []*spanner.Mutation {
+	list := make([]*spanner.Mutation, rowCount)
+	for i := 0; i < rowCount; i++ {
+		v := make(map[string]interface{})
+		v["ID"] = uuid.New().String()
+		for j := 1; j <= normalColumnCount; j++ {
+			v[fmt.Sprintf("Col%d", j)] = ""
+		}
+
+		for addKey, addValue := range addColumn {
+			v[addKey] = addValue
+		}
+		v["Arr1"] = []string{}
+		v["CommitedAt"] = spanner.CommitTimestamp
+		list[i] = spanner.InsertMap(table, v)
+	}
+
+	return list
+}
+
+// createUpdateMutation is measure_test.go の createUpdateMutation と同じ Mutation を作成する
+func createUpdateMutation(table string, normalColumnCount int, updateColumn map[string]interface{}, rowCount int) []*spanner.Mutation {
+	list := make([]*spanner.Mutation, rowCount)
+	for i := 0; i < rowCount; i++ {
+		v := make(map[string]interface{})
+		v["ID"] = uuid.New().String()
+		for j := 1; j <= normalColumnCount; j++ {
+			v[fmt.Sprintf("Col%d", j)] = ""
+		}
+
+		for updateKey, updateValue := range updateColumn {
+			v[updateKey] = updateValue
+		}
+		v["Arr1"] = []string{}
+		v["CommitedAt"] = spanner.CommitTimestamp
+		list[i] = spanner.UpdateMap(table, v)
+	}
+
+	return list
+}
@@ -0,0 +1,185 @@
+package estimator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// Kind is Mutation 数を構成する Unit の種類
+type Kind int
+
+const (
+	// KindColumn is 値を書き込んだ Base Table の Column
+	KindColumn Kind = iota
+	// KindIndexEntry is Secondary Index の Entry
+	KindIndexEntry
+	// KindRow is Delete される行
+	KindRow
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindColumn:
+		return "Column"
+	case KindIndexEntry:
+		return "IndexEntry"
+	case KindRow:
+		return "Row"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Unit is Mutation 数の内訳の 1 行
+// measure_test.go のコメントにある "4:WithIndex1, 5:MeasureWithIndex1_1" の 1 つ 1 つに相当する
+type Unit struct {
+	// Table is Mutation の対象の Table
+	Table string
+	Op    Op
+	Kind  Kind
+	// Name is Column 名, Index 名, Table 名のいずれか
+	Name  string
+	Count int
+	// Rule is 数えたルール. 説明は LookupRule で引ける
+	Rule RuleID
+}
+
+// Explanation is Commit の Mutation 数の内訳
+type Explanation struct {
+	// Units is Table, Op, Kind, Name ごとに集計した Unit
+	Units []*Unit
+	Total int
+
+	// ByTable is Mutation の対象の Table ごとの合計. Secondary Index の Entry は Base Table に含める
+	ByTable map[string]int
+	// ByOp is Op ごとの合計
+	ByOp map[Op]int
+}
+
+// Explain is ms を 1 つの Commit で Apply した時の Mutation 数の内訳を返す
+func Explain(s *schema.Schema, ms []*spanner.Mutation) (*Explanation, error) {
+	list, err := FromSpannerAll(ms)
+	if err != nil {
+		return nil, err
+	}
+	return ExplainMutations(s, list)
+}
+
+// ExplainMutations is ms を 1 つの Commit で Apply した時の Mutation 数の内訳を返す
+func ExplainMutations(s *schema.Schema, ms []*Mutation) (*Explanation, error) {
+	type key struct {
+		table string
+		op    Op
+		kind  Kind
+		name  string
+		rule  RuleID
+	}
+	e := &Explanation{
+		ByTable: make(map[string]int),
+		ByOp:    make(map[Op]int),
+	}
+	units := make(map[key]*Unit)
+	for _, m := range ms {
+		list, err := unitsOf(s, m)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range list {
+			k := key{u.Table, u.Op, u.Kind, u.Name, u.Rule}
+			if v, ok := units[k]; ok {
+				v.Count += u.Count
+			} else {
+				v := *u
+				units[k] = &v
+				e.Units = append(e.Units, &v)
+			}
+			e.Total += u.Count
+			e.ByTable[u.Table] += u.Count
+			e.ByOp[u.Op] += u.Count
+		}
+	}
+	sortUnits(s, e.Units)
+	return e, nil
+}
+
+// sortUnits is Table, Op, Kind の順に並べ、同じ Kind の中は Schema に書かれている順、Rule の順に並べる
+// InsertMap などは Column の順序が不定なので、出力を安定させるために並べ替える
+func sortUnits(s *schema.Schema, units []*Unit) {
+	tablePos := make(map[string]int)
+	for i, t := range s.Tables {
+		tablePos[t.Name] = i
+	}
+	namePos := func(u *Unit) int {
+		t := s.Table(u.Table)
+		switch u.Kind {
+		case KindColumn:
+			for i, c := range t.Columns {
+				if c.Name == u.Name {
+					return i
+				}
+			}
+		case KindIndexEntry:
+			for i, idx := range t.Indexes {
+				if idx.Name == u.Name {
+					return i
+				}
+			}
+		}
+		return 0
+	}
+	sort.SliceStable(units, func(i, j int) bool {
+		a, b := units[i], units[j]
+		if tablePos[a.Table] != tablePos[b.Table] {
+			return tablePos[a.Table] < tablePos[b.Table]
+		}
+		if a.Op != b.Op {
+			return a.Op < b.Op
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if pa, pb := namePos(a), namePos(b); pa != pb {
+			return pa < pb
+		}
+		return a.Rule < b.Rule
+	})
+}
+
+// String is 内訳を表形式の文字列にする
+func (e *Explanation) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tOP\tKIND\tNAME\tRULE\tCOUNT")
+	for _, u := range e.Units {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", u.Table, u.Op, u.Kind, u.Name, u.Rule, u.Count)
+	}
+	w.Flush()
+
+	fmt.Fprintln(&buf)
+	w = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, t := range sortedKeys(e.ByTable) {
+		fmt.Fprintf(w, "table %s\t%d\n", t, e.ByTable[t])
+	}
+	for op := OpInsert; op <= OpDelete; op++ {
+		if c, ok := e.ByOp[op]; ok {
+			fmt.Fprintf(w, "op %s\t%d\n", op, c)
+		}
+	}
+	fmt.Fprintf(w, "total\t%d\n", e.Total)
+	w.Flush()
+	return buf.String()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,126 @@
+package estimator_test
+
+import (
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+func ExampleExplain() {
+	s, err := schema.ParseFile("../ddl/measure.sql")
+	if err != nil {
+		panic(err)
+	}
+
+	// measure_test.go TestInsert の "withIndex1 : 3-N" の 1 行分
+	mu := createInsertMutation("Measure", 3, map[string]interface{}{"withIndex1": ""}, 1)
+	e, err := estimator.Explain(s, mu)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(e)
+	// Output:
+	// TABLE    OP      KIND        NAME                 RULE  COUNT
+	// Measure  Insert  Column      ID                   I1    1
+	// Measure  Insert  Column      Arr1                 I1    1
+	// Measure  Insert  Column      Col1                 I1    1
+	// Measure  Insert  Column      Col2                 I1    1
+	// Measure  Insert  Column      Col3                 I1    1
+	// Measure  Insert  Column      WithIndex1           I1    1
+	// Measure  Insert  Column      CommitedAt           I1    1
+	// Measure  Insert  IndexEntry  MeasureWithIndex1_1  I2    1
+	// Measure  Insert  IndexEntry  MeasureWithIndex2_1  I2    1
+	// Measure  Insert  IndexEntry  MeasureWithIndex2_2  I2    1
+	//
+	// table Measure  10
+	// op Insert      10
+	// total          10
+}
+
+func TestExplain_StoringIndex(t *testing.T) {
+	s, err := schema.ParseFile("../ddl/measure_storing_index.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// measure_storing_index_test.go TestMeasureStoringIndex_Insert の "WithIndex1 : 4-N"
+	mu := createInsertMutation("MeasureWithStoring", 4, map[string]interface{}{"WithIndex1": ""}, 2000)
+	e, err := estimator.Explain(s, mu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 20000, e.Total; e != g {
+		t.Errorf("want total %d but got %d", e, g)
+	}
+	if e, g := 20000, e.ByTable["MeasureWithStoring"]; e != g {
+		t.Errorf("want table total %d but got %d", e, g)
+	}
+	if e, g := 20000, e.ByOp[estimator.OpInsert]; e != g {
+		t.Errorf("want insert total %d but got %d", e, g)
+	}
+
+	want := []struct {
+		kind  estimator.Kind
+		name  string
+		count int
+	}{
+		{estimator.KindColumn, "ID", 2000},
+		{estimator.KindColumn, "Arr1", 2000},
+		{estimator.KindColumn, "Col1", 2000},
+		{estimator.KindColumn, "Col2", 2000},
+		{estimator.KindColumn, "Col3", 2000},
+		{estimator.KindColumn, "Col4", 2000},
+		{estimator.KindColumn, "WithIndex1", 2000},
+		{estimator.KindColumn, "CommitedAt", 2000},
+		{estimator.KindIndexEntry, "MeasureWithStoringWithIndex1_1", 2000},
+		{estimator.KindIndexEntry, "MeasureWithStoringWithIndex2_1", 2000},
+	}
+	if len(e.Units) != len(want) {
+		t.Fatalf("want units %d but got %d\n%s", len(want), len(e.Units), e)
+	}
+	for i, w := range want {
+		u := e.Units[i]
+		if u.Kind != w.kind || u.Name != w.name || u.Count != w.count {
+			t.Errorf("units[%d] want %v %s %d but got %v %s %d", i, w.kind, w.name, w.count, u.Kind, u.Name, u.Count)
+		}
+	}
+}
+
+func TestExplain_MixedOps(t *testing.T) {
+	s, err := schema.ParseFile("../ddl/measure.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu []*spanner.Mutation
+	mu = append(mu, createInsertMutation("Measure", 4, map[string]interface{}{}, 10)...)
+	mu = append(mu, createUpdateMutation("Measure", 0, map[string]interface{}{"WithIndex1": ""}, 10)...)
+	mu = append(mu, spanner.Delete("Measure", spanner.Key{"a"}))
+	e, err := estimator.Explain(s, mu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 100, e.ByOp[estimator.OpInsert]; e != g {
+		t.Errorf("want insert %d but got %d", e, g)
+	}
+	// ID, Arr1, CommitedAt, WithIndex1, MeasureWithIndex1_1 * 2
+	if e, g := 60, e.ByOp[estimator.OpUpdate]; e != g {
+		t.Errorf("want update %d but got %d", e, g)
+	}
+	if e, g := 4, e.ByOp[estimator.OpDelete]; e != g {
+		t.Errorf("want delete %d but got %d", e, g)
+	}
+	if e, g := 164, e.Total; e != g {
+		t.Errorf("want total %d but got %d", e, g)
+	}
+	c, err := estimator.Count(s, mu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := e.Total, c; e != g {
+		t.Errorf("Count %d and Explain %d are different", g, e)
+	}
+}
@@ -0,0 +1,69 @@
+package estimator
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvLimit is 計測する Spanner の Mutation 数の上限を指定する環境変数. legacy, current または数値
+const EnvLimit = "MUTATION_COUNT_LIMIT"
+
+// Profile is 1 Commit に含めることができる Mutation 数の上限
+// measure_*_test.go の N と N+1 の組は、1 行の Mutation 数と Profile の Limit から求める
+type Profile struct {
+	Name  string
+	Limit int
+}
+
+var (
+	// Legacy is measure_*_test.go を最初に計測した時の上限
+	Legacy = Profile{Name: "legacy", Limit: DefaultLimit}
+	// Current is 引き上げられた後の上限
+	Current = Profile{Name: "current", Limit: 80000}
+)
+
+// Profiles is 名前で指定できる Profile
+var Profiles = []Profile{Legacy, Current}
+
+// ParseProfile is 名前または上限の数値から Profile を返す. 空の場合は Legacy
+// 数値の場合は Name が custom になる
+func ParseProfile(v string) (Profile, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return Legacy, nil
+	}
+	for _, p := range Profiles {
+		if strings.EqualFold(p.Name, v) {
+			return p, nil
+		}
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return Profile{}, fmt.Errorf("invalid limit profile %q. use legacy, current or a positive number", v)
+	}
+	return Profile{Name: "custom", Limit: n}, nil
+}
+
+// ProfileFromEnv is MUTATION_COUNT_LIMIT から Profile を返す. 指定されていない場合は Legacy
+func ProfileFromEnv() (Profile, error) {
+	return ParseProfile(os.Getenv(EnvLimit))
+}
+
+func (p Profile) String() string {
+	return fmt.Sprintf("%s(%d)", p.Name, p.Limit)
+}
+
+// MaxRows is 1 行 perRow の Mutation を 1 つの Commit に含めることができる最大の行数. MaxRows+1 行は上限を超える
+func (p Profile) MaxRows(perRow int) int {
+	if perRow < 1 {
+		return 0
+	}
+	return p.Limit / perRow
+}
+
+// Fits is count が上限以下かどうか
+func (p Profile) Fits(count int) bool {
+	return count <= p.Limit
+}
@@ -0,0 +1,75 @@
+package estimator_test
+
+import (
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/estimator"
+)
+
+func TestParseProfile(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "legacy(20000)", false},
+		{"legacy", "legacy(20000)", false},
+		{"Current", "current(80000)", false},
+		{"50000", "custom(50000)", false},
+		{"0", "", true},
+		{"hoge", "", true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := estimator.ParseProfile(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want err but got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got.String(); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestProfile_MaxRows(t *testing.T) {
+	cases := []struct {
+		profile estimator.Profile
+		perRow  int
+		want    int
+	}{
+		// measure_test.go の N と N+1 の組
+		{estimator.Legacy, 10, 2000},
+		{estimator.Legacy, 11, 1818},
+		{estimator.Legacy, 4, 5000},
+		{estimator.Legacy, 2, 10000},
+		{estimator.Current, 10, 8000},
+		{estimator.Current, 11, 7272},
+		{estimator.Current, 4, 20000},
+		{estimator.Current, 0, 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.profile.String(), func(t *testing.T) {
+			got := tt.profile.MaxRows(tt.perRow)
+			if e, g := tt.want, got; e != g {
+				t.Errorf("perRow %d want %d but got %d", tt.perRow, e, g)
+			}
+			if tt.perRow == 0 {
+				return
+			}
+			if !tt.profile.Fits(got*tt.perRow) || tt.profile.Fits((got+1)*tt.perRow) {
+				t.Errorf("%d rows must fit and %d rows must not fit in %s", got, got+1, tt.profile)
+			}
+		})
+	}
+}
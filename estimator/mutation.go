@@ -0,0 +1,196 @@
+package estimator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+// Op is Mutation の操作の種類
+type Op int
+
+const (
+	OpInsert Op = iota
+	OpInsertOrUpdate
+	OpReplace
+	OpUpdate
+	OpDelete
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpInsert:
+		return "Insert"
+	case OpInsertOrUpdate:
+		return "InsertOrUpdate"
+	case OpReplace:
+		return "Replace"
+	case OpUpdate:
+		return "Update"
+	case OpDelete:
+		return "Delete"
+	default:
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+}
+
+// ParseOp is Op の名前から Op を返す. 大文字小文字と "_" は区別しない (insert_or_update, InsertOrUpdate)
+func ParseOp(v string) (Op, error) {
+	name := strings.Replace(strings.TrimSpace(v), "_", "", -1)
+	for op := OpInsert; op <= OpDelete; op++ {
+		if strings.EqualFold(op.String(), name) {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid op %q. use insert, insert_or_update, replace, update or delete", v)
+}
+
+// Mutation is 見積もりに必要な情報だけを spanner.Mutation から取り出したもの
+type Mutation struct {
+	Op      Op
+	Table   string
+	Columns []string
+
+	// Keys is Delete で指定された Key の数
+	Keys int
+	// Ranges is Delete で指定された KeyRange の数. AllKeys も 1 つの KeyRange として数える
+	Ranges int
+}
+
+// spanner.Mutation の op は unexported で値も公開されていないので、各コンストラクタで作った Mutation から値を拾っておく
+var opBySpannerOp = map[int64]Op{
+	spannerOp(spanner.Insert("", nil, nil)):         OpInsert,
+	spannerOp(spanner.InsertOrUpdate("", nil, nil)): OpInsertOrUpdate,
+	spannerOp(spanner.Replace("", nil, nil)):        OpReplace,
+	spannerOp(spanner.Update("", nil, nil)):         OpUpdate,
+	spannerOp(spanner.Delete("", spanner.Key{})):    OpDelete,
+}
+
+func spannerOp(m *spanner.Mutation) int64 {
+	return reflect.ValueOf(m).Elem().FieldByName("op").Int()
+}
+
+var (
+	keyType      = reflect.TypeOf(spanner.Key{})
+	keyRangeType = reflect.TypeOf(spanner.KeyRange{})
+	allKeysType  = reflect.TypeOf(spanner.AllKeys())
+	keySetsType  = reflect.TypeOf(spanner.KeySets())
+)
+
+// FromSpanner is spanner.Mutation を Mutation に変換する
+// spanner.Mutation は中身を参照する API を持たないので、reflect で unexported な field を読み出す
+func FromSpanner(m *spanner.Mutation) (*Mutation, error) {
+	if m == nil {
+		return nil, fmt.Errorf("mutation is nil")
+	}
+	v := reflect.ValueOf(m).Elem()
+	op, ok := opBySpannerOp[v.FieldByName("op").Int()]
+	if !ok {
+		return nil, fmt.Errorf("unknown mutation op %d", v.FieldByName("op").Int())
+	}
+
+	ret := &Mutation{
+		Op:    op,
+		Table: v.FieldByName("table").String(),
+	}
+	columns := v.FieldByName("columns")
+	for i := 0; i < columns.Len(); i++ {
+		ret.Columns = append(ret.Columns, columns.Index(i).String())
+	}
+	if op == OpDelete {
+		if err := countKeySet(v.FieldByName("keySet"), ret); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// countKeySet is KeySet に含まれる Key と KeyRange の数を数える
+func countKeySet(ks reflect.Value, m *Mutation) error {
+	// *spanner.Key も KeySet を満たすので、Pointer は中身を見る
+	for ks.Kind() == reflect.Interface || ks.Kind() == reflect.Ptr {
+		if ks.IsNil() {
+			return nil
+		}
+		ks = ks.Elem()
+	}
+	switch ks.Type() {
+	case keyType:
+		m.Keys++
+	case keyRangeType, allKeysType:
+		m.Ranges++
+	case keySetsType:
+		for i := 0; i < ks.Len(); i++ {
+			if err := countKeySet(ks.Index(i), m); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported KeySet type %s", ks.Type())
+	}
+	return nil
+}
+
+// FromSpannerAll is FromSpanner を複数の Mutation に対して行う
+func FromSpannerAll(ms []*spanner.Mutation) ([]*Mutation, error) {
+	list := make([]*Mutation, len(ms))
+	for i, m := range ms {
+		v, err := FromSpanner(m)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+// FromProto is Commit Request に含まれる sppb.Mutation を Mutation に変換する
+// 1 つの sppb.Mutation に複数行が含まれている場合は行ごとに分ける
+func FromProto(m *sppb.Mutation) ([]*Mutation, error) {
+	var op Op
+	var w *sppb.Mutation_Write
+	switch v := m.Operation.(type) {
+	case *sppb.Mutation_Insert:
+		op, w = OpInsert, v.Insert
+	case *sppb.Mutation_InsertOrUpdate:
+		op, w = OpInsertOrUpdate, v.InsertOrUpdate
+	case *sppb.Mutation_Replace:
+		op, w = OpReplace, v.Replace
+	case *sppb.Mutation_Update:
+		op, w = OpUpdate, v.Update
+	case *sppb.Mutation_Delete_:
+		d := &Mutation{Op: OpDelete, Table: v.Delete.Table}
+		if ks := v.Delete.KeySet; ks != nil {
+			d.Keys = len(ks.Keys)
+			d.Ranges = len(ks.Ranges)
+			if ks.All {
+				d.Ranges++
+			}
+		}
+		return []*Mutation{d}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mutation operation %T", m.Operation)
+	}
+
+	list := make([]*Mutation, len(w.Values))
+	for i := range w.Values {
+		list[i] = &Mutation{Op: op, Table: w.Table, Columns: w.Columns}
+	}
+	return list, nil
+}
+
+// FromProtoAll is FromProto を複数の sppb.Mutation に対して行う
+func FromProtoAll(ms []*sppb.Mutation) ([]*Mutation, error) {
+	var list []*Mutation
+	for _, m := range ms {
+		v, err := FromProto(m)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v...)
+	}
+	return list, nil
+}
@@ -0,0 +1,126 @@
+package estimator_test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+func TestFromSpanner(t *testing.T) {
+	cases := []struct {
+		name       string
+		mu         *spanner.Mutation
+		wantOp     estimator.Op
+		wantCols   int
+		wantKeys   int
+		wantRanges int
+	}{
+		{"insert", spanner.Insert("Measure", []string{"ID", "Col1"}, []interface{}{"a", ""}), estimator.OpInsert, 2, 0, 0},
+		{"insertOrUpdate", spanner.InsertOrUpdate("Measure", []string{"ID"}, []interface{}{"a"}), estimator.OpInsertOrUpdate, 1, 0, 0},
+		{"replace", spanner.Replace("Measure", []string{"ID"}, []interface{}{"a"}), estimator.OpReplace, 1, 0, 0},
+		{"update", spanner.UpdateMap("Measure", map[string]interface{}{"ID": "a", "Col1": "", "Col2": ""}), estimator.OpUpdate, 3, 0, 0},
+		{"delete key", spanner.Delete("Measure", spanner.Key{"a"}), estimator.OpDelete, 0, 1, 0},
+		{"delete key pointer", spanner.Delete("Measure", &spanner.Key{"a"}), estimator.OpDelete, 0, 1, 0},
+		{"delete range", spanner.Delete("Measure", spanner.KeyRange{Start: spanner.Key{"a"}, End: spanner.Key{"b"}}), estimator.OpDelete, 0, 0, 1},
+		{"delete all", spanner.Delete("Measure", spanner.AllKeys()), estimator.OpDelete, 0, 0, 1},
+		{"delete keysets", spanner.Delete("Measure", spanner.KeySets(spanner.Key{"a"}, spanner.Key{"b"}, spanner.Key{"c"}.AsPrefix())), estimator.OpDelete, 0, 2, 1},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := estimator.FromSpanner(tt.mu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantOp, got.Op; e != g {
+				t.Errorf("want op %s but got %s", e, g)
+			}
+			if e, g := "Measure", got.Table; e != g {
+				t.Errorf("want table %s but got %s", e, g)
+			}
+			if e, g := tt.wantCols, len(got.Columns); e != g {
+				t.Errorf("want columns %d but got %d", e, g)
+			}
+			if e, g := tt.wantKeys, got.Keys; e != g {
+				t.Errorf("want keys %d but got %d", e, g)
+			}
+			if e, g := tt.wantRanges, got.Ranges; e != g {
+				t.Errorf("want ranges %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestFromProto(t *testing.T) {
+	ms := []*sppb.Mutation{
+		{Operation: &sppb.Mutation_Insert{Insert: &sppb.Mutation_Write{
+			Table:   "Measure",
+			Columns: []string{"ID", "Col1"},
+			Values:  []*structpb.ListValue{{}, {}},
+		}}},
+		{Operation: &sppb.Mutation_Update{Update: &sppb.Mutation_Write{
+			Table:   "Measure",
+			Columns: []string{"ID"},
+			Values:  []*structpb.ListValue{{}},
+		}}},
+		{Operation: &sppb.Mutation_Delete_{Delete: &sppb.Mutation_Delete{
+			Table:  "Measure",
+			KeySet: &sppb.KeySet{Keys: []*structpb.ListValue{{}, {}}, Ranges: []*sppb.KeyRange{{}}, All: true},
+		}}},
+	}
+	got, err := estimator.FromProtoAll(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 4, len(got); e != g {
+		t.Fatalf("want mutations %d but got %d", e, g)
+	}
+	if got[0].Op != estimator.OpInsert || got[1].Op != estimator.OpInsert || len(got[1].Columns) != 2 {
+		t.Errorf("unexpected insert %+v, %+v", got[0], got[1])
+	}
+	if got[2].Op != estimator.OpUpdate || len(got[2].Columns) != 1 {
+		t.Errorf("unexpected update %+v", got[2])
+	}
+	if got[3].Op != estimator.OpDelete || got[3].Keys != 2 || got[3].Ranges != 2 {
+		t.Errorf("unexpected delete %+v", got[3])
+	}
+}
+
+func TestParseOp(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    estimator.Op
+		wantErr bool
+	}{
+		{"insert", estimator.OpInsert, false},
+		{"insert_or_update", estimator.OpInsertOrUpdate, false},
+		{"InsertOrUpdate", estimator.OpInsertOrUpdate, false},
+		{"REPLACE", estimator.OpReplace, false},
+		{"update", estimator.OpUpdate, false},
+		{"delete", estimator.OpDelete, false},
+		{"upsert", 0, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := estimator.ParseOp(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want err but got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
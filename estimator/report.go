@@ -0,0 +1,174 @@
+package estimator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// Report is 1 つの Table に 1 行ずつ同じ Column を書き込む時の Mutation 数の見積もり
+// cmd/mutcount が Text, JSON, Markdown で出力する
+type Report struct {
+	Table string `json:"table"`
+	Op    string `json:"op"`
+	// Columns is 値を書き込む Column. Primary Key の Column を含む. Delete の場合は空
+	Columns []string `json:"columns"`
+	// PerRow is 1 行の Mutation 数
+	PerRow int `json:"perRow"`
+	// Profile is MaxRows を求めた Profile の名前
+	Profile string `json:"profile"`
+	Limit   int    `json:"limit"`
+	// MaxRows is 1 つの Commit に含めることができる最大の行数
+	MaxRows int `json:"maxRows"`
+	// Units is 1 行の Mutation 数の内訳
+	Units []*ReportUnit `json:"units"`
+}
+
+// ReportUnit is Report の内訳の 1 行. Unit を出力用に文字列にしたもの
+type ReportUnit struct {
+	Table string `json:"table"`
+	Op    string `json:"op"`
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Rule  string `json:"rule"`
+	Count int    `json:"count"`
+}
+
+// NewReport is table の 1 行に op で columns を書き込む時の Report を作る
+// Insert, Update などでは Primary Key の Column は指定しなくても書き込むものとして数える. Delete の場合は 1 つの Key を削除するものとして数え、columns は指定できない
+func NewReport(s *schema.Schema, table string, op Op, columns []string, p Profile) (*Report, error) {
+	t := s.Table(table)
+	if t == nil {
+		return nil, fmt.Errorf("table %s is not found in schema", table)
+	}
+	m := &Mutation{Op: op, Table: t.Name}
+	switch op {
+	case OpDelete:
+		if len(columns) > 0 {
+			return nil, fmt.Errorf("columns can not be specified for %s", op)
+		}
+		m.Keys = 1
+	default:
+		for _, k := range t.PrimaryKey {
+			m.Columns = append(m.Columns, t.Column(k.Column).Name)
+		}
+		for _, c := range columns {
+			col := t.Column(c)
+			if col == nil {
+				return nil, fmt.Errorf("column %s is not found in table %s", c, t.Name)
+			}
+			if containsFold(m.Columns, col.Name) {
+				continue
+			}
+			m.Columns = append(m.Columns, col.Name)
+		}
+	}
+
+	e, err := ExplainMutations(s, []*Mutation{m})
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{
+		Table:   t.Name,
+		Op:      op.String(),
+		Columns: append([]string{}, m.Columns...),
+		PerRow:  e.Total,
+		Profile: p.Name,
+		Limit:   p.Limit,
+		MaxRows: p.MaxRows(e.Total),
+		Units:   make([]*ReportUnit, len(e.Units)),
+	}
+	for i, u := range e.Units {
+		r.Units[i] = &ReportUnit{Table: u.Table, Op: u.Op.String(), Kind: u.Kind.String(), Name: u.Name, Rule: string(u.Rule), Count: u.Count}
+	}
+	return r, nil
+}
+
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Text is Report を Explanation.String と同じ表形式の文字列にする
+func (r *Report) Text() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "table\t%s\n", r.Table)
+	fmt.Fprintf(w, "op\t%s\n", r.Op)
+	fmt.Fprintf(w, "columns\t%s\n", strings.Join(r.Columns, ", "))
+	fmt.Fprintf(w, "per row\t%d\n", r.PerRow)
+	fmt.Fprintf(w, "limit\t%s(%d)\n", r.Profile, r.Limit)
+	fmt.Fprintf(w, "max rows\t%d\n", r.MaxRows)
+	w.Flush()
+
+	fmt.Fprintln(&buf)
+	w = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tOP\tKIND\tNAME\tRULE\tCOUNT")
+	for _, u := range r.Units {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", u.Table, u.Op, u.Kind, u.Name, u.Rule, u.Count)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// JSON is Report を indent した JSON にする
+func (r *Report) JSON() (string, error) {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// Markdown is Report を設計 Doc に貼り付けられる Markdown の表にする. 使ったルールの説明も付ける
+func (r *Report) Markdown() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "### %s %s\n\n", r.Table, r.Op)
+	fmt.Fprintln(&buf, "| | |")
+	fmt.Fprintln(&buf, "|---|---|")
+	columns := make([]string, len(r.Columns))
+	for i, c := range r.Columns {
+		columns[i] = "`" + c + "`"
+	}
+	fmt.Fprintf(&buf, "| Columns | %s |\n", strings.Join(columns, ", "))
+	fmt.Fprintf(&buf, "| Per row | %d |\n", r.PerRow)
+	fmt.Fprintf(&buf, "| Limit | %s (%d) |\n", r.Profile, r.Limit)
+	fmt.Fprintf(&buf, "| Max rows | %d |\n", r.MaxRows)
+
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "| Table | Op | Kind | Name | Rule | Count |")
+	fmt.Fprintln(&buf, "|---|---|---|---|---|---:|")
+	var rules []RuleID
+	for _, u := range r.Units {
+		fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s | %d |\n", u.Table, u.Op, u.Kind, u.Name, u.Rule, u.Count)
+		if id := RuleID(u.Rule); !containsRule(rules, id) {
+			rules = append(rules, id)
+		}
+	}
+	fmt.Fprintf(&buf, "| | | | | **Total** | **%d** |\n", r.PerRow)
+
+	fmt.Fprintln(&buf)
+	for _, id := range rules {
+		if rule := LookupRule(id); rule != nil {
+			fmt.Fprintf(&buf, "- **%s** (%s): %s\n", rule.ID, rule.Count, rule.Description)
+		}
+	}
+	return buf.String()
+}
+
+func containsRule(list []RuleID, id RuleID) bool {
+	for _, v := range list {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package estimator_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+func ExampleReport_Text() {
+	s, err := schema.ParseFile("../ddl/measure_composite_index.sql")
+	if err != nil {
+		panic(err)
+	}
+
+	// measure_composite_index_test.go TestMeasureCompositeIndex_Update の "withCompositeIndex : 3-N" の 1 行分
+	r, err := estimator.NewReport(s, "MeasureCompositeIndex", estimator.OpUpdate, []string{"WithCompositeIndex1"}, estimator.Legacy)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(r.Text())
+	// Output:
+	// table     MeasureCompositeIndex
+	// op        Update
+	// columns   ID, WithCompositeIndex1
+	// per row   4
+	// limit     legacy(20000)
+	// max rows  5000
+	//
+	// TABLE                  OP      KIND        NAME                                     RULE  COUNT
+	// MeasureCompositeIndex  Update  Column      ID                                       U1    1
+	// MeasureCompositeIndex  Update  Column      WithCompositeIndex1                      U1    1
+	// MeasureCompositeIndex  Update  IndexEntry  MeasureCompositeIndexWithCompositeIndex  U2    1
+	// MeasureCompositeIndex  Update  IndexEntry  MeasureCompositeIndexWithCompositeIndex  U3    1
+}
+
+func TestNewReport(t *testing.T) {
+	s, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name        string
+		table       string
+		op          estimator.Op
+		columns     []string
+		profile     estimator.Profile
+		wantColumns string
+		wantPerRow  int
+		wantMaxRows int
+		wantErr     bool
+	}{
+		// [1:ID, 2:Col1, 3:MeasureWithIndex1_1, 4:MeasureWithIndex2_1, 5:MeasureWithIndex2_2]
+		{"insert", "Measure", estimator.OpInsert, []string{"Col1"}, estimator.Legacy, "ID,Col1", 5, 4000, false},
+		// Primary Key を指定しても 1 回だけ数える. 大文字小文字は Schema に揃える
+		{"insert with key", "measure", estimator.OpInsert, []string{"id", "col1"}, estimator.Current, "ID,Col1", 5, 16000, false},
+		{"update", "Measure", estimator.OpUpdate, []string{"Col1"}, estimator.Legacy, "ID,Col1", 2, 10000, false},
+		{"delete", "Measure", estimator.OpDelete, nil, estimator.Legacy, "", 4, 5000, false},
+		{"delete with columns", "Measure", estimator.OpDelete, []string{"Col1"}, estimator.Legacy, "", 0, 0, true},
+		{"unknown table", "Hoge", estimator.OpInsert, nil, estimator.Legacy, "", 0, 0, true},
+		{"unknown column", "Measure", estimator.OpInsert, []string{"Hoge"}, estimator.Legacy, "", 0, 0, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := estimator.NewReport(s, tt.table, tt.op, tt.columns, tt.profile)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want err but got err is nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantColumns, strings.Join(r.Columns, ","); e != g {
+				t.Errorf("want columns %s but got %s", e, g)
+			}
+			if e, g := tt.wantPerRow, r.PerRow; e != g {
+				t.Errorf("want per row %d but got %d", e, g)
+			}
+			if e, g := tt.wantMaxRows, r.MaxRows; e != g {
+				t.Errorf("want max rows %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestReport_JSON(t *testing.T) {
+	s, err := schema.ParseFile("../ddl/measure.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := estimator.NewReport(s, "Measure", estimator.OpInsert, []string{"Col1"}, estimator.Legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got estimator.Report
+	if err := json.Unmarshal([]byte(b), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, &got) {
+		t.Errorf("want %+v but got %+v", r, &got)
+	}
+	if e, g := 5, len(got.Units); e != g {
+		t.Errorf("want units %d but got %d", e, g)
+	}
+}
+
+func TestReport_Markdown(t *testing.T) {
+	s, err := schema.ParseFile("../ddl/measure.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := estimator.NewReport(s, "Measure", estimator.OpInsert, []string{"Col1"}, estimator.Legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.Markdown()
+	for _, want := range []string{
+		"### Measure Insert\n",
+		"| Columns | `ID`, `Col1` |\n",
+		"| Max rows | 4000 |\n",
+		"| Measure | Insert | IndexEntry | MeasureWithIndex1_1 | I2 | 1 |\n",
+		"| | | | | **Total** | **5** |\n",
+		"- **I1** (1 per column): ",
+		"- **I2** (1 per index): ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in\n%s", want, got)
+		}
+	}
+}
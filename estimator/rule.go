@@ -0,0 +1,117 @@
+package estimator
+
+// RuleID is 見積もりのルールの ID. Unit がどのルールで数えられたかを示す
+type RuleID string
+
+const (
+	// RuleInsertColumn is INSERT 系で値を指定した Column
+	RuleInsertColumn RuleID = "I1"
+	// RuleInsertIndexEntry is INSERT 系で追加される Secondary Index の Entry
+	RuleInsertIndexEntry RuleID = "I2"
+
+	// RuleUpdateColumn is UPDATE で値を指定した Column
+	RuleUpdateColumn RuleID = "U1"
+	// RuleUpdateIndexDelete is UPDATE で Key が変わる Secondary Index の古い Entry の削除
+	RuleUpdateIndexDelete RuleID = "U2"
+	// RuleUpdateIndexInsert is UPDATE で Key が変わる Secondary Index の新しい Entry の追加
+	RuleUpdateIndexInsert RuleID = "U3"
+	// RuleUpdateStoring is UPDATE で STORING の Column だけが変わる Secondary Index の Entry の書き換え
+	RuleUpdateStoring RuleID = "U4"
+
+	// RuleDeleteRow is DELETE で指定した Key か KeyRange
+	RuleDeleteRow RuleID = "D1"
+	// RuleDeleteIndexEntry is DELETE で削除される Secondary Index の Entry
+	RuleDeleteIndexEntry RuleID = "D2"
+	// RuleDeleteCascadeIndexEntry is ON DELETE CASCADE で削除される子の Table の Secondary Index の Entry
+	RuleDeleteCascadeIndexEntry RuleID = "D3"
+)
+
+// Rule is 見積もりのルールの説明
+type Rule struct {
+	ID RuleID
+	// Ops is ルールが適用される操作
+	Ops []Op
+	// Count is 1 つの Mutation で数える数
+	Count string
+	// Description is 数える理由
+	Description string
+	// Evidence is ルールを確かめた measure_*_test.go の Case
+	Evidence []string
+}
+
+// Rules is すべてのルール. Unit の Rule はこの中のどれかになる
+var Rules = []*Rule{
+	{
+		ID:          RuleInsertColumn,
+		Ops:         []Op{OpInsert, OpInsertOrUpdate, OpReplace},
+		Count:       "1 per column",
+		Description: "値を指定した Column を 1 つずつ数える. Primary Key の Column も含む",
+		Evidence:    []string{"TestInsert"},
+	},
+	{
+		ID:          RuleInsertIndexEntry,
+		Ops:         []Op{OpInsert, OpInsertOrUpdate, OpReplace},
+		Count:       "1 per index",
+		Description: "Table が持つ Secondary Index ごとに Entry を 1 つ数える. Index の Column が NULL でも、値を指定していなくても数えられる",
+		Evidence:    []string{`TestInsert "empty : 4-N"`, `TestMeasureStoringIndex_Insert "empty : 5-N"`},
+	},
+	{
+		ID:          RuleUpdateColumn,
+		Ops:         []Op{OpUpdate},
+		Count:       "1 per column",
+		Description: "値を指定した Column を 1 つずつ数える. Primary Key の Column も含む",
+		Evidence:    []string{`TestUpdate "empty : 7-N"`, `TestUpdateDML "empty : 7-N"`},
+	},
+	{
+		ID:          RuleUpdateIndexDelete,
+		Ops:         []Op{OpUpdate},
+		Count:       "1 per index whose key column is written",
+		Description: "Key の Column のどれか 1 つに値を指定した Secondary Index は、古い Entry を削除する. 複合 Index でも 1 つだけ、DESC も ASC と同じ. 古い値が NULL でも数えられる",
+		Evidence:    []string{`TestUpdate "withIndex1 : 4-N"`, `TestUpdate "withIndex2 : 2-N"`, `TestMeasureCompositeIndex_Update "withCompositeIndex : 3-N"`},
+	},
+	{
+		ID:          RuleUpdateIndexInsert,
+		Ops:         []Op{OpUpdate},
+		Count:       "(1 + len(STORING)) per index whose key column is written",
+		Description: "Key が変わる Secondary Index は新しい Entry を追加する. 新しい Entry には STORING の Column をすべて書き写すので、値を指定していない STORING の Column も数えられる",
+		Evidence:    []string{`TestUpdate "withIndexAll : 0-N"`, `TestMeasureStoringIndex_Update "withIndex1 : 3-N"`},
+	},
+	{
+		ID:          RuleUpdateStoring,
+		Ops:         []Op{OpUpdate},
+		Count:       "(1 + written STORING columns) per index whose key is unchanged",
+		Description: "Key は変わらず STORING の Column に値を指定した Secondary Index は、Entry を 1 つ書き換えて、値を指定した STORING の Column を 1 つずつ数える. STORING の Column を 2 つ以上書き込んだ場合はまだ実測していない",
+		Evidence:    []string{`TestMeasureStoringIndex_Update "withStoringColumn1 : 2-N"`, `TestMeasureStoringIndex_Update "withStoringColumn2 : 4-N"`},
+	},
+	{
+		ID:          RuleDeleteRow,
+		Ops:         []Op{OpDelete},
+		Count:       "1 per key or key range",
+		Description: "削除する Key か KeyRange を 1 つずつ数える. Column の数には関係しない. KeyRange と AllKeys は範囲に含まれる行の数によらず 1 つとして数えるが、これはまだ実測していない",
+		Evidence:    []string{`TestMeasure_Delete`},
+	},
+	{
+		ID:          RuleDeleteIndexEntry,
+		Ops:         []Op{OpDelete},
+		Count:       "1 per key or key range and index",
+		Description: "Table が持つ Secondary Index ごとに、削除する Key か KeyRange を 1 つずつ数える",
+		Evidence:    []string{`TestMeasure_Delete "empty : 7-N"`},
+	},
+	{
+		ID:          RuleDeleteCascadeIndexEntry,
+		Ops:         []Op{OpDelete},
+		Count:       "1 per key or key range and child index",
+		Description: "ON DELETE CASCADE で削除される子の Table の行自体は数えないが、子の Table が持つ Secondary Index は親の Key ごとに 1 つ数える. 孫より深い階層も CASCADE で繋がっている限り同じく数える. NO ACTION の子は数えないので、子の Table の Delete を同じ Commit に入れる",
+		Evidence:    []string{`TestMeasureInterleave_Delete`, `TestMeasureInterleaveWithIndex_Delete`, `TestMeasureInterleaveNoCascade_Delete`},
+	},
+}
+
+// LookupRule is id のルールを返す. 見つからない場合は nil
+func LookupRule(id RuleID) *Rule {
+	for _, r := range Rules {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
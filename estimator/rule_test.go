@@ -0,0 +1,94 @@
+package estimator_test
+
+import (
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// TestUpdateRules is measure_*_test.go の UPDATE の Case の 1 行分の内訳をルールごとに確かめる
+// どの Case も 1 行が 10 (withIndexAll だけ 11) になるので、Limit 20000 で 2000 行 (1818 行) が境界になる
+func TestUpdateRules(t *testing.T) {
+	s, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty := make(map[string]interface{})
+
+	cases := []struct {
+		name              string
+		table             string
+		normalColumnCount int
+		updateColumn      map[string]interface{}
+		want              map[estimator.RuleID]int
+	}{
+		// TestUpdate, TestUpdateDML
+		{"Measure empty : 7", "Measure", 7, empty, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 10}},
+		// MeasureWithIndex1_1 の古い Entry の削除と新しい Entry の追加
+		{"Measure withIndex1 : 4", "Measure", 4, map[string]interface{}{"withIndex1": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 8, estimator.RuleUpdateIndexDelete: 1, estimator.RuleUpdateIndexInsert: 1}},
+		// MeasureWithIndex2_1 と DESC の MeasureWithIndex2_2 は同じ数になる
+		{"Measure withIndex2 : 2", "Measure", 2, map[string]interface{}{"withIndex2": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 6, estimator.RuleUpdateIndexDelete: 2, estimator.RuleUpdateIndexInsert: 2}},
+		// コメントで "9:?, 10:?, 11:?" になっていたのは 3 つの Index の古い Entry の削除
+		{"Measure withIndexAll : 0", "Measure", 0, map[string]interface{}{"withIndex1": "", "withIndex2": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 5, estimator.RuleUpdateIndexDelete: 3, estimator.RuleUpdateIndexInsert: 3}},
+
+		// TestMeasureCompositeIndex_Update. 複合 Index は Key の Column をいくつ書き込んでも Entry は 1 つ
+		{"Composite empty : 7", "MeasureCompositeIndex", 7, empty, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 10}},
+		{"Composite withCompositeIndex : 3", "MeasureCompositeIndex", 3, map[string]interface{}{"WithCompositeIndex1": "", "WithCompositeIndex2": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 8, estimator.RuleUpdateIndexDelete: 1, estimator.RuleUpdateIndexInsert: 1}},
+		{"Composite withCompositeIndex1 : 4", "MeasureCompositeIndex", 4, map[string]interface{}{"WithCompositeIndex1": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 8, estimator.RuleUpdateIndexDelete: 1, estimator.RuleUpdateIndexInsert: 1}},
+		{"Composite withCompositeIndex2 : 4", "MeasureCompositeIndex", 4, map[string]interface{}{"WithCompositeIndex2": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 8, estimator.RuleUpdateIndexDelete: 1, estimator.RuleUpdateIndexInsert: 1}},
+
+		// TestMeasureStoringIndex_Update
+		{"Storing empty : 7", "MeasureWithStoring", 7, empty, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 10}},
+		// 新しい Entry に STORING (Storing1) が書き写される
+		{"Storing withIndex1 : 3", "MeasureWithStoring", 3, map[string]interface{}{"WithIndex1": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 7, estimator.RuleUpdateIndexDelete: 1, estimator.RuleUpdateIndexInsert: 2}},
+		// Storing1 を STORING に持つ 2 つの Index がそれぞれ 2 になる
+		{"Storing withStoringColumn1 : 2", "MeasureWithStoring", 2, map[string]interface{}{"Storing1": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 6, estimator.RuleUpdateStoring: 4}},
+		{"Storing withStoringColumn2 : 4", "MeasureWithStoring", 4, map[string]interface{}{"Storing2": ""}, map[estimator.RuleID]int{estimator.RuleUpdateColumn: 8, estimator.RuleUpdateStoring: 2}},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mu := createUpdateMutation(tt.table, tt.normalColumnCount, tt.updateColumn, 1)
+			e, err := estimator.Explain(s, mu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[estimator.RuleID]int)
+			for _, u := range e.Units {
+				got[u.Rule] += u.Count
+			}
+			for id, w := range tt.want {
+				if e, g := w, got[id]; e != g {
+					t.Errorf("rule %s want %d but got %d", id, e, g)
+				}
+			}
+			for id, g := range got {
+				if _, ok := tt.want[id]; !ok {
+					t.Errorf("unexpected rule %s: %d", id, g)
+				}
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	seen := make(map[estimator.RuleID]bool)
+	for _, r := range estimator.Rules {
+		if seen[r.ID] {
+			t.Errorf("rule %s is duplicated", r.ID)
+		}
+		seen[r.ID] = true
+		if r.Description == "" || len(r.Ops) == 0 || len(r.Evidence) == 0 {
+			t.Errorf("rule %s is incomplete: %+v", r.ID, r)
+		}
+		if e, g := r, estimator.LookupRule(r.ID); e != g {
+			t.Errorf("LookupRule(%s) want %p but got %p", r.ID, e, g)
+		}
+	}
+	if g := estimator.LookupRule("X1"); g != nil {
+		t.Errorf("want nil but got %+v", g)
+	}
+}
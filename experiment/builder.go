@@ -0,0 +1,99 @@
+package experiment
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/keygen"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// builder is measure_*_test.go の create*Mutation と同じ形の行を作成する
+type builder struct {
+	table *schema.Table
+	child *schema.Table
+	mark  string
+	keys  keygen.Generator
+}
+
+func newBuilder(sc *schema.Schema, s *Spec, mark string, keys keygen.Generator) (*builder, error) {
+	b := &builder{table: sc.Table(s.Table), mark: mark, keys: keys}
+	if b.table == nil {
+		return nil, fmt.Errorf("table %s is not found in %s", s.Table, s.DDL)
+	}
+	if s.Child != "" {
+		b.child = sc.Table(s.Child)
+		if b.child == nil {
+			return nil, fmt.Errorf("table %s is not found in %s", s.Child, s.DDL)
+		}
+		if b.child.Interleave == nil || !strings.EqualFold(b.child.Interleave.Parent, b.table.Name) {
+			return nil, fmt.Errorf("table %s is not interleaved in %s", s.Child, s.Table)
+		}
+	}
+	return b, nil
+}
+
+// keyRow is Update や DML の前準備で Insert する、なるべく Mutation 数が小さくなる行
+func (b *builder) keyRow(id string) map[string]interface{} {
+	v := map[string]interface{}{"ID": id}
+	if b.mark != "" && b.table.Column("Mark") != nil {
+		v["Mark"] = b.mark
+	}
+	if b.table.Column("CommitedAt") != nil {
+		v["CommitedAt"] = spanner.CommitTimestamp
+	}
+	return v
+}
+
+// row is ID, Col1...ColN, columns, Arr1, CommitedAt に値を入れた行
+// mark が指定されている場合は ColN の代わりに Mark に値を入れる
+func (b *builder) row(id string, normalColumnCount int, columns map[string]interface{}, isParent bool) map[string]interface{} {
+	t := b.table
+	if !isParent {
+		t = b.child
+	}
+	v := make(map[string]interface{})
+	v["ID"] = id
+	n := normalColumnCount
+	if b.mark != "" && n > 0 && t.Column("Mark") != nil {
+		v["Mark"] = b.mark
+		n--
+	}
+	for j := 1; j <= n; j++ {
+		v[fmt.Sprintf("Col%d", j)] = ""
+	}
+	for k, value := range columns {
+		v[k] = value
+	}
+	if t.Column("Arr1") != nil {
+		v["Arr1"] = []string{}
+	}
+	if t.Column("CommitedAt") != nil {
+		v["CommitedAt"] = spanner.CommitTimestamp
+	}
+	return v
+}
+
+// insertRows is 親の行と、Child が指定されている場合は子の行を 1 つずつ作成する
+// keys には親の Key と子の Key が入る
+func (b *builder) insertRows(c *Case) ([]spanner.Key, []*spanner.Mutation, error) {
+	id := b.keys.Next()
+	keys := []spanner.Key{{id}}
+	ms := []*spanner.Mutation{spanner.InsertMap(b.table.Name, b.row(id, c.NormalColumnCount, c.Columns, true))}
+	if b.child == nil {
+		return keys, ms, nil
+	}
+
+	// 子は親の ID と子の Table の Secondary Index の分が増えているので、その分減らす
+	ncc := c.NormalColumnCount - 1 - len(b.child.Indexes)
+	if ncc < 0 {
+		return nil, nil, fmt.Errorf("invalid argument. plz normalColumnCount > 0")
+	}
+	childID := b.keys.Next()
+	v := b.row(id, ncc, c.Columns, false)
+	v["ChildID"] = childID
+	keys = append(keys, spanner.Key{id, childID})
+	ms = append(ms, spanner.InsertMap(b.child.Name, v))
+	return keys, ms, nil
+}
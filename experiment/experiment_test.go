@@ -0,0 +1,191 @@
+package experiment_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/applier"
+	"github.com/sinmetal/mutation_count_playground/cleanup"
+	"github.com/sinmetal/mutation_count_playground/experiment"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/keygen"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+func TestLoadDir(t *testing.T) {
+	specs, err := experiment.LoadDir("../experiments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) == 0 {
+		t.Fatal("want specs but got empty")
+	}
+	for _, s := range specs {
+		if _, err := os.Stat(filepath.Join("../ddl", s.DDL)); err != nil {
+			t.Errorf("%s: %v", s.Path, err)
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "experiment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name string
+		body string
+	}{
+		{"broken json", `{`},
+		{"no table", `{"name":"a","ddl":"measure.sql"}`},
+		{"unknown op", `{"name":"a","ddl":"measure.sql","table":"Measure","cases":[{"name":"c","op":"upsert","rowCount":1}]}`},
+		{"no rowCount", `{"name":"a","ddl":"measure.sql","table":"Measure","cases":[{"name":"c","op":"insert"}]}`},
+		{"rowCount and perRow", `{"name":"a","ddl":"measure.sql","table":"Measure","cases":[{"name":"c","op":"insert","rowCount":1,"perRow":10}]}`},
+		{"deleteChild without child", `{"name":"a","ddl":"measure.sql","table":"Measure","cases":[{"name":"c","op":"delete","rowCount":1,"deleteChild":true}]}`},
+		{"percent without perRow", `{"name":"a","ddl":"measure.sql","table":"Measure","cases":[{"name":"c","op":"insert","rowCount":1,"percent":50}]}`},
+		{"percent over 100", `{"name":"a","ddl":"measure.sql","table":"Measure","cases":[{"name":"c","op":"insert","perRow":10,"percent":101}]}`},
+		{"percent with wantErr", `{"name":"a","ddl":"measure.sql","table":"Measure","cases":[{"name":"c","op":"insert","perRow":10,"percent":50,"wantErr":true}]}`},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "spec.json")
+			if err := ioutil.WriteFile(path, []byte(tt.body), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := experiment.Load(path); err == nil {
+				t.Errorf("want err but got nil")
+			}
+		})
+	}
+}
+
+func TestRunner_Run(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	const database = "projects/fake/instances/fake/databases/fake"
+	s.AddDatabase(database, sc)
+	// 上限を下げて、PerRow の Case の行数が Limit から決まることを確かめる
+	s.Limit = 4000
+	client, err := s.NewClient(ctx, database, spanner.ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	spec := &experiment.Spec{
+		Name:  "MeasureInterleaveNoCascade",
+		DDL:   "measure_interleave_no_cascade.sql",
+		Table: "MeasureParentNoCascade",
+		Child: "MeasureChildNoCascade",
+		Cases: []*experiment.Case{
+			// 親と子で 1 行 20 なので 200 行と 201 行になる
+			{Name: "insert N", Op: experiment.Insert, NormalColumnCount: 7, PerRow: 20},
+			{Name: "insert N+1", Op: experiment.Insert, NormalColumnCount: 7, PerRow: 20, WantErr: true},
+			{Name: "delete 10", Op: experiment.Delete, NormalColumnCount: 7, RowCount: 10, DeleteChild: true},
+			// 上限に収まる 200 行の半分
+			{Name: "insert N*50%", Op: experiment.Insert, NormalColumnCount: 7, PerRow: 20, Percent: 50},
+		},
+	}
+	runner := &experiment.Runner{Client: applier.NewClient(client), DDLDir: "../ddl", Mark: "run-test", Limit: 4000}
+	results, err := runner.Run(ctx, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := len(spec.Cases), len(results); e != g {
+		t.Fatalf("want results %d but got %d", e, g)
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			t.Errorf("%s: want err %v but got %v", r.Case, r.WantErr, r.Err)
+		}
+	}
+	if e, g := 201, results[1].RowCount; e != g {
+		t.Errorf("want rows %d but got %d", e, g)
+	}
+	if e, g := 100, results[3].RowCount; e != g {
+		t.Errorf("want rows %d but got %d", e, g)
+	}
+	// fakespanner は Commit Stats に見積もった Mutation 数を返す. 失敗した Commit は 0
+	for i, want := range []int64{4000, 0, 20, 2000} {
+		if e, g := want, results[i].MutationCount; e != g {
+			t.Errorf("%s: want mutation count %d but got %d", results[i].Case, e, g)
+		}
+	}
+
+	// Runner が書き込んだ行はすべて Mark で削除できる
+	c := &cleanup.Cleaner{Client: client, Schema: sc}
+	if _, err := c.Clean(ctx, "run-test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{spec.Table, spec.Child} {
+		if e, g := 0, s.Database(database).RowCount(table); e != g {
+			t.Errorf("want %s rows %d but got %d", table, e, g)
+		}
+	}
+}
+
+func TestRunner_Keys(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &experiment.Spec{
+		Name:  "Measure",
+		DDL:   "measure.sql",
+		Table: "Measure",
+		Cases: []*experiment.Case{
+			{Name: "insert 3", Op: experiment.Insert, NormalColumnCount: 1, RowCount: 3},
+			{Name: "dml 2", Op: experiment.DML, NormalColumnCount: 1, RowCount: 2},
+		},
+	}
+
+	cases := []struct {
+		name string
+		keys keygen.Generator
+		want string
+		next string
+	}{
+		{"default", nil, "random", ""},
+		// insert の 3 行と、DML の Mark の 1 つと前準備の 2 行で 6 つ使う
+		{"sequential", keygen.NewSequential(1), "sequential:1", "00000000000000000007"},
+		{"bitreversed", keygen.NewBitReversed(0), "bitreversed:0", "6000000000000000"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &experiment.Runner{Client: applier.NewDryRun(sc, 100), DDLDir: "../ddl", Keys: tt.keys}
+			results, err := runner.Run(ctx, spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range results {
+				if e, g := tt.want, r.KeyGen; e != g {
+					t.Errorf("%s: want keygen %s but got %s", r.Case, e, g)
+				}
+			}
+			if tt.keys != nil {
+				if e, g := tt.next, tt.keys.Next(); e != g {
+					t.Errorf("want next key %s but got %s", e, g)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/applier"
+	"github.com/sinmetal/mutation_count_playground/batch"
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/keygen"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+)
+
+// Runner is Spec を Client に対して実行する. Client を applier.DryRun にすると Spanner に接続せずに見積もりだけで実行する
+type Runner struct {
+	Client applier.Applier
+
+	// DDLDir is Spec の DDL を探す Directory. 省略した場合は ddl
+	DDLDir string
+
+	// Mark is 書き込む行の Mark に入れる値. cleanup で実行ごとに行を削除するために使う
+	// 指定した場合は Col1...ColN の最後の 1 つの代わりに Mark に値を入れるので、Mutation 数は変わらない
+	Mark string
+
+	// Limit is Mutation 数の上限. Case の PerRow から行数を決めるのに使う. 0 の場合は estimator.DefaultLimit
+	Limit int
+
+	// Keys is 書き込む行の ID と、DML の対象を絞り込む Mark の後ろに付ける値を作る. nil の場合は keygen.Random
+	Keys keygen.Generator
+}
+
+// Result is 1 つの Case を実行した結果
+type Result struct {
+	Spec     string
+	Case     string
+	Op       Op
+	RowCount int
+	WantErr  bool
+
+	// Err is 計測した操作が返した error
+	Err error
+
+	// MutationCount is 計測した操作の Commit で Spanner が返した Commit Stats の mutation_count
+	// Commit が失敗した場合と、接続先が Commit Stats を返さなかった場合は 0. applier.DryRun の場合は見積もった Mutation 数
+	MutationCount int64
+
+	// KeyGen is 行の Key を作った Generator. keygen.Parse で作り直すと同じ Key で再現できる
+	KeyGen string
+}
+
+// Passed is 結果が Case の期待通りかどうかを返す
+func (r *Result) Passed() bool {
+	if r.WantErr {
+		return spanerr.IsMutationLimit(r.Err)
+	}
+	return r.Err == nil
+}
+
+func (r *Runner) limit() int {
+	if r.Limit > 0 {
+		return r.Limit
+	}
+	return estimator.DefaultLimit
+}
+
+func (r *Runner) keys() keygen.Generator {
+	if r.Keys != nil {
+		return r.Keys
+	}
+	return keygen.Random()
+}
+
+func (r *Runner) ddlDir() string {
+	if r.DDLDir != "" {
+		return r.DDLDir
+	}
+	return "ddl"
+}
+
+// Run is Spec のすべての Case を順に実行する
+// 前準備の書き込みに失敗した場合はそこで止めて error を返す
+func (r *Runner) Run(ctx context.Context, s *Spec) ([]*Result, error) {
+	var list []*Result
+	for _, c := range s.Cases {
+		res, err := r.RunCase(ctx, s, c)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, res)
+	}
+	return list, nil
+}
+
+// RunCase is 1 つの Case を実行する
+// 計測した操作の error は Result.Err に入れ、前準備に失敗した場合は error を返す
+func (r *Runner) RunCase(ctx context.Context, s *Spec, c *Case) (*Result, error) {
+	sc, err := schema.ParseFile(filepath.Join(r.ddlDir(), s.DDL))
+	if err != nil {
+		return nil, err
+	}
+	keys := r.keys()
+	b, err := newBuilder(sc, s, r.Mark, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	rowCount := c.Rows(r.limit())
+	res := &Result{Spec: s.Name, Case: c.Name, Op: c.Op, RowCount: rowCount, WantErr: c.WantErr, KeyGen: keys.String()}
+	// 計測する Commit だけ Commit Stats を受け取る
+	rec := &commitstats.Recorder{}
+	mctx := commitstats.WithRecorder(ctx, rec)
+	switch c.Op {
+	case Insert:
+		var ms []*spanner.Mutation
+		for i := 0; i < rowCount; i++ {
+			_, rows, err := b.insertRows(c)
+			if err != nil {
+				return nil, err
+			}
+			ms = append(ms, rows...)
+		}
+		_, res.Err = r.Client.Apply(mctx, ms)
+	case Update:
+		var setup, ms []*spanner.Mutation
+		for i := 0; i < rowCount; i++ {
+			id := keys.Next()
+			setup = append(setup, spanner.InsertMap(b.table.Name, b.keyRow(id)))
+			ms = append(ms, spanner.UpdateMap(b.table.Name, b.row(id, c.NormalColumnCount, c.Columns, true)))
+		}
+		if err := r.setup(ctx, sc, setup); err != nil {
+			return nil, err
+		}
+		_, res.Err = r.Client.Apply(mctx, ms)
+	case Delete:
+		var setup, children, parents []*spanner.Mutation
+		for i := 0; i < rowCount; i++ {
+			keys, rows, err := b.insertRows(c)
+			if err != nil {
+				return nil, err
+			}
+			setup = append(setup, rows...)
+			parents = append(parents, spanner.Delete(b.table.Name, keys[0]))
+			if c.DeleteChild {
+				children = append(children, spanner.Delete(b.child.Name, keys[1]))
+			}
+		}
+		if err := r.setup(ctx, sc, setup); err != nil {
+			return nil, err
+		}
+		_, res.Err = r.Client.Apply(mctx, append(children, parents...))
+	case DML:
+		mark := keys.Next()
+		if r.Mark != "" {
+			mark = r.Mark + "/" + mark
+		}
+		var setup []*spanner.Mutation
+		for i := 0; i < rowCount; i++ {
+			v := b.keyRow(keys.Next())
+			v["Mark"] = mark
+			setup = append(setup, spanner.InsertMap(b.table.Name, v))
+		}
+		if err := r.setup(ctx, sc, setup); err != nil {
+			return nil, err
+		}
+		sql := updateDML(b.table.Name, c.NormalColumnCount, c.Columns)
+		_, res.Err = r.Client.Update(mctx, spanner.Statement{SQL: sql, Params: map[string]interface{}{"mark": mark}})
+	default:
+		return nil, fmt.Errorf("unknown op %q", c.Op)
+	}
+	if n, ok := rec.Last(); ok && res.Err == nil {
+		res.MutationCount = n
+	}
+	return res, nil
+}
+
+// setup is 前準備の行を上限に収まるように分けて書き込む
+func (r *Runner) setup(ctx context.Context, sc *schema.Schema, ms []*spanner.Mutation) error {
+	w := &batch.Writer{Applier: r.Client, Schema: sc, Limit: r.Limit}
+	results, err := w.Apply(ctx, ms)
+	if err != nil {
+		return err
+	}
+	if err := batch.FirstError(results); err != nil {
+		return fmt.Errorf("failed setup: %v", err)
+	}
+	return nil
+}
+
+// updateDML is measure_test.go の createUpdateDML と同じ形の UPDATE を作成する
+// 対象の行は @mark で絞り込む
+func updateDML(table string, normalColumnCount int, columns map[string]interface{}) string {
+	sets := []string{"Arr1 = []", `CommitedAt = "2019-01-01 10:00:00"`}
+	for j := 1; j <= normalColumnCount; j++ {
+		sets = append(sets, fmt.Sprintf(`Col%d = ""`, j))
+	}
+	for _, k := range sortedKeys(columns) {
+		sets = append(sets, fmt.Sprintf(`%s = "%v"`, k, columns[k]))
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE Mark = @mark", table, strings.Join(sets, ","))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
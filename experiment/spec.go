@@ -0,0 +1,180 @@
+// Package experiment is JSON で書いた計測の Spec を読み込んで実行する
+//
+// measure_*_test.go と同じく、Case ごとに前準備の行を書き込んでから対象の操作を 1 つの Commit で行い、
+// Mutation 数の上限で失敗したかどうかを Spec の期待値と比べる
+// 上限の境界を調べる Case は rowCount の代わりに 1 行の Mutation 数 perRow を書き、行数は Runner の Limit から決める
+// 上限より少ない行数を調べる Case は perRow と一緒に percent を書き、上限に収まる最大の行数の percent % にする
+//
+//	{
+//	  "name": "Measure",
+//	  "ddl": "measure.sql",
+//	  "table": "Measure",
+//	  "cases": [
+//	    {"name": "empty : 4-N*50%", "op": "insert", "normalColumnCount": 4, "perRow": 10, "percent": 50, "wantErr": false},
+//	    {"name": "withIndex1 : 3-N+1", "op": "insert", "normalColumnCount": 3, "columns": {"withIndex1": ""}, "perRow": 10, "wantErr": true}
+//	  ]
+//	}
+package experiment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/sinmetal/mutation_count_playground/estimator"
+)
+
+// Op is Case で行う操作
+type Op string
+
+const (
+	// Insert is InsertMap で行を書き込む
+	Insert Op = "insert"
+	// Update is 先に Insert した行を UpdateMap で更新する
+	Update Op = "update"
+	// Delete is 先に Insert した行を Delete する
+	Delete Op = "delete"
+	// DML is 先に Insert した行を DML の UPDATE で更新する
+	DML Op = "dml"
+)
+
+// Spec is 1 つの file に書かれた計測
+type Spec struct {
+	Name string `json:"name"`
+
+	// DDL is Table が定義されている ddl/ の下の file 名
+	DDL string `json:"ddl"`
+
+	// Table is 対象の Table
+	Table string `json:"table"`
+
+	// Child is Interleave の子の Table. 指定すると親の行 1 つにつき子の行を 1 つ作る
+	Child string `json:"child,omitempty"`
+
+	Cases []*Case `json:"cases"`
+
+	// Path is Spec を読み込んだ file の path
+	Path string `json:"-"`
+}
+
+// Case is 1 回の計測
+type Case struct {
+	Name string `json:"name"`
+	Op   Op     `json:"op"`
+
+	// NormalColumnCount is 値を入れる Col1, Col2... の数. 子の行は親の ID と子の Table の Secondary Index の数だけ減らす
+	NormalColumnCount int `json:"normalColumnCount"`
+
+	// Columns is NormalColumnCount の他に値を入れる Column
+	Columns map[string]interface{} `json:"columns,omitempty"`
+
+	// RowCount is 1 つの Commit で操作する行数
+	RowCount int `json:"rowCount,omitempty"`
+
+	// PerRow is 1 行の Mutation 数. RowCount の代わりに指定すると、Runner の Limit から行数を決める
+	// WantErr が false の場合は上限に収まる最大の行数、true の場合はその 1 行多い行数になる
+	PerRow int `json:"perRow,omitempty"`
+
+	// Percent is PerRow と一緒に指定すると、上限に収まる最大の行数の Percent % の行数にする. 1 から 100 まで
+	Percent int `json:"percent,omitempty"`
+
+	// DeleteChild is Delete の時に子の行も明示的に削除する. ON DELETE NO ACTION の Table で使う
+	DeleteChild bool `json:"deleteChild,omitempty"`
+
+	// WantErr is Mutation 数の上限で失敗することを期待する
+	WantErr bool `json:"wantErr"`
+}
+
+// Rows is limit の時に 1 つの Commit で操作する行数
+func (c *Case) Rows(limit int) int {
+	if c.PerRow < 1 {
+		return c.RowCount
+	}
+	n := estimator.Profile{Limit: limit}.MaxRows(c.PerRow)
+	if c.Percent > 0 {
+		return n * c.Percent / 100
+	}
+	if c.WantErr {
+		n++
+	}
+	return n
+}
+
+// Load is JSON の Spec を読み込む
+func Load(path string) (*Spec, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Spec
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("failed parse %s: %v", path, err)
+	}
+	s.Path = path
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid spec %s: %v", path, err)
+	}
+	return &s, nil
+}
+
+// LoadDir is dir の下の *.json を file 名の順に読み込む
+func LoadDir(dir string) ([]*Spec, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var list []*Spec
+	for _, f := range files {
+		s, err := Load(f)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// Validate is Spec に必要な値が揃っているかを確認する
+func (s *Spec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.DDL == "" {
+		return fmt.Errorf("ddl is required")
+	}
+	if s.Table == "" {
+		return fmt.Errorf("table is required")
+	}
+	for i, c := range s.Cases {
+		if c.Name == "" {
+			return fmt.Errorf("cases[%d].name is required", i)
+		}
+		switch c.Op {
+		case Insert, Update, Delete, DML:
+		default:
+			return fmt.Errorf("cases[%d].op %q is unknown", i, c.Op)
+		}
+		if c.RowCount < 1 && c.PerRow < 1 {
+			return fmt.Errorf("cases[%d].rowCount or perRow must be greater than 0", i)
+		}
+		if c.RowCount > 0 && c.PerRow > 0 {
+			return fmt.Errorf("cases[%d] can not have both rowCount and perRow", i)
+		}
+		if c.Percent != 0 && (c.PerRow < 1 || c.Percent < 1 || c.Percent > 100) {
+			return fmt.Errorf("cases[%d].percent must be between 1 and 100 with perRow", i)
+		}
+		if c.Percent != 0 && c.WantErr {
+			return fmt.Errorf("cases[%d].percent can not be used with wantErr", i)
+		}
+		if s.Child != "" && c.NormalColumnCount < 1 {
+			return fmt.Errorf("cases[%d].normalColumnCount must be greater than 0 for interleaved table", i)
+		}
+		if c.DeleteChild && s.Child == "" {
+			return fmt.Errorf("cases[%d].deleteChild requires child", i)
+		}
+	}
+	return nil
+}
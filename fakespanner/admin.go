@@ -0,0 +1,144 @@
+package fakespanner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	lropb "google.golang.org/genproto/googleapis/longrunning"
+	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var createDatabaseStatement = regexp.MustCompile("(?is)^\\s*CREATE\\s+DATABASE\\s+`?([a-z][a-z0-9_\\-]*)`?\\s*$")
+
+// adminServer is adminpb.DatabaseAdminServer の実装
+// Operation はすべて完了した状態で返すので、longrunning の Operations Server は持たない
+type adminServer struct {
+	s *Server
+}
+
+func (as *adminServer) ListDatabases(ctx context.Context, req *adminpb.ListDatabasesRequest) (*adminpb.ListDatabasesResponse, error) {
+	as.s.mu.Lock()
+	defer as.s.mu.Unlock()
+
+	var names []string
+	for name := range as.s.databases {
+		if strings.HasPrefix(name, req.Parent+"/databases/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	res := &adminpb.ListDatabasesResponse{}
+	for _, name := range names {
+		res.Databases = append(res.Databases, &adminpb.Database{Name: name, State: adminpb.Database_READY})
+	}
+	return res, nil
+}
+
+func (as *adminServer) CreateDatabase(ctx context.Context, req *adminpb.CreateDatabaseRequest) (*lropb.Operation, error) {
+	m := createDatabaseStatement.FindStringSubmatch(req.CreateStatement)
+	if m == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid create statement: %s", req.CreateStatement)
+	}
+	name := fmt.Sprintf("%s/databases/%s", req.Parent, m[1])
+	if as.s.Database(name) != nil {
+		return nil, status.Errorf(codes.AlreadyExists, "Database already exists: %s", name)
+	}
+
+	db := newDatabase(name, &schema.Schema{})
+	if len(req.ExtraStatements) > 0 {
+		if err := db.updateDDL(req.ExtraStatements); err != nil {
+			return nil, err
+		}
+	}
+	as.s.mu.Lock()
+	as.s.databases[name] = db
+	as.s.mu.Unlock()
+
+	return doneOperation(fmt.Sprintf("%s/operations/%d", name, as.s.nextID()), &adminpb.Database{Name: name, State: adminpb.Database_READY})
+}
+
+func (as *adminServer) GetDatabase(ctx context.Context, req *adminpb.GetDatabaseRequest) (*adminpb.Database, error) {
+	if _, err := as.database(req.Name); err != nil {
+		return nil, err
+	}
+	return &adminpb.Database{Name: req.Name, State: adminpb.Database_READY}, nil
+}
+
+func (as *adminServer) UpdateDatabaseDdl(ctx context.Context, req *adminpb.UpdateDatabaseDdlRequest) (*lropb.Operation, error) {
+	db, err := as.database(req.Database)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.updateDDL(req.Statements); err != nil {
+		return nil, err
+	}
+	return doneOperation(fmt.Sprintf("%s/operations/%d", req.Database, as.s.nextID()), &empty.Empty{})
+}
+
+func (as *adminServer) DropDatabase(ctx context.Context, req *adminpb.DropDatabaseRequest) (*empty.Empty, error) {
+	as.s.mu.Lock()
+	defer as.s.mu.Unlock()
+
+	db, ok := as.s.databases[req.Database]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Database not found: %s", req.Database)
+	}
+	delete(as.s.databases, req.Database)
+	for name, v := range as.s.sessions {
+		if v == db {
+			delete(as.s.sessions, name)
+		}
+	}
+	return &empty.Empty{}, nil
+}
+
+func (as *adminServer) GetDatabaseDdl(ctx context.Context, req *adminpb.GetDatabaseDdlRequest) (*adminpb.GetDatabaseDdlResponse, error) {
+	db, err := as.database(req.Database)
+	if err != nil {
+		return nil, err
+	}
+	return &adminpb.GetDatabaseDdlResponse{Statements: db.DDL()}, nil
+}
+
+func (as *adminServer) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespanner does not support SetIamPolicy")
+}
+
+func (as *adminServer) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespanner does not support GetIamPolicy")
+}
+
+func (as *adminServer) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespanner does not support TestIamPermissions")
+}
+
+func (as *adminServer) database(name string) (*Database, error) {
+	db := as.s.Database(name)
+	if db == nil {
+		return nil, status.Errorf(codes.NotFound, "Database not found: %s", name)
+	}
+	return db, nil
+}
+
+// doneOperation is 完了済みの Operation を作成する
+func doneOperation(name string, res proto.Message) (*lropb.Operation, error) {
+	any, err := ptypes.MarshalAny(res)
+	if err != nil {
+		return nil, err
+	}
+	return &lropb.Operation{
+		Name:   name,
+		Done:   true,
+		Result: &lropb.Operation_Response{Response: any},
+	}, nil
+}
@@ -0,0 +1,520 @@
+package fakespanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/sinmetal/mutation_count_playground/dml"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// commitTimestampPlaceholder is spanner.CommitTimestamp を書き込んだ時に送られてくる値
+const commitTimestampPlaceholder = "spanner.commit_timestamp()"
+
+// Database is Fake Server 上の Database
+type Database struct {
+	name string
+
+	mu     sync.Mutex
+	schema *schema.Schema
+	ddl    []string
+	tables map[string]*tableData
+	lastTS time.Time
+}
+
+// tableData is Table の行
+type tableData struct {
+	table *schema.Table
+	rows  map[string]*row
+	// parentKeyLen is Interleave の親の Table の Primary Key の長さ
+	parentKeyLen int
+	// children is Interleave の親の Key ごとの子の行の Key. 親の Table の Key の長さで切った Key で引く
+	children map[string]map[string]bool
+}
+
+type row struct {
+	key  []*structpb.Value
+	cols map[string]*structpb.Value
+}
+
+func newDatabase(name string, sc *schema.Schema) *Database {
+	db := &Database{
+		name:   name,
+		tables: make(map[string]*tableData),
+	}
+	db.setSchema(sc)
+	return db
+}
+
+// setSchema is Schema を差し替える. 既にある Table の行は残し、新しい Table は空で作成する
+func (db *Database) setSchema(sc *schema.Schema) {
+	db.schema = sc
+	tables := make(map[string]*tableData)
+	for _, t := range sc.Tables {
+		key := strings.ToLower(t.Name)
+		td, ok := db.tables[key]
+		if !ok {
+			td = &tableData{
+				rows:     make(map[string]*row),
+				children: make(map[string]map[string]bool),
+			}
+		}
+		td.table = t
+		tables[key] = td
+	}
+	for _, td := range tables {
+		if td.table.Interleave == nil {
+			continue
+		}
+		if parent := sc.Table(td.table.Interleave.Parent); parent != nil {
+			td.parentKeyLen = len(parent.PrimaryKey)
+		}
+	}
+	db.tables = tables
+}
+
+// updateDDL is statements を今の DDL に追加して Schema を作り直す
+func (db *Database) updateDDL(statements []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ddl := append(append([]string{}, db.ddl...), statements...)
+	sc, err := schema.Parse(strings.Join(ddl, ";\n"))
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	db.ddl = ddl
+	db.setSchema(sc)
+	return nil
+}
+
+// DDL is Admin API で適用された DDL の Statement
+func (db *Database) DDL() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return append([]string{}, db.ddl...)
+}
+
+// Schema is Database の Schema
+func (db *Database) Schema() *schema.Schema {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.schema
+}
+
+// RowCount is table の行数を返す
+func (db *Database) RowCount(table string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	td, ok := db.tables[strings.ToLower(table)]
+	if !ok {
+		return 0
+	}
+	return len(td.rows)
+}
+
+// undo is Commit の途中で失敗した時に元に戻すための記録
+type undo struct {
+	td  *tableData
+	key string
+	old *row
+}
+
+// commit is mutations を Mutation 数を確認してから 1 つの Commit として適用する. 見積もった Mutation 数も返す
+func (db *Database) commit(mutations []*sppb.Mutation, limit int) (time.Time, int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ms, err := estimator.FromProtoAll(mutations)
+	if err != nil {
+		return time.Time{}, 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	count, err := estimator.CountMutations(db.schema, ms)
+	if err != nil {
+		return time.Time{}, 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if count > limit {
+		return time.Time{}, 0, status.Errorf(codes.InvalidArgument, spanerr.TooManyMutationsFormat, limit)
+	}
+
+	ts := time.Now().UTC()
+	if !ts.After(db.lastTS) {
+		ts = db.lastTS.Add(time.Microsecond)
+	}
+	var undos []*undo
+	for _, m := range mutations {
+		if err := db.apply(m, ts, &undos); err != nil {
+			for i := len(undos) - 1; i >= 0; i-- {
+				u := undos[i]
+				if u.old == nil {
+					u.td.remove(u.key)
+				} else {
+					u.td.put(u.key, u.old)
+				}
+			}
+			return time.Time{}, 0, err
+		}
+	}
+	db.lastTS = ts
+	return ts, count, nil
+}
+
+func (db *Database) table(name string) (*tableData, error) {
+	td, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Table not found: %s", name)
+	}
+	return td, nil
+}
+
+func (db *Database) apply(m *sppb.Mutation, ts time.Time, undos *[]*undo) error {
+	switch v := m.Operation.(type) {
+	case *sppb.Mutation_Insert:
+		return db.write(v.Insert, ts, undos, true, false, false)
+	case *sppb.Mutation_InsertOrUpdate:
+		return db.write(v.InsertOrUpdate, ts, undos, true, true, false)
+	case *sppb.Mutation_Replace:
+		return db.write(v.Replace, ts, undos, true, true, true)
+	case *sppb.Mutation_Update:
+		return db.write(v.Update, ts, undos, false, true, false)
+	case *sppb.Mutation_Delete_:
+		td, err := db.table(v.Delete.Table)
+		if err != nil {
+			return err
+		}
+		return db.deleteKeySet(td, v.Delete.KeySet, undos)
+	default:
+		return status.Errorf(codes.InvalidArgument, "unsupported mutation %T", m.Operation)
+	}
+}
+
+// write is Insert, InsertOrUpdate, Replace, Update を適用する
+// canInsert は行が無い時に作成するかどうか、canUpdate は行がある時に上書きするかどうか、replace は指定されていない Column を NULL にするかどうか
+func (db *Database) write(w *sppb.Mutation_Write, ts time.Time, undos *[]*undo, canInsert, canUpdate, replace bool) error {
+	td, err := db.table(w.Table)
+	if err != nil {
+		return err
+	}
+	t := td.table
+	columns := make([]string, len(w.Columns))
+	for i, c := range w.Columns {
+		col := t.Column(c)
+		if col == nil {
+			return status.Errorf(codes.NotFound, "Column not found in table %s: %s", t.Name, c)
+		}
+		columns[i] = strings.ToLower(col.Name)
+	}
+
+	for _, lv := range w.Values {
+		if len(lv.Values) != len(columns) {
+			return status.Errorf(codes.InvalidArgument, "Mutation has %d columns but %d values", len(columns), len(lv.Values))
+		}
+		cols := make(map[string]*structpb.Value)
+		for i, c := range columns {
+			v := lv.Values[i]
+			if sv, ok := v.Kind.(*structpb.Value_StringValue); ok && sv.StringValue == commitTimestampPlaceholder {
+				v = stringValue(ts.Format(time.RFC3339Nano))
+			}
+			cols[c] = v
+		}
+		key := make([]*structpb.Value, len(t.PrimaryKey))
+		for i, k := range t.PrimaryKey {
+			v, ok := cols[strings.ToLower(k.Column)]
+			if !ok {
+				return status.Errorf(codes.FailedPrecondition, "Primary key column %s is not specified for table %s", k.Column, t.Name)
+			}
+			key[i] = v
+		}
+		ks := encodeKey(key)
+
+		old, exists := td.rows[ks]
+		switch {
+		case exists && !canUpdate:
+			return status.Errorf(codes.AlreadyExists, "Row %s in table %s already exists", ks, t.Name)
+		case !exists && !canInsert:
+			return status.Errorf(codes.NotFound, "Row %s not found in table %s", ks, t.Name)
+		}
+		if !exists && t.Interleave != nil {
+			parent, err := db.table(t.Interleave.Parent)
+			if err != nil {
+				return err
+			}
+			if _, ok := parent.rows[encodeKey(key[:len(parent.table.PrimaryKey)])]; !ok {
+				return status.Errorf(codes.NotFound, "Parent row for row %s in table %s is missing", ks, t.Name)
+			}
+		}
+
+		nr := &row{key: key, cols: cols}
+		if exists && !replace {
+			nr.cols = make(map[string]*structpb.Value)
+			for c, v := range old.cols {
+				nr.cols[c] = v
+			}
+			for c, v := range cols {
+				nr.cols[c] = v
+			}
+		}
+		*undos = append(*undos, &undo{td: td, key: ks, old: old})
+		td.put(ks, nr)
+	}
+	return nil
+}
+
+// deleteKeySet is KeySet に含まれる行を削除する
+func (db *Database) deleteKeySet(td *tableData, ks *sppb.KeySet, undos *[]*undo) error {
+	if ks == nil {
+		return nil
+	}
+	var targets []string
+	if ks.All {
+		for k := range td.rows {
+			targets = append(targets, k)
+		}
+	} else {
+		for _, lv := range ks.Keys {
+			targets = append(targets, encodeKey(lv.Values))
+		}
+		if len(ks.Ranges) > 0 {
+			for k, r := range td.rows {
+				for _, kr := range ks.Ranges {
+					if inRange(r.key, kr) {
+						targets = append(targets, k)
+						break
+					}
+				}
+			}
+		}
+	}
+	for _, k := range targets {
+		if err := db.deleteRow(td, k, undos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRow is 行を削除する. ON DELETE CASCADE の子の行も削除し、NO ACTION の子の行が残っている場合は失敗する
+func (db *Database) deleteRow(td *tableData, key string, undos *[]*undo) error {
+	old, ok := td.rows[key]
+	if !ok {
+		return nil
+	}
+	for _, child := range db.tables {
+		if child.table.Interleave == nil || !strings.EqualFold(child.table.Interleave.Parent, td.table.Name) {
+			continue
+		}
+		keys := child.children[key]
+		if len(keys) == 0 {
+			continue
+		}
+		if child.table.Interleave.OnDelete != schema.Cascade {
+			return status.Errorf(codes.FailedPrecondition, "Integrity constraint violation during DELETE/REPLACE. Found child row in table %s for row %s in table %s", child.table.Name, key, td.table.Name)
+		}
+		var childKeys []string
+		for k := range keys {
+			childKeys = append(childKeys, k)
+		}
+		for _, k := range childKeys {
+			if err := db.deleteRow(child, k, undos); err != nil {
+				return err
+			}
+		}
+	}
+	*undos = append(*undos, &undo{td: td, key: key, old: old})
+	td.remove(key)
+	return nil
+}
+
+func (td *tableData) put(key string, r *row) {
+	td.rows[key] = r
+	if td.table.Interleave == nil {
+		return
+	}
+	pk := td.parentKey(r)
+	if td.children[pk] == nil {
+		td.children[pk] = make(map[string]bool)
+	}
+	td.children[pk][key] = true
+}
+
+func (td *tableData) remove(key string) {
+	r, ok := td.rows[key]
+	if !ok {
+		return
+	}
+	delete(td.rows, key)
+	if td.table.Interleave == nil {
+		return
+	}
+	pk := td.parentKey(r)
+	delete(td.children[pk], key)
+	if len(td.children[pk]) == 0 {
+		delete(td.children, pk)
+	}
+}
+
+// parentKey is 子の行の Key のうち、親の Table の Key にあたる部分を encode する
+// Interleave の子の Primary Key は親の Primary Key から始まる
+func (td *tableData) parentKey(r *row) string {
+	return encodeKey(r.key[:td.parentKeyLen])
+}
+
+// updateMutation is DML の UPDATE を対象の行の Update Mutation に変換する
+// DML も UpdateMap と同じく Primary Key と SET の Column を書き込んだものとして数えられる
+func (db *Database) updateMutation(sql string, params *structpb.Struct) (*sppb.Mutation, int64, error) {
+	u, err := dml.ParseUpdate(sql)
+	if err != nil {
+		return nil, 0, status.Errorf(codes.InvalidArgument, "%v. sql=%s", err, sql)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	td, err := db.table(u.Table)
+	if err != nil {
+		return nil, 0, err
+	}
+	t := td.table
+	w := &sppb.Mutation_Write{Table: t.Name}
+	for _, k := range t.PrimaryKey {
+		w.Columns = append(w.Columns, k.Column)
+	}
+	var setValues []*structpb.Value
+	for _, a := range u.Set {
+		col := t.Column(a.Column)
+		if col == nil {
+			return nil, 0, status.Errorf(codes.InvalidArgument, "Unrecognized name: %s", a.Column)
+		}
+		if t.IsKeyColumn(col.Name) {
+			return nil, 0, status.Errorf(codes.InvalidArgument, "Cannot UPDATE value on non-writable column: %s", col.Name)
+		}
+		v, err := toProtoValue(a.Value, params)
+		if err != nil {
+			return nil, 0, err
+		}
+		w.Columns = append(w.Columns, col.Name)
+		setValues = append(setValues, v)
+	}
+
+	for _, r := range td.rows {
+		ok, err := matchRow(t, r, u.Where, params)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !ok {
+			continue
+		}
+		lv := &structpb.ListValue{}
+		lv.Values = append(lv.Values, r.key...)
+		lv.Values = append(lv.Values, setValues...)
+		w.Values = append(w.Values, lv)
+	}
+	if len(w.Values) == 0 {
+		return nil, 0, nil
+	}
+	return &sppb.Mutation{Operation: &sppb.Mutation_Update{Update: w}}, int64(len(w.Values)), nil
+}
+
+// query is SELECT を実行して、結果の Column の型と Primary Key の順に並べた行を返す
+func (db *Database) query(sql string, params *structpb.Struct) (*sppb.StructType, [][]*structpb.Value, error) {
+	sel, err := dml.ParseSelect(sql)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "%v. sql=%s", err, sql)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	td, err := db.table(sel.Table)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := td.table
+	rowType := &sppb.StructType{}
+	for _, name := range sel.Columns {
+		col := t.Column(name)
+		if col == nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "Unrecognized name: %s", name)
+		}
+		rowType.Fields = append(rowType.Fields, &sppb.StructType_Field{Name: col.Name, Type: columnType(col.Type)})
+	}
+
+	var matched []*row
+	for _, r := range td.rows {
+		ok, err := matchRow(t, r, sel.Where, params)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			matched = append(matched, r)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return compareKey(matched[i].key, matched[j].key) < 0
+	})
+
+	var rows [][]*structpb.Value
+	for _, r := range matched {
+		values := make([]*structpb.Value, len(rowType.Fields))
+		for i, f := range rowType.Fields {
+			v, ok := r.cols[strings.ToLower(f.Name)]
+			if !ok {
+				v = &structpb.Value{Kind: &structpb.Value_NullValue{}}
+			}
+			values[i] = v
+		}
+		rows = append(rows, values)
+	}
+	return rowType, rows, nil
+}
+
+// matchRow is 行が WHERE 句の条件をすべて満たすかどうかを返す
+func matchRow(t *schema.Table, r *row, where []*dml.Condition, params *structpb.Struct) (bool, error) {
+	for _, c := range where {
+		col := t.Column(c.Column)
+		if col == nil {
+			return false, status.Errorf(codes.InvalidArgument, "Unrecognized name: %s", c.Column)
+		}
+		want, err := toProtoValue(c.Value, params)
+		if err != nil {
+			return false, err
+		}
+		got, ok := r.cols[strings.ToLower(col.Name)]
+		if !ok || got.GetKind() == nil {
+			return false, nil
+		}
+		if _, ok := got.Kind.(*structpb.Value_NullValue); ok {
+			return false, nil
+		}
+		switch c.Op {
+		case dml.Equal:
+			if compareValue(got, want) != 0 {
+				return false, nil
+			}
+		case dml.StartsWith:
+			if !strings.HasPrefix(got.GetStringValue(), want.GetStringValue()) {
+				return false, nil
+			}
+		default:
+			return false, status.Errorf(codes.InvalidArgument, "unsupported condition %v", c.Op)
+		}
+	}
+	return true, nil
+}
+
+// String is Database の名前
+func (db *Database) String() string {
+	return fmt.Sprintf("fakespanner.Database(%s)", db.name)
+}
@@ -0,0 +1,126 @@
+// Package fakespanner is Mutation 数の上限を再現する in-process の Spanner gRPC Server
+//
+// Session, Commit, ReadWriteTransaction の中の DML UPDATE と、Database Admin API の Database の作成, DDL の適用, 削除を扱うことができ、
+// Commit に含まれる Mutation 数を estimator で数えて上限を超えた場合は本物の Spanner と同じ形の error を返す
+// measure_*_test.go を Spanner に繋がずに動かすためのもので、Query などはほとんど実装していない
+//
+// Mutation 数は適用した行や Index の Entry から数えるのではなく、estimator の見積もりをそのまま使う
+// そのため fakespanner の結果は estimator のルールが正しいことの確認にはならず、applier.DryRun と比べても必ず一致する
+// ルールを確かめる場合は本物の Spanner で計測する
+package fakespanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"google.golang.org/api/option"
+	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc"
+)
+
+// Server is in-process で動く Spanner の gRPC Server
+type Server struct {
+	// Limit is 1 Commit の Mutation 数の上限
+	Limit int
+
+	lis net.Listener
+	srv *grpc.Server
+
+	mu        sync.Mutex
+	databases map[string]*Database
+	sessions  map[string]*Database
+	txns      map[string]*transaction
+	seq       int64
+}
+
+// NewServer is localhost で Listen する Server を起動する
+func NewServer() (*Server, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Limit:     estimator.DefaultLimit,
+		lis:       lis,
+		srv:       grpc.NewServer(grpc.MaxRecvMsgSize(100 << 20)),
+		databases: make(map[string]*Database),
+		sessions:  make(map[string]*Database),
+		txns:      make(map[string]*transaction),
+	}
+	sppb.RegisterSpannerServer(s.srv, &spannerServer{s: s})
+	adminpb.RegisterDatabaseAdminServer(s.srv, &adminServer{s: s})
+	go s.srv.Serve(lis)
+	return s, nil
+}
+
+// Addr is Server が Listen している address
+func (s *Server) Addr() string {
+	return s.lis.Addr().String()
+}
+
+// Close is Server を停止する
+func (s *Server) Close() {
+	s.srv.Stop()
+}
+
+// ClientOptions is spanner.NewClient で Server に接続するための option. Commit Stats を受け取る commitstats.ClientOption も含む
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.Addr()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+		commitstats.ClientOption(),
+	}
+}
+
+// NewClient is Server の database に接続する spanner.Client を作成する
+func (s *Server) NewClient(ctx context.Context, database string, config spanner.ClientConfig) (*spanner.Client, error) {
+	if s.Database(database) == nil {
+		return nil, fmt.Errorf("database %s is not found", database)
+	}
+	return spanner.NewClientWithConfig(ctx, database, config, s.ClientOptions()...)
+}
+
+// AddDatabase is sc の Table を持つ空の Database を作成する
+// name は projects/PROJECT_ID/instances/INSTANCE_ID/databases/DATABASE_ID の形式
+func (s *Server) AddDatabase(name string, sc *schema.Schema) *Database {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := newDatabase(name, sc)
+	s.databases[name] = db
+	return db
+}
+
+// Database is name の Database を返す. 存在しない場合は nil
+func (s *Server) Database(name string) *Database {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.databases[name]
+}
+
+func (s *Server) limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Limit > 0 {
+		return s.Limit
+	}
+	return estimator.DefaultLimit
+}
+
+func (s *Server) nextID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	return s.seq
+}
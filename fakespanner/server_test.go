@@ -0,0 +1,216 @@
+package fakespanner_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+	"google.golang.org/grpc/codes"
+)
+
+const database = "projects/fake/instances/fake/databases/fake"
+
+func newClient(ctx context.Context, t *testing.T) (*fakespanner.Server, *spanner.Client) {
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddDatabase(database, sc)
+	client, err := s.NewClient(ctx, database, spanner.ClientConfig{})
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+func insertMeasure(rowCount int) []*spanner.Mutation {
+	ms := make([]*spanner.Mutation, rowCount)
+	for i := range ms {
+		// [1:ID, 2:Mark, 3:Col1, 4:Col2, 5:Col3, 6:Col4, 7:CommitedAt, 8:MeasureWithIndex1_1, 9:MeasureWithIndex2_1, 10:MeasureWithIndex2_2] で 10 になる
+		ms[i] = spanner.InsertMap("Measure", map[string]interface{}{
+			"ID":         fmt.Sprintf("id-%05d", i),
+			"Mark":       "fake",
+			"Col1":       "",
+			"Col2":       "",
+			"Col3":       "",
+			"Col4":       "",
+			"CommitedAt": spanner.CommitTimestamp,
+		})
+	}
+	return ms
+}
+
+func TestServer_Apply(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name     string
+		rowCount int
+		wantErr  bool
+	}{
+		{"2000", 2000, false},
+		{"2001", 2001, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, client := newClient(ctx, t)
+			defer s.Close()
+			defer client.Close()
+
+			_, err := client.Apply(ctx, insertMeasure(tt.rowCount))
+			if tt.wantErr {
+				if !spanerr.IsMutationLimit(err) {
+					t.Fatalf("want mutation limit error but got %v", err)
+				}
+				if e, g := 0, s.Database(database).RowCount("Measure"); e != g {
+					t.Errorf("want rows %d but got %d", e, g)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.rowCount, s.Database(database).RowCount("Measure"); e != g {
+				t.Errorf("want rows %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestServer_Update(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(ctx, t)
+	defer s.Close()
+	defer client.Close()
+
+	if _, err := client.Apply(ctx, insertMeasure(2000)); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		sql     string
+		want    int64
+		wantErr bool
+	}{
+		// [1:ID, 2:Col1, 3:Col2, 4:Col3, 5:Col4, 6:Col5, 7:Col6, 8:Col7, 9:Col8, 10:Col9] で 10 になる
+		{"10 columns", `UPDATE Measure SET Col1 = "", Col2 = "", Col3 = "", Col4 = "", Col5 = "", Col6 = "", Col7 = "", Col8 = "", Col9 = "" WHERE Mark = @mark`, 2000, false},
+		// WithIndex1 を更新すると MeasureWithIndex1_1 が 2 増えるので 11 になる
+		{"index", `UPDATE Measure SET Col1 = "", Col2 = "", Col3 = "", Col4 = "", Col5 = "", Col6 = "", Col7 = "", WithIndex1 = "" WHERE Mark = @mark`, 0, true},
+		{"starts with", `UPDATE Measure SET Col1 = "a" WHERE STARTS_WITH(ID, "id-0000")`, 10, false},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var got int64
+			_, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+				var err error
+				got, err = tx.Update(ctx, spanner.Statement{SQL: tt.sql, Params: map[string]interface{}{"mark": "fake"}})
+				return err
+			})
+			if tt.wantErr {
+				if !spanerr.IsMutationLimit(err) {
+					t.Fatalf("want mutation limit error but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != g {
+				t.Errorf("want row count %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestServer_InterleaveDelete(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(ctx, t)
+	defer s.Close()
+	defer client.Close()
+
+	var ms []*spanner.Mutation
+	for _, table := range []string{"MeasureParent", "MeasureParentNoCascade"} {
+		ms = append(ms, spanner.InsertMap(table, map[string]interface{}{"ID": "p1"}))
+	}
+	ms = append(ms, spanner.InsertMap("MeasureChild", map[string]interface{}{"ID": "p1", "ChildID": "c1"}))
+	ms = append(ms, spanner.InsertMap("MeasureChildNoCascade", map[string]interface{}{"ID": "p1", "ChildID": "c1"}))
+	if _, err := client.Apply(ctx, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("parent not found", func(t *testing.T) {
+		_, err := client.Apply(ctx, []*spanner.Mutation{spanner.InsertMap("MeasureChild", map[string]interface{}{"ID": "p2", "ChildID": "c1"})})
+		if e, g := codes.NotFound, spanner.ErrCode(err); e != g {
+			t.Errorf("want code %s but got %s. err=%v", e, g, err)
+		}
+	})
+	t.Run("cascade", func(t *testing.T) {
+		if _, err := client.Apply(ctx, []*spanner.Mutation{spanner.Delete("MeasureParent", spanner.Key{"p1"})}); err != nil {
+			t.Fatal(err)
+		}
+		if e, g := 0, s.Database(database).RowCount("MeasureChild"); e != g {
+			t.Errorf("want child rows %d but got %d", e, g)
+		}
+	})
+	t.Run("no action", func(t *testing.T) {
+		_, err := client.Apply(ctx, []*spanner.Mutation{spanner.Delete("MeasureParentNoCascade", spanner.Key{"p1"})})
+		if e, g := codes.FailedPrecondition, spanner.ErrCode(err); e != g {
+			t.Errorf("want code %s but got %s. err=%v", e, g, err)
+		}
+		_, err = client.Apply(ctx, []*spanner.Mutation{
+			spanner.Delete("MeasureChildNoCascade", spanner.KeyRange{Start: spanner.Key{"p1"}, End: spanner.Key{"p1"}, Kind: spanner.ClosedClosed}),
+			spanner.Delete("MeasureParentNoCascade", spanner.Key{"p1"}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, g := 0, s.Database(database).RowCount("MeasureParentNoCascade"); e != g {
+			t.Errorf("want parent rows %d but got %d", e, g)
+		}
+	})
+}
+
+func TestServer_Query(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(ctx, t)
+	defer s.Close()
+	defer client.Close()
+
+	ms := insertMeasure(3)
+	ms = append(ms, spanner.InsertMap("Measure", map[string]interface{}{"ID": "other", "Mark": "other"}))
+	if _, err := client.Apply(ctx, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt := spanner.NewStatement("SELECT ID, Mark FROM Measure WHERE STARTS_WITH(Mark, @mark)")
+	stmt.Params["mark"] = "fa"
+	var ids []string
+	err := client.Single().Query(ctx, stmt).Do(func(r *spanner.Row) error {
+		var id, mark string
+		if err := r.Columns(&id, &mark); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "[id-00000 id-00001 id-00002]", fmt.Sprint(ids); e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
@@ -0,0 +1,240 @@
+package fakespanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/sinmetal/mutation_count_playground/commitstats"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// transaction is BeginTransaction で開始した ReadWriteTransaction
+// DML で更新した行は Commit まで mutations に溜めておく
+type transaction struct {
+	db        *Database
+	mutations []*sppb.Mutation
+}
+
+// spannerServer is sppb.SpannerServer の実装
+type spannerServer struct {
+	s *Server
+}
+
+func (ss *spannerServer) CreateSession(ctx context.Context, req *sppb.CreateSessionRequest) (*sppb.Session, error) {
+	return ss.s.createSession(req.Database)
+}
+
+func (ss *spannerServer) BatchCreateSessions(ctx context.Context, req *sppb.BatchCreateSessionsRequest) (*sppb.BatchCreateSessionsResponse, error) {
+	res := &sppb.BatchCreateSessionsResponse{}
+	for i := int32(0); i < req.SessionCount; i++ {
+		session, err := ss.s.createSession(req.Database)
+		if err != nil {
+			return nil, err
+		}
+		res.Session = append(res.Session, session)
+	}
+	return res, nil
+}
+
+func (ss *spannerServer) GetSession(ctx context.Context, req *sppb.GetSessionRequest) (*sppb.Session, error) {
+	if _, err := ss.s.session(req.Name); err != nil {
+		return nil, err
+	}
+	return &sppb.Session{Name: req.Name}, nil
+}
+
+func (ss *spannerServer) ListSessions(ctx context.Context, req *sppb.ListSessionsRequest) (*sppb.ListSessionsResponse, error) {
+	ss.s.mu.Lock()
+	defer ss.s.mu.Unlock()
+
+	res := &sppb.ListSessionsResponse{}
+	for name, db := range ss.s.sessions {
+		if db.name == req.Database {
+			res.Sessions = append(res.Sessions, &sppb.Session{Name: name})
+		}
+	}
+	return res, nil
+}
+
+func (ss *spannerServer) DeleteSession(ctx context.Context, req *sppb.DeleteSessionRequest) (*empty.Empty, error) {
+	ss.s.mu.Lock()
+	defer ss.s.mu.Unlock()
+
+	delete(ss.s.sessions, req.Name)
+	return &empty.Empty{}, nil
+}
+
+func (ss *spannerServer) ExecuteSql(ctx context.Context, req *sppb.ExecuteSqlRequest) (*sppb.ResultSet, error) {
+	db, err := ss.s.session(req.Session)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(req.Sql)), "UPDATE") {
+		return nil, status.Errorf(codes.Unimplemented, "fakespanner supports only UPDATE statement. sql=%s", req.Sql)
+	}
+	txn, err := ss.s.readWriteTransaction(req.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	m, rowCount, err := db.updateMutation(req.Sql, req.Params)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		ss.s.mu.Lock()
+		txn.mutations = append(txn.mutations, m)
+		ss.s.mu.Unlock()
+	}
+	return &sppb.ResultSet{
+		Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{}},
+		Stats:    &sppb.ResultSetStats{RowCount: &sppb.ResultSetStats_RowCountExact{RowCountExact: rowCount}},
+	}, nil
+}
+
+// ExecuteStreamingSql is 1 つの Table を Column の名前と WHERE 句で絞り込む単純な SELECT だけを扱う
+// Transaction は見ずに、その時点の行を 1 つの PartialResultSet で返す
+func (ss *spannerServer) ExecuteStreamingSql(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+	db, err := ss.s.session(req.Session)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(req.Sql)), "SELECT") {
+		return status.Errorf(codes.Unimplemented, "fakespanner supports only SELECT query. sql=%s", req.Sql)
+	}
+	rowType, rows, err := db.query(req.Sql, req.Params)
+	if err != nil {
+		return err
+	}
+	res := &sppb.PartialResultSet{Metadata: &sppb.ResultSetMetadata{RowType: rowType}}
+	for _, r := range rows {
+		res.Values = append(res.Values, r...)
+	}
+	return stream.Send(res)
+}
+
+func (ss *spannerServer) ExecuteBatchDml(ctx context.Context, req *sppb.ExecuteBatchDmlRequest) (*sppb.ExecuteBatchDmlResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespanner does not support ExecuteBatchDml")
+}
+
+func (ss *spannerServer) Read(ctx context.Context, req *sppb.ReadRequest) (*sppb.ResultSet, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespanner does not support Read")
+}
+
+func (ss *spannerServer) StreamingRead(req *sppb.ReadRequest, stream sppb.Spanner_StreamingReadServer) error {
+	return status.Error(codes.Unimplemented, "fakespanner does not support StreamingRead")
+}
+
+func (ss *spannerServer) BeginTransaction(ctx context.Context, req *sppb.BeginTransactionRequest) (*sppb.Transaction, error) {
+	db, err := ss.s.session(req.Session)
+	if err != nil {
+		return nil, err
+	}
+	id := fmt.Sprintf("txn-%d", ss.s.nextID())
+
+	ss.s.mu.Lock()
+	defer ss.s.mu.Unlock()
+	if req.Options.GetReadWrite() != nil {
+		ss.s.txns[id] = &transaction{db: db}
+	}
+	return &sppb.Transaction{Id: []byte(id)}, nil
+}
+
+func (ss *spannerServer) Commit(ctx context.Context, req *sppb.CommitRequest) (*sppb.CommitResponse, error) {
+	db, err := ss.s.session(req.Session)
+	if err != nil {
+		return nil, err
+	}
+	var mutations []*sppb.Mutation
+	switch v := req.Transaction.(type) {
+	case *sppb.CommitRequest_TransactionId:
+		txn, err := ss.s.readWriteTransaction(&sppb.TransactionSelector{Selector: &sppb.TransactionSelector_Id{Id: v.TransactionId}})
+		if err != nil {
+			return nil, err
+		}
+		ss.s.endTransaction(v.TransactionId)
+		mutations = append(mutations, txn.mutations...)
+	case *sppb.CommitRequest_SingleUseTransaction:
+	default:
+		return nil, status.Error(codes.InvalidArgument, "transaction is required")
+	}
+	mutations = append(mutations, req.Mutations...)
+
+	ts, count, err := db.commit(mutations, ss.s.limit())
+	if err != nil {
+		return nil, err
+	}
+	pts, err := ptypes.TimestampProto(ts)
+	if err != nil {
+		return nil, err
+	}
+	resp := &sppb.CommitResponse{CommitTimestamp: pts}
+	if commitstats.Requested(req) {
+		// Spanner と同じく return_commit_stats が指定された時だけ、見積もった Mutation 数を返す
+		commitstats.SetMutationCount(resp, int64(count))
+	}
+	return resp, nil
+}
+
+func (ss *spannerServer) Rollback(ctx context.Context, req *sppb.RollbackRequest) (*empty.Empty, error) {
+	ss.s.endTransaction(req.TransactionId)
+	return &empty.Empty{}, nil
+}
+
+func (ss *spannerServer) PartitionQuery(ctx context.Context, req *sppb.PartitionQueryRequest) (*sppb.PartitionResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespanner does not support PartitionQuery")
+}
+
+func (ss *spannerServer) PartitionRead(ctx context.Context, req *sppb.PartitionReadRequest) (*sppb.PartitionResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespanner does not support PartitionRead")
+}
+
+func (s *Server) createSession(database string) (*sppb.Session, error) {
+	db := s.Database(database)
+	if db == nil {
+		return nil, status.Errorf(codes.NotFound, "Database not found: %s", database)
+	}
+	name := fmt.Sprintf("%s/sessions/%d", database, s.nextID())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[name] = db
+	return &sppb.Session{Name: name}, nil
+}
+
+func (s *Server) session(name string) (*Database, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, ok := s.sessions[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Session not found: %s", name)
+	}
+	return db, nil
+}
+
+func (s *Server) readWriteTransaction(sel *sppb.TransactionSelector) (*transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := sel.GetId()
+	if id == nil {
+		return nil, status.Error(codes.InvalidArgument, "DML statements can only be performed in a read-write transaction")
+	}
+	txn, ok := s.txns[string(id)]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Transaction not found: %s", id)
+	}
+	return txn, nil
+}
+
+func (s *Server) endTransaction(id []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.txns, string(id))
+}
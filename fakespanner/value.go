@@ -0,0 +1,193 @@
+package fakespanner
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/sinmetal/mutation_count_playground/dml"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// encodeKey is Key を map の key として使える文字列にする
+func encodeKey(key []*structpb.Value) string {
+	parts := make([]string, len(key))
+	for i, v := range key {
+		parts[i] = proto.CompactTextString(v)
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+func stringValue(s string) *structpb.Value {
+	return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: s}}
+}
+
+// toProtoValue is DML に書かれた値を spanner client が送ってくるのと同じ形の structpb.Value にする
+// INT64 は client と同じく文字列として扱う
+func toProtoValue(v dml.Value, params *structpb.Struct) (*structpb.Value, error) {
+	if v.Param != "" {
+		pv, ok := params.GetFields()[v.Param]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "No parameter found for binding: %s", v.Param)
+		}
+		return pv, nil
+	}
+	return literalValue(v.Literal), nil
+}
+
+func literalValue(l interface{}) *structpb.Value {
+	switch v := l.(type) {
+	case string:
+		return stringValue(v)
+	case int64:
+		return stringValue(strconv.FormatInt(v, 10))
+	case float64:
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: v}}
+	case bool:
+		return &structpb.Value{Kind: &structpb.Value_BoolValue{BoolValue: v}}
+	case []interface{}:
+		lv := &structpb.ListValue{}
+		for _, e := range v {
+			lv.Values = append(lv.Values, literalValue(e))
+		}
+		return &structpb.Value{Kind: &structpb.Value_ListValue{ListValue: lv}}
+	default:
+		return &structpb.Value{Kind: &structpb.Value_NullValue{}}
+	}
+}
+
+// compareValue is 2 つの値を比較する. NULL は最も小さい値として扱う
+// INT64 も文字列として送られてくるので、文字列同士は数値として読める場合は数値として比較する
+func compareValue(a, b *structpb.Value) int {
+	switch av := a.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		bv, ok := b.GetKind().(*structpb.Value_StringValue)
+		if !ok {
+			return rank(a) - rank(b)
+		}
+		ai, aerr := strconv.ParseInt(av.StringValue, 10, 64)
+		bi, berr := strconv.ParseInt(bv.StringValue, 10, 64)
+		if aerr == nil && berr == nil {
+			return compareInt(ai, bi)
+		}
+		return strings.Compare(av.StringValue, bv.StringValue)
+	case *structpb.Value_NumberValue:
+		bv, ok := b.GetKind().(*structpb.Value_NumberValue)
+		if !ok {
+			return rank(a) - rank(b)
+		}
+		switch {
+		case av.NumberValue < bv.NumberValue:
+			return -1
+		case av.NumberValue > bv.NumberValue:
+			return 1
+		}
+		return 0
+	case *structpb.Value_BoolValue:
+		bv, ok := b.GetKind().(*structpb.Value_BoolValue)
+		if !ok {
+			return rank(a) - rank(b)
+		}
+		if av.BoolValue == bv.BoolValue {
+			return 0
+		}
+		if bv.BoolValue {
+			return -1
+		}
+		return 1
+	default:
+		return rank(a) - rank(b)
+	}
+}
+
+// rank is 型の違う値を比較する時の順序
+func rank(v *structpb.Value) int {
+	switch v.GetKind().(type) {
+	case *structpb.Value_BoolValue:
+		return 1
+	case *structpb.Value_NumberValue:
+		return 2
+	case *structpb.Value_StringValue:
+		return 3
+	case *structpb.Value_ListValue:
+		return 4
+	default:
+		return 0
+	}
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareKey is Key を先頭から比較する. prefix が短い場合は一致した所までで比較し、一致していれば 0 を返す
+func compareKey(key []*structpb.Value, prefix []*structpb.Value) int {
+	for i := 0; i < len(prefix) && i < len(key); i++ {
+		if c := compareValue(key[i], prefix[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// inRange is key が KeyRange に含まれるかどうかを返す
+// spanner.Key.AsPrefix のように Start と End に Key の先頭部分だけが指定されている場合にも対応している
+func inRange(key []*structpb.Value, kr *sppb.KeyRange) bool {
+	switch v := kr.StartKeyType.(type) {
+	case *sppb.KeyRange_StartClosed:
+		if compareKey(key, v.StartClosed.Values) < 0 {
+			return false
+		}
+	case *sppb.KeyRange_StartOpen:
+		if compareKey(key, v.StartOpen.Values) <= 0 {
+			return false
+		}
+	}
+	switch v := kr.EndKeyType.(type) {
+	case *sppb.KeyRange_EndClosed:
+		if compareKey(key, v.EndClosed.Values) > 0 {
+			return false
+		}
+	case *sppb.KeyRange_EndOpen:
+		if compareKey(key, v.EndOpen.Values) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// columnType is DDL の型を Query の結果の Metadata に入れる型にする
+func columnType(typ string) *sppb.Type {
+	typ = strings.ToUpper(strings.TrimSpace(typ))
+	if strings.HasPrefix(typ, "ARRAY<") && strings.HasSuffix(typ, ">") {
+		return &sppb.Type{Code: sppb.TypeCode_ARRAY, ArrayElementType: columnType(typ[len("ARRAY<") : len(typ)-1])}
+	}
+	if i := strings.Index(typ, "("); i >= 0 {
+		typ = typ[:i]
+	}
+	switch typ {
+	case "BOOL":
+		return &sppb.Type{Code: sppb.TypeCode_BOOL}
+	case "INT64":
+		return &sppb.Type{Code: sppb.TypeCode_INT64}
+	case "FLOAT64":
+		return &sppb.Type{Code: sppb.TypeCode_FLOAT64}
+	case "TIMESTAMP":
+		return &sppb.Type{Code: sppb.TypeCode_TIMESTAMP}
+	case "DATE":
+		return &sppb.Type{Code: sppb.TypeCode_DATE}
+	case "BYTES":
+		return &sppb.Type{Code: sppb.TypeCode_BYTES}
+	default:
+		return &sppb.Type{Code: sppb.TypeCode_STRING}
+	}
+}
@@ -0,0 +1,198 @@
+// Package guard is *spanner.Client を包み、Commit する前に Mutation 数を見積もって上限に近い Commit を止める
+//
+// Apply と ReadWriteTransaction の BufferWrite を Schema から見積もり、Limit * Threshold を超えた時に Policy に従って
+// Reject (Commit せずに *LimitError を返す), Warn (Logf に書いて Commit する), Split (batch.Writer で複数の Commit に分ける) のいずれかを行う
+package guard
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/batch"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// Policy is 見積もりが閾値を超えた時の動作
+type Policy int
+
+const (
+	// Reject is Commit せずに *LimitError を返す
+	Reject Policy = iota
+	// Warn is Logf に書いてそのまま Commit する
+	Warn
+	// Split is batch.Writer で閾値以下の複数の Commit に分けて前から順に Commit する
+	// 途中の Commit が失敗した場合はそこで止めて *SplitError を返す. それより前の Commit は取り消されない
+	// 分けると 1 つの Transaction ではなくなるので、ReadWriteTransaction では Reject と同じになる
+	Split
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Reject:
+		return "reject"
+	case Warn:
+		return "warn"
+	case Split:
+		return "split"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// LimitError is 見積もった Mutation 数が閾値を超えたので Commit しなかった
+type LimitError struct {
+	// Count is 見積もった Mutation 数
+	Count int
+	// Threshold is Limit * Threshold の Mutation 数
+	Threshold int
+	Limit     int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("estimated %d mutations, over the threshold %d (limit %d)", e.Count, e.Threshold, e.Limit)
+}
+
+// SplitError is Split で分けた Commit の途中で失敗した
+// 前から Committed 個の Batch (ms[:CommittedMutations]) は Commit されていて取り消されない
+// Committed 番目の Batch が Err で失敗し、それより後の Batch は Apply していない
+type SplitError struct {
+	// Committed is Commit できた Batch の数
+	Committed int
+	// CommittedMutations is Commit できた Batch に含まれる Mutation の数. Apply に渡した ms の前から数える
+	CommittedMutations int
+	// CommitTimestamp is 最後に Commit できた Batch の CommitTimestamp. 1 つも Commit できなかった場合はゼロ値
+	CommitTimestamp time.Time
+	Err             error
+}
+
+func (e *SplitError) Error() string {
+	return fmt.Sprintf("split apply: batch[%d] failed after %d batches (%d mutations) were committed, later batches were not applied: %v", e.Committed, e.Committed, e.CommittedMutations, e.Err)
+}
+
+// Client is *spanner.Client の Apply と ReadWriteTransaction を Mutation 数で守る
+type Client struct {
+	Client *spanner.Client
+	Schema *schema.Schema
+
+	// Limit is 1 Commit の Mutation 数の上限. 0 の場合は estimator.DefaultLimit を使う
+	Limit int
+	// Threshold is Limit に対する割合. Limit * Threshold を超えた Commit に Policy を適用する. 0 の場合は 1
+	Threshold float64
+	Policy    Policy
+
+	// Logf is Warn の出力先. nil の場合は log.Printf を使う
+	Logf func(format string, args ...interface{})
+}
+
+func (c *Client) limit() int {
+	if c.Limit > 0 {
+		return c.Limit
+	}
+	return estimator.DefaultLimit
+}
+
+func (c *Client) threshold() int {
+	if c.Threshold <= 0 {
+		return c.limit()
+	}
+	return int(float64(c.limit()) * c.Threshold)
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// check is ms を見積もり、閾値を超えた場合は *LimitError を返す
+func (c *Client) check(ms []*spanner.Mutation) (int, error) {
+	n, err := estimator.Count(c.Schema, ms)
+	if err != nil {
+		return 0, err
+	}
+	if th := c.threshold(); n > th {
+		return n, &LimitError{Count: n, Threshold: th, Limit: c.limit()}
+	}
+	return n, nil
+}
+
+// Apply is ms を見積もってから Apply する
+// Split で複数の Commit に分けた場合は、最後の Commit の CommitTimestamp を返す
+// 途中の Commit が失敗した場合は残りの Batch を Apply せずに、どこまで Commit したかを *SplitError で返す
+func (c *Client) Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error) {
+	_, err := c.check(ms)
+	le, over := err.(*LimitError)
+	if err != nil && !over {
+		return time.Time{}, err
+	}
+	if !over {
+		return c.Client.Apply(ctx, ms, opts...)
+	}
+
+	switch c.Policy {
+	case Warn:
+		c.logf("guard: apply %d mutations: %v", len(ms), le)
+		return c.Client.Apply(ctx, ms, opts...)
+	case Split:
+		w := &batch.Writer{Applier: c.Client, Schema: c.Schema, Limit: c.threshold(), StopOnError: true}
+		results, err := w.Apply(ctx, ms, opts...)
+		if err != nil {
+			return time.Time{}, err
+		}
+		var ts time.Time
+		var committed int
+		for i, r := range results {
+			if r.Err != nil {
+				return time.Time{}, &SplitError{Committed: i, CommittedMutations: committed, CommitTimestamp: ts, Err: r.Err}
+			}
+			ts = r.CommitTimestamp
+			committed += len(r.Mutations)
+		}
+		return ts, nil
+	}
+	return time.Time{}, le
+}
+
+// ApplyAtLeastOnce is spanner.ApplyAtLeastOnce を指定して Apply する
+func (c *Client) ApplyAtLeastOnce(ctx context.Context, ms []*spanner.Mutation) (time.Time, error) {
+	return c.Apply(ctx, ms, spanner.ApplyAtLeastOnce())
+}
+
+// Transaction is BufferWrite した Mutation を見積もる *spanner.ReadWriteTransaction
+// Update で実行した DML の Mutation は更新する行数が分からないので数えない
+type Transaction struct {
+	*spanner.ReadWriteTransaction
+
+	c         *Client
+	mutations []*spanner.Mutation
+}
+
+// BufferWrite is それまでに BufferWrite した Mutation と合わせて見積もり、閾値を超えた場合は Policy に従う
+// Reject と Split の場合は *LimitError を返して ms を Buffer しない. f がその error を返すと Transaction は Rollback される
+func (tx *Transaction) BufferWrite(ms []*spanner.Mutation) error {
+	all := append(tx.mutations[:len(tx.mutations):len(tx.mutations)], ms...)
+	_, err := tx.c.check(all)
+	if le, ok := err.(*LimitError); ok && tx.c.Policy == Warn {
+		tx.c.logf("guard: buffer %d mutations: %v", len(ms), le)
+	} else if err != nil {
+		return err
+	}
+	if err := tx.ReadWriteTransaction.BufferWrite(ms); err != nil {
+		return err
+	}
+	tx.mutations = all
+	return nil
+}
+
+// ReadWriteTransaction is f に *Transaction を渡して spanner.Client.ReadWriteTransaction を実行する
+// f が Retry される時は、見積もりも最初からやり直す
+func (c *Client) ReadWriteTransaction(ctx context.Context, f func(context.Context, *Transaction) error) (time.Time, error) {
+	return c.Client.ReadWriteTransaction(ctx, func(ctx context.Context, rwt *spanner.ReadWriteTransaction) error {
+		return f(ctx, &Transaction{ReadWriteTransaction: rwt, c: c})
+	})
+}
@@ -0,0 +1,191 @@
+package guard_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/guard"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+const database = "projects/fake/instances/fake/databases/fake"
+
+func newClient(ctx context.Context, t *testing.T) (*fakespanner.Server, *spanner.Client, *schema.Schema) {
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddDatabase(database, sc)
+	client, err := s.NewClient(ctx, database, spanner.ClientConfig{})
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, client, sc
+}
+
+func TestClient_Apply(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name      string
+		policy    guard.Policy
+		threshold float64
+		rowCount  int
+		wantErr   bool
+		wantRows  int
+		wantLogs  int
+	}{
+		// 1 行 5 mutation
+		{"under the limit", guard.Reject, 0, 4000, false, 4000, 0},
+		{"reject", guard.Reject, 0, 4001, true, 0, 0},
+		{"reject threshold", guard.Reject, 0.5, 2001, true, 0, 0},
+		{"warn", guard.Warn, 0.5, 2001, false, 2001, 1},
+		// Warn は Commit するので、Spanner の上限を超えると Commit が失敗する
+		{"warn over the limit", guard.Warn, 0, 4001, true, 0, 1},
+		{"split", guard.Split, 0, 9000, false, 9000, 0},
+		{"split threshold", guard.Split, 0.5, 3000, false, 3000, 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, client, sc := newClient(ctx, t)
+			defer s.Close()
+			defer client.Close()
+
+			var logs []string
+			c := &guard.Client{Client: client, Schema: sc, Threshold: tt.threshold, Policy: tt.policy, Logf: func(format string, args ...interface{}) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			}}
+			_, err := c.Apply(ctx, createInsertMutation(tt.rowCount))
+			if e, g := tt.wantErr, err != nil; e != g {
+				t.Errorf("want err %v but got %v", e, err)
+			}
+			if e, g := tt.wantRows, s.Database(database).RowCount("Measure"); e != g {
+				t.Errorf("want rows %d but got %d", e, g)
+			}
+			if e, g := tt.wantLogs, len(logs); e != g {
+				t.Errorf("want logs %d but got %v", e, logs)
+			}
+		})
+	}
+}
+
+func TestClient_Apply_LimitError(t *testing.T) {
+	ctx := context.Background()
+	s, client, sc := newClient(ctx, t)
+	defer s.Close()
+	defer client.Close()
+
+	c := &guard.Client{Client: client, Schema: sc, Limit: 100, Threshold: 0.8}
+	_, err := c.ApplyAtLeastOnce(ctx, createInsertMutation(18))
+	le, ok := err.(*guard.LimitError)
+	if !ok {
+		t.Fatalf("want *guard.LimitError but got %T %v", err, err)
+	}
+	if e, g := "estimated 90 mutations, over the threshold 80 (limit 100)", le.Error(); e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
+
+func TestClient_Apply_SplitError(t *testing.T) {
+	ctx := context.Background()
+	s, client, sc := newClient(ctx, t)
+	defer s.Close()
+	defer client.Close()
+
+	// 4000 行ずつ 3 つの Commit に分かれる. 2 つ目の Commit に 1 つ目と同じ ID の行を入れて失敗させる
+	ms := createInsertMutation(9000)
+	ms[5000] = spanner.InsertMap("Measure", map[string]interface{}{"ID": "dup"})
+	ms[0] = spanner.InsertMap("Measure", map[string]interface{}{"ID": "dup"})
+
+	c := &guard.Client{Client: client, Schema: sc, Policy: guard.Split}
+	_, err := c.Apply(ctx, ms)
+	se, ok := err.(*guard.SplitError)
+	if !ok {
+		t.Fatalf("want *guard.SplitError but got %T %v", err, err)
+	}
+	if e, g := 1, se.Committed; e != g {
+		t.Errorf("want committed %d but got %d", e, g)
+	}
+	if e, g := 4000, se.CommittedMutations; e != g {
+		t.Errorf("want committed mutations %d but got %d", e, g)
+	}
+	if se.CommitTimestamp.IsZero() {
+		t.Errorf("want commit timestamp of the first batch")
+	}
+	// 失敗した Commit より後の Batch は Apply しない
+	if e, g := 4000, s.Database(database).RowCount("Measure"); e != g {
+		t.Errorf("want rows %d but got %d", e, g)
+	}
+}
+
+func TestClient_ReadWriteTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name     string
+		policy   guard.Policy
+		buffers  []int
+		wantErr  bool
+		wantRows int
+		wantLogs int
+	}{
+		{"under the limit", guard.Reject, []int{2000, 2000}, false, 4000, 0},
+		// 2 回目の BufferWrite で合計が上限を超える
+		{"reject", guard.Reject, []int{2000, 2001}, true, 0, 0},
+		// Transaction は分けられないので Reject と同じ
+		{"split", guard.Split, []int{2000, 2001}, true, 0, 0},
+		{"warn", guard.Warn, []int{2000, 2001}, true, 0, 1},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, client, sc := newClient(ctx, t)
+			defer s.Close()
+			defer client.Close()
+
+			var logs []string
+			c := &guard.Client{Client: client, Schema: sc, Policy: tt.policy, Logf: func(format string, args ...interface{}) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			}}
+			_, err := c.ReadWriteTransaction(ctx, func(ctx context.Context, tx *guard.Transaction) error {
+				for _, n := range tt.buffers {
+					if err := tx.BufferWrite(createInsertMutation(n)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if e, g := tt.wantErr, err != nil; e != g {
+				t.Errorf("want err %v but got %v", e, err)
+			}
+			if e, g := tt.wantRows, s.Database(database).RowCount("Measure"); e != g {
+				t.Errorf("want rows %d but got %d", e, g)
+			}
+			if e, g := tt.wantLogs, len(logs); e != g {
+				t.Errorf("want logs %d but got %v", e, logs)
+			}
+		})
+	}
+}
+
+// createInsertMutation is Measure に ID と Col1 だけを書き込む Insert を作る
+// guard は Mutation 数しか見ないので、1 行 [1:ID, 2:Col1, 3:MeasureWithIndex1_1, 4:MeasureWithIndex2_1, 5:MeasureWithIndex2_2] の 5 mutation にしている
+func createInsertMutation(rowCount int) []*spanner.Mutation {
+	list := make([]*spanner.Mutation, rowCount)
+	for i := 0; i < rowCount; i++ {
+		list[i] = spanner.InsertMap("Measure", map[string]interface{}{"ID": uuid.New().String(), "Col1": ""})
+	}
+	return list
+}
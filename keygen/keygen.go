@@ -0,0 +1,181 @@
+// Package keygen is 計測で書き込む行の Key (ID) を作成する
+//
+// 既定の random は今まで通り実行ごとに異なる UUID を作る. 同じ Key で失敗を再現したい場合は、次のいずれかを実行ごとに選ぶ
+//
+//	random            : uuid.New の UUID (省略した場合)
+//	uuid[:SEED]       : SEED から作る UUID. 同じ SEED なら同じ順に同じ UUID になる. SEED を省略した場合は時刻から決める
+//	sequential[:START]: START (省略した場合は 1) からの連番. 文字列の順と数値の順が一致するように 20 桁で 0 埋めする
+//	bitreversed[:START]: START からの連番の bit を反転した値の 16 進数 16 桁. 連番と違い Key の範囲が分散する
+//
+// String は SEED や START を含めた値を返すので、結果と一緒に記録しておけば Parse で同じ Generator を作り直せる
+// sequential と bitreversed は実行ごとに同じ Key になるので、MUTATION_COUNT_KEEP_ROWS で行を残した Database にもう一度書き込むと Key が重複する
+package keygen
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EnvKeyGen is 実行で使う Generator を指定する環境変数. 形式は Parse を参照
+const EnvKeyGen = "MUTATION_COUNT_KEYGEN"
+
+// Generator の種類
+const (
+	KindRandom      = "random"
+	KindUUID        = "uuid"
+	KindSequential  = "sequential"
+	KindBitReversed = "bitreversed"
+)
+
+// Generator is 行の Key を作成する. 複数の goroutine から呼んでもよい
+type Generator interface {
+	// Next is 次の Key を返す
+	Next() string
+
+	// String is Parse で同じ Generator を作り直せる値を返す
+	String() string
+}
+
+// Parse is kind[:ARG] の形式の値から Generator を作る. 空の場合は random
+func Parse(v string) (Generator, error) {
+	v = strings.TrimSpace(v)
+	kind, arg := v, ""
+	if i := strings.Index(v, ":"); i >= 0 {
+		kind, arg = v[:i], v[i+1:]
+	}
+	switch strings.ToLower(kind) {
+	case "", KindRandom:
+		if arg != "" {
+			break
+		}
+		return Random(), nil
+	case KindUUID:
+		if arg == "" {
+			return NewUUID(time.Now().UnixNano()), nil
+		}
+		seed, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			break
+		}
+		return NewUUID(seed), nil
+	case KindSequential, KindBitReversed:
+		start := uint64(1)
+		if arg != "" {
+			n, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid keygen %q. start must be a non-negative number", v)
+			}
+			start = n
+		}
+		if strings.EqualFold(kind, KindSequential) {
+			return NewSequential(start), nil
+		}
+		return NewBitReversed(start), nil
+	}
+	return nil, fmt.Errorf("invalid keygen %q. use random, uuid[:SEED], sequential[:START] or bitreversed[:START]", v)
+}
+
+// FromEnv is EnvKeyGen から Generator を作る
+func FromEnv() (Generator, error) {
+	return Parse(os.Getenv(EnvKeyGen))
+}
+
+type random struct{}
+
+// Random is uuid.New の UUID を返す Generator. 実行ごとに異なる Key になる
+func Random() Generator {
+	return random{}
+}
+
+func (random) Next() string {
+	return uuid.New().String()
+}
+
+func (random) String() string {
+	return KindRandom
+}
+
+type seededUUID struct {
+	seed int64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewUUID is seed から Version 4 の形の UUID を順に作る Generator
+func NewUUID(seed int64) Generator {
+	return &seededUUID{seed: seed, rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (g *seededUUID) Next() string {
+	var u uuid.UUID
+	g.mu.Lock()
+	g.rnd.Read(u[:])
+	g.mu.Unlock()
+	u[6] = (u[6] & 0x0f) | 0x40 // Version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // Variant is 10
+	return u.String()
+}
+
+func (g *seededUUID) String() string {
+	return fmt.Sprintf("%s:%d", KindUUID, g.seed)
+}
+
+// counter is sequential と bitreversed が使う連番
+type counter struct {
+	start uint64
+
+	mu   sync.Mutex
+	next uint64
+}
+
+func (c *counter) take() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.next
+	c.next++
+	return n
+}
+
+type sequential struct {
+	counter
+}
+
+// NewSequential is start からの連番を 20 桁で 0 埋めした Key を返す Generator
+func NewSequential(start uint64) Generator {
+	return &sequential{counter{start: start, next: start}}
+}
+
+func (g *sequential) Next() string {
+	return fmt.Sprintf("%020d", g.take())
+}
+
+func (g *sequential) String() string {
+	return fmt.Sprintf("%s:%d", KindSequential, g.start)
+}
+
+type bitReversed struct {
+	counter
+}
+
+// NewBitReversed is start からの連番の bit を反転した値を 16 進数 16 桁にした Key を返す Generator
+// 連番の Key は Table の末尾の Split に書き込みが集中するが、bit を反転すると Key の範囲全体に分散する
+func NewBitReversed(start uint64) Generator {
+	return &bitReversed{counter{start: start, next: start}}
+}
+
+func (g *bitReversed) Next() string {
+	return fmt.Sprintf("%016x", bits.Reverse64(g.take()))
+}
+
+func (g *bitReversed) String() string {
+	return fmt.Sprintf("%s:%d", KindBitReversed, g.start)
+}
@@ -0,0 +1,147 @@
+package keygen_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/keygen"
+)
+
+func next(g keygen.Generator, n int) []string {
+	var keys []string
+	for i := 0; i < n; i++ {
+		keys = append(keys, g.Next())
+	}
+	return keys
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name    string
+		v       string
+		want    string
+		keys    []string
+		wantErr bool
+	}{
+		{"empty", "", "random", nil, false},
+		{"random", "Random", "random", nil, false},
+		{"uuid", "uuid:42", "uuid:42", nil, false},
+		{"sequential", "sequential", "sequential:1", []string{"00000000000000000001", "00000000000000000002", "00000000000000000003"}, false},
+		{"sequential start", "sequential:10", "sequential:10", []string{"00000000000000000010", "00000000000000000011", "00000000000000000012"}, false},
+		{"bitreversed", "bitreversed", "bitreversed:1", []string{"8000000000000000", "4000000000000000", "c000000000000000"}, false},
+		{"bitreversed zero", "bitreversed:0", "bitreversed:0", []string{"0000000000000000", "8000000000000000", "4000000000000000"}, false},
+		{"random with arg", "random:1", "", nil, true},
+		{"invalid seed", "uuid:hoge", "", nil, true},
+		{"invalid start", "sequential:-1", "", nil, true},
+		{"unknown", "snowflake", "", nil, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := keygen.Parse(tt.v)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want err but got %s", g)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, g.String(); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+			if tt.keys != nil {
+				if e, g := fmt.Sprint(tt.keys), fmt.Sprint(next(g, len(tt.keys))); e != g {
+					t.Errorf("want %s but got %s", e, g)
+				}
+			}
+		})
+	}
+}
+
+func TestParse_UUIDWithoutSeed(t *testing.T) {
+	g, err := keygen.Parse("uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 時刻から決めた SEED を String に含めるので、同じ Key を作り直せる
+	if !strings.HasPrefix(g.String(), "uuid:") {
+		t.Fatalf("want uuid:SEED but got %s", g)
+	}
+	again, err := keygen.Parse(g.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := fmt.Sprint(next(g, 3)), fmt.Sprint(next(again, 3)); e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	keys := next(keygen.NewUUID(1), 100)
+	if e, g := fmt.Sprint(keys), fmt.Sprint(next(keygen.NewUUID(1), 100)); e != g {
+		t.Errorf("want same keys for the same seed")
+	}
+	if e, g := keys[0], keygen.NewUUID(2).Next(); e == g {
+		t.Errorf("want different keys for different seeds but got %s", g)
+	}
+
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		u, err := uuid.Parse(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, g := uuid.Version(4), u.Version(); e != g {
+			t.Errorf("want version %d but got %d", e, g)
+		}
+		if e, g := uuid.RFC4122, u.Variant(); e != g {
+			t.Errorf("want variant %s but got %s", e, g)
+		}
+		if seen[k] {
+			t.Errorf("duplicate key %s", k)
+		}
+		seen[k] = true
+	}
+}
+
+func TestGenerator_Concurrent(t *testing.T) {
+	generators := []keygen.Generator{
+		keygen.Random(),
+		keygen.NewUUID(1),
+		keygen.NewSequential(1),
+		keygen.NewBitReversed(1),
+	}
+
+	for _, g := range generators {
+		g := g
+		t.Run(g.String(), func(t *testing.T) {
+			var mu sync.Mutex
+			seen := make(map[string]bool)
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for _, k := range next(g, 100) {
+						mu.Lock()
+						if seen[k] {
+							t.Errorf("duplicate key %s", k)
+						}
+						seen[k] = true
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			if e, g := 800, len(seen); e != g {
+				t.Errorf("want %d keys but got %d", e, g)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package matrix is Table の Secondary Index と STORING の定義から、値を入れる Column の組み合わせを列挙して experiment の Case を作る
+//
+// measure_test.go の empty, withIndex1, withIndex2, withIndexAll のような組み合わせを手で選ぶ代わりに、
+// Index の Key と STORING の Column の部分集合のうち、UPDATE で Index に与える影響が異なるものをすべて並べる
+// 各部分集合について insert, update, delete の N と N+1 の Case を作り、perRow には estimator で見積もった 1 行の Mutation 数を入れる
+//
+//	go run ./cmd/matrix -ddl ddl/measure_storing_index.sql -table MeasureWithStoring > /tmp/matrix.json
+package matrix
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/experiment"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// MaxColumns is 組み合わせを列挙する Column の数の上限. 2^MaxColumns 個の部分集合を調べる
+const MaxColumns = 12
+
+// Ops is Generate で Options.Ops を省略した時に作る操作
+var Ops = []experiment.Op{experiment.Insert, experiment.Update, experiment.Delete}
+
+// Subset is 値を入れる Column の組
+type Subset []string
+
+// Name is Case の名前に使う. 空の場合は empty
+func (s Subset) Name() string {
+	if len(s) == 0 {
+		return "empty"
+	}
+	return strings.Join(s, "+")
+}
+
+// Columns is t の Secondary Index の Key と STORING の Column を Table に書かれている順に返す. Primary Key の Column は含めない
+func Columns(t *schema.Table) []string {
+	var list []string
+	for _, c := range t.Columns {
+		if t.IsKeyColumn(c.Name) {
+			continue
+		}
+		for _, idx := range t.Indexes {
+			if idx.HasColumn(c.Name) || idx.Stores(c.Name) {
+				list = append(list, c.Name)
+				break
+			}
+		}
+	}
+	return list
+}
+
+// Subsets is Columns の部分集合のうち、UPDATE で Index に与える影響が異なるものを、小さい順に返す
+// Index ごとに値を入れた Key の Column の数と STORING の Column の数が同じになる部分集合は、最初の 1 つだけを返す
+func Subsets(t *schema.Table) ([]Subset, error) {
+	columns := Columns(t)
+	if len(columns) > MaxColumns {
+		return nil, fmt.Errorf("table %s has %d indexed or stored columns, over %d", t.Name, len(columns), MaxColumns)
+	}
+
+	var list []Subset
+	seen := make(map[string]bool)
+	for size := 0; size <= len(columns); size++ {
+		for bits := 0; bits < 1<<uint(len(columns)); bits++ {
+			if onesCount(bits) != size {
+				continue
+			}
+			var s Subset
+			for i, c := range columns {
+				if bits&(1<<uint(i)) != 0 {
+					s = append(s, c)
+				}
+			}
+			sig := signature(t, s)
+			if seen[sig] {
+				continue
+			}
+			seen[sig] = true
+			list = append(list, s)
+		}
+	}
+	return list, nil
+}
+
+// signature is s に値を入れて UPDATE した時に、Index ごとに変わる Key の Column の数と STORING の Column の数
+func signature(t *schema.Table, s Subset) string {
+	parts := make([]string, len(t.Indexes))
+	for i, idx := range t.Indexes {
+		var keys, storing int
+		for _, c := range s {
+			if idx.HasColumn(c) {
+				keys++
+			}
+			if idx.Stores(c) {
+				storing++
+			}
+		}
+		parts[i] = fmt.Sprintf("%d/%d", keys, storing)
+	}
+	return strings.Join(parts, ",")
+}
+
+func onesCount(v int) int {
+	var n int
+	for ; v > 0; v &= v - 1 {
+		n++
+	}
+	return n
+}
+
+// Options is Generate で作る Case の設定
+type Options struct {
+	// Name is Spec の名前. 省略した場合は Table 名 + " matrix"
+	Name string
+
+	// NormalColumnCount is 各 Case で値を入れる Col1, Col2... の数. 0 の場合は 1
+	// experiment.Runner は Mark を指定すると最後の ColN の代わりに Mark に値を入れるので、1 以上にしておく
+	NormalColumnCount int
+
+	// Ops is 作る操作. 省略した場合は Ops
+	Ops []experiment.Op
+}
+
+// Generate is ddl の table について、Subsets ごとに Ops の N と N+1 の Case を持つ Spec を作る
+// ddl は ddl/ の下の file の path で、Spec には file 名を入れる
+func Generate(ddl, table string, o Options) (*experiment.Spec, error) {
+	sc, err := schema.ParseFile(ddl)
+	if err != nil {
+		return nil, err
+	}
+	t := sc.Table(table)
+	if t == nil {
+		return nil, fmt.Errorf("table %s is not found in %s", table, ddl)
+	}
+	if t.Interleave != nil {
+		return nil, fmt.Errorf("table %s is interleaved in %s. interleaved tables are not supported", t.Name, t.Interleave.Parent)
+	}
+	// Runner は Child を指定しないと子の行を作らないので、子の Table を持つ Table の delete は見積もりと合わない
+	for _, c := range sc.Tables {
+		if c.Interleave != nil && strings.EqualFold(c.Interleave.Parent, t.Name) {
+			return nil, fmt.Errorf("table %s has interleaved table %s. tables with children are not supported", t.Name, c.Name)
+		}
+	}
+	subsets, err := Subsets(t)
+	if err != nil {
+		return nil, err
+	}
+
+	ncc := o.NormalColumnCount
+	if ncc < 1 {
+		ncc = 1
+	}
+	for j := 1; j <= ncc; j++ {
+		if t.Column(fmt.Sprintf("Col%d", j)) == nil {
+			return nil, fmt.Errorf("table %s does not have Col%d", t.Name, j)
+		}
+	}
+	ops := o.Ops
+	if len(ops) == 0 {
+		ops = Ops
+	}
+	name := o.Name
+	if name == "" {
+		name = t.Name + " matrix"
+	}
+
+	s := &experiment.Spec{Name: name, DDL: filepath.Base(ddl), Table: t.Name}
+	for _, op := range ops {
+		for _, sub := range subsets {
+			perRow, err := PerRow(sc, t, op, ncc, sub)
+			if err != nil {
+				return nil, err
+			}
+			columns := make(map[string]interface{})
+			for _, c := range sub {
+				columns[c] = ""
+			}
+			if len(columns) == 0 {
+				columns = nil
+			}
+			for _, wantErr := range []bool{false, true} {
+				n := "N"
+				if wantErr {
+					n = "N+1"
+				}
+				s.Cases = append(s.Cases, &experiment.Case{
+					Name:              fmt.Sprintf("%s %s : %d-%s", op, sub.Name(), ncc, n),
+					Op:                op,
+					NormalColumnCount: ncc,
+					Columns:           columns,
+					PerRow:            perRow,
+					WantErr:           wantErr,
+				})
+			}
+		}
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// PerRow is experiment.Runner が op で書き込む 1 行の Mutation 数を見積もる
+// insert と update は ID, Col1...ColN, sub, Arr1, CommitedAt に値を入れ、delete は 1 つの Key を削除する
+func PerRow(s *schema.Schema, t *schema.Table, op experiment.Op, normalColumnCount int, sub Subset) (int, error) {
+	m := &estimator.Mutation{Table: t.Name}
+	switch op {
+	case experiment.Insert:
+		m.Op = estimator.OpInsert
+	case experiment.Update:
+		m.Op = estimator.OpUpdate
+	case experiment.Delete:
+		m.Op = estimator.OpDelete
+		m.Keys = 1
+		return estimator.CountMutation(s, m)
+	default:
+		return 0, fmt.Errorf("op %q is not supported", op)
+	}
+	m.Columns = append(m.Columns, "ID")
+	for j := 1; j <= normalColumnCount; j++ {
+		m.Columns = append(m.Columns, fmt.Sprintf("Col%d", j))
+	}
+	m.Columns = append(m.Columns, sub...)
+	for _, c := range []string{"Arr1", "CommitedAt"} {
+		if t.Column(c) != nil {
+			m.Columns = append(m.Columns, c)
+		}
+	}
+	return estimator.CountMutation(s, m)
+}
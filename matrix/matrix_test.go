@@ -0,0 +1,125 @@
+package matrix_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/experiment"
+	"github.com/sinmetal/mutation_count_playground/matrix"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+func TestSubsets(t *testing.T) {
+	cases := []struct {
+		ddl         string
+		table       string
+		wantColumns string
+		want        string
+	}{
+		{"measure.sql", "Measure", "WithIndex1,WithIndex2", "empty,WithIndex1,WithIndex2,WithIndex1+WithIndex2"},
+		// WithCompositeIndex1 と WithCompositeIndex2 は同じ Index の Key なので、片方だけの組は 1 つにまとまる
+		{"measure_composite_index.sql", "MeasureCompositeIndex", "WithIndex1,WithIndex2,WithCompositeIndex1,WithCompositeIndex2",
+			"empty,WithIndex1,WithIndex2,WithCompositeIndex1," +
+				"WithIndex1+WithIndex2,WithIndex1+WithCompositeIndex1,WithIndex2+WithCompositeIndex1,WithCompositeIndex1+WithCompositeIndex2," +
+				"WithIndex1+WithIndex2+WithCompositeIndex1,WithIndex1+WithCompositeIndex1+WithCompositeIndex2,WithIndex2+WithCompositeIndex1+WithCompositeIndex2," +
+				"WithIndex1+WithIndex2+WithCompositeIndex1+WithCompositeIndex2"},
+		{"measure_noindex.sql", "MeasureNoIndex", "", "empty"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.table, func(t *testing.T) {
+			s, err := schema.ParseFile("../ddl/" + tt.ddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tbl := s.Table(tt.table)
+			if e, g := tt.wantColumns, strings.Join(matrix.Columns(tbl), ","); e != g {
+				t.Errorf("want columns %s but got %s", e, g)
+			}
+			subsets, err := matrix.Subsets(tbl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, sub := range subsets {
+				names = append(names, sub.Name())
+			}
+			if e, g := tt.want, strings.Join(names, ","); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	s, err := matrix.Generate("../ddl/measure_storing_index.sql", "MeasureWithStoring", matrix.Options{NormalColumnCount: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "MeasureWithStoring matrix", s.Name; e != g {
+		t.Errorf("want name %s but got %s", e, g)
+	}
+	if e, g := "measure_storing_index.sql", s.DDL; e != g {
+		t.Errorf("want ddl %s but got %s", e, g)
+	}
+	// 4 Column の部分集合 16 * insert, update, delete * N, N+1
+	if e, g := 16*3*2, len(s.Cases); e != g {
+		t.Errorf("want cases %d but got %d", e, g)
+	}
+
+	perRow := make(map[string]int)
+	for _, c := range s.Cases {
+		perRow[c.Name] = c.PerRow
+	}
+	cases := []struct {
+		name string
+		want int
+	}{
+		// [1:ID, 2:Col1, 3:Col2, 4:Arr1, 5:CommitedAt] + 2 index
+		{"insert empty : 2-N", 7},
+		// measure_storing_index_test.go TestMeasureStoringIndex_Update の "withStoringColumn1 : 2-N"
+		{"update Storing1 : 2-N+1", 10},
+		// [1:ID, 2:Col1, 3:Col2, 4:Arr1, 5:CommitedAt, 6:Storing1, 7:WithIndex2]
+		// + MeasureWithStoringWithIndex1_1 の STORING (1+1) + MeasureWithStoringWithIndex2_1 の Key (1 + 1+2)
+		{"update WithIndex2+Storing1 : 2-N", 13},
+		// [1:MeasureWithStoring, 2:MeasureWithStoringWithIndex1_1, 3:MeasureWithStoringWithIndex2_1]
+		{"delete WithIndex1+WithIndex2+Storing1+Storing2 : 2-N", 3},
+	}
+	for _, tt := range cases {
+		g, ok := perRow[tt.name]
+		if !ok {
+			t.Errorf("case %s is not generated", tt.name)
+			continue
+		}
+		if e := tt.want; e != g {
+			t.Errorf("%s want perRow %d but got %d", tt.name, e, g)
+		}
+	}
+}
+
+func TestGenerate_Error(t *testing.T) {
+	cases := []struct {
+		name  string
+		ddl   string
+		table string
+		o     matrix.Options
+	}{
+		{"unknown table", "measure.sql", "Hoge", matrix.Options{}},
+		{"interleaved", "measure_interleave.sql", "MeasureChild", matrix.Options{}},
+		{"parent", "measure_interleave.sql", "MeasureParent", matrix.Options{}},
+		{"too many normal columns", "measure.sql", "Measure", matrix.Options{NormalColumnCount: 10}},
+		{"dml", "measure.sql", "Measure", matrix.Options{Ops: []experiment.Op{experiment.DML}}},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := matrix.Generate(fmt.Sprintf("../ddl/%s", tt.ddl), tt.table, tt.o)
+			if err == nil {
+				t.Errorf("want err but got err is nil")
+			}
+		})
+	}
+}
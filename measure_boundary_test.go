@@ -0,0 +1,120 @@
+package mutation_count_playground_test
+
+import (
+	"context"
+	"os"
+	"sort"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/boundary"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+)
+
+// TestBoundary is 1 Commit に含めることができる行数の境界を探して MUTATION_COUNT_BOUNDARY の file に追記する
+// 時間がかかるので MUTATION_COUNT_BOUNDARY が指定されている時だけ実行する
+func TestBoundary(t *testing.T) {
+	path := os.Getenv("MUTATION_COUNT_BOUNDARY")
+	if path == "" {
+		t.Skip("MUTATION_COUNT_BOUNDARY is not set")
+	}
+	ctx := context.Background()
+	sc := createApplier(ctx, t)
+
+	empty := make(map[string]interface{})
+	withIndex1 := map[string]interface{}{"withIndex1": ""}
+	withIndex2 := map[string]interface{}{"withIndex2": ""}
+	withIndexAll := map[string]interface{}{"withIndex1": "", "withIndex2": ""}
+
+	cases := []struct {
+		name              string
+		table             string
+		op                estimator.Op
+		normalColumnCount int
+		column            map[string]interface{}
+	}{
+		{"insert empty", Table, estimator.OpInsert, 4, empty},
+		{"insert withIndex1", Table, estimator.OpInsert, 3, withIndex1},
+		{"insert withIndex2", Table, estimator.OpInsert, 3, withIndex2},
+		{"insert withIndexAll", Table, estimator.OpInsert, 2, withIndexAll},
+		{"update empty", Table, estimator.OpUpdate, 7, empty},
+		{"update withIndex1", Table, estimator.OpUpdate, 4, withIndex1},
+		{"update withIndex2", Table, estimator.OpUpdate, 2, withIndex2},
+		{"update withIndexAll", Table, estimator.OpUpdate, 0, withIndexAll},
+		{"delete", Table, estimator.OpDelete, 4, empty},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var columns []string
+			probe := func(ctx context.Context, rowCount int) (bool, error) {
+				var mu []*spanner.Mutation
+				switch tt.op {
+				case estimator.OpInsert:
+					var err error
+					mu, err = createInsertMutation(tt.table, tt.normalColumnCount, tt.column, rowCount)
+					if err != nil {
+						return false, err
+					}
+				case estimator.OpUpdate:
+					ids, insert, err := createInsertMutationForUpdateTest(tt.table, int64(rowCount))
+					if err != nil {
+						return false, err
+					}
+					applyInBatches(ctx, t, sc, insert)
+					mu = createUpdateMutation(t, tt.table, ids, tt.normalColumnCount, tt.column, int64(rowCount))
+				case estimator.OpDelete:
+					var insert []*spanner.Mutation
+					var ids []string
+					for i := 0; i < rowCount; i++ {
+						id, m, err := createInsertMutationForDeleteTest(tt.table, tt.normalColumnCount, tt.column)
+						if err != nil {
+							return false, err
+						}
+						ids = append(ids, id)
+						insert = append(insert, m)
+					}
+					applyInBatches(ctx, t, sc, insert)
+					mu = createDeleteMutation(t, tt.table, ids)
+				}
+				if columns == nil {
+					columns = mutationColumns(t, mu[0])
+				}
+
+				_, err := sc.Apply(ctx, mu)
+				if spanerr.IsMutationLimit(err) {
+					return false, nil
+				}
+				return err == nil, err
+			}
+
+			spec := boundary.Spec{Table: tt.table, Op: tt.op.String(), Low: 1000, Limit: limitProfile().Limit}
+			r, err := boundary.Search(ctx, spec, probe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Columns = columns
+			if testBackend != nil {
+				r.Backend = string(testBackend.Config.Kind)
+			}
+			r.KeyGen = runKeys.String()
+			t.Logf("maxOK=%d, minFail=%d, perRow=%d, probes=%d", r.MaxOK, r.MinFail, r.PerRow, r.Probes)
+			if err := boundary.AppendFile(path, r); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// mutationColumns is Mutation で値を指定している Column を名前順に返す
+func mutationColumns(t *testing.T, mu *spanner.Mutation) []string {
+	m, err := estimator.FromSpanner(mu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := append([]string{}, m.Columns...)
+	sort.Strings(columns)
+	return columns
+}
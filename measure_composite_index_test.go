@@ -2,17 +2,17 @@ package mutation_count_playground_test
 
 import (
 	"context"
-	"strings"
 	"testing"
 
 	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
 )
 
 const CompositeIndexTable = "MeasureCompositeIndex"
 
 func TestMeasureCompositeIndex_Insert(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 	withCompositeIndex := map[string]interface{}{"WithCompositeIndex1": ""}
@@ -25,12 +25,12 @@ func TestMeasureCompositeIndex_Insert(t *testing.T) {
 		wantErr           bool
 	}{
 		// WithIndexをすべてNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:MeasureWithIndex1_1, 5:MeasureWithIndex2_1, 6:MeasureWithIndex2_2, 7:MeasureCompositeIndexWithCompositeIndex] + normalColumnが 3 つで、10 になる
-		{"empty : 3-2000", 3, empty, 2000, false},
-		{"empty : 3-2001", 3, empty, 2001, true},
+		{"empty : 3-N", 3, empty, maxRows(10), false},
+		{"empty : 3-N+1", 3, empty, maxRows(10) + 1, true},
 
 		// MeasureCompositeIndexWithCompositeIndexに値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithCompositeIndex1, 5:MeasureWithIndex1_1, 6:MeasureWithIndex2_1, 7:MeasureWithIndex2_2, 8:MeasureCompositeIndexWithCompositeIndex] + normalColumnが 2 つで、10 になる
-		{"WithCompositeIndex1 : 2-2000", 2, withCompositeIndex, 2000, false},
-		{"WithCompositeIndex1 : 2-2001", 2, withCompositeIndex, 2001, true},
+		{"WithCompositeIndex1 : 2-N", 2, withCompositeIndex, maxRows(10), false},
+		{"WithCompositeIndex1 : 2-N+1", 2, withCompositeIndex, maxRows(10) + 1, true},
 	}
 
 	for _, tt := range cases {
@@ -44,7 +44,7 @@ func TestMeasureCompositeIndex_Insert(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -58,7 +58,7 @@ func TestMeasureCompositeIndex_Insert(t *testing.T) {
 
 func TestMeasureCompositeIndex_Update(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 	withCompositeIndex1 := map[string]interface{}{"WithCompositeIndex1": ""}
@@ -73,20 +73,20 @@ func TestMeasureCompositeIndex_Update(t *testing.T) {
 		wantErr           bool
 	}{
 		// WithIndexをすべてNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt] + normalColumnが 7 つで、10 になる
-		{"empty : 7-2000", 7, empty, 2000, false},
-		{"empty : 7-2001", 7, empty, 2001, true},
+		{"empty : 7-N", 7, empty, int64(maxRows(10)), false},
+		{"empty : 7-N+1", 7, empty, int64(maxRows(10) + 1), true},
 
-		// withCompositeIndex1,WithCompositeIndex2 に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithCompositeIndex1, , 5:WithCompositeIndex2, 6:MeasureCompositeIndexWithCompositeIndex * 2] + normalColumnが 3 つで、10 になる
-		{"withCompositeIndex : 3-2000", 3, withCompositeIndexAll, 2000, false},
-		{"withCompositeIndex : 3-2001", 3, withCompositeIndexAll, 2001, true},
+		// withCompositeIndex1,WithCompositeIndex2 に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithCompositeIndex1, 5:WithCompositeIndex2, 6:MeasureCompositeIndexWithCompositeIndex (古いEntryの削除 U2), 7:MeasureCompositeIndexWithCompositeIndex (新しいEntryの追加 U3)] + normalColumnが 3 つで、10 になる
+		{"withCompositeIndex : 3-N", 3, withCompositeIndexAll, int64(maxRows(10)), false},
+		{"withCompositeIndex : 3-N+1", 3, withCompositeIndexAll, int64(maxRows(10) + 1), true},
 
-		// withCompositeIndex1だけに値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithCompositeIndex1, 5:MeasureCompositeIndexWithCompositeIndex * 2] + normalColumnが 4 つで、10 になる
-		{"withCompositeIndex1 : 4-2000", 4, withCompositeIndex1, 2000, false},
-		{"withCompositeIndex1 : 4-2001", 4, withCompositeIndex1, 2001, true},
+		// withCompositeIndex1だけに値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithCompositeIndex1, 5:MeasureCompositeIndexWithCompositeIndex * 2 (U2, U3)] + normalColumnが 4 つで、10 になる
+		{"withCompositeIndex1 : 4-N", 4, withCompositeIndex1, int64(maxRows(10)), false},
+		{"withCompositeIndex1 : 4-N+1", 4, withCompositeIndex1, int64(maxRows(10) + 1), true},
 
-		// withCompositeIndex2だけに値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithCompositeIndex2, 5:MeasureCompositeIndexWithCompositeIndex * 2] + normalColumnが 4 つで、10 になる
-		{"withCompositeIndex2 : 4-2000", 4, withCompositeIndex2, 2000, false},
-		{"withCompositeIndex2 : 4-2001", 4, withCompositeIndex2, 2001, true},
+		// withCompositeIndex2だけに値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithCompositeIndex2, 5:MeasureCompositeIndexWithCompositeIndex * 2 (U2, U3)] + normalColumnが 4 つで、10 になる
+		{"withCompositeIndex2 : 4-N", 4, withCompositeIndex2, int64(maxRows(10)), false},
+		{"withCompositeIndex2 : 4-N+1", 4, withCompositeIndex2, int64(maxRows(10) + 1), true},
 	}
 
 	for _, tt := range cases {
@@ -108,7 +108,7 @@ func TestMeasureCompositeIndex_Update(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -0,0 +1,50 @@
+package mutation_count_playground_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/experiment"
+)
+
+// TestExperiments is experiments/*.json の Spec をすべて実行する
+func TestExperiments(t *testing.T) {
+	ctx := context.Background()
+	sc := createApplier(ctx, t)
+
+	specs, err := experiment.LoadDir("experiments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &experiment.Runner{Client: sc, Mark: runMark, Limit: limitProfile().Limit, Keys: runKeys}
+	for _, s := range specs {
+		s := s
+		t.Run(s.Name, func(t *testing.T) {
+			for _, c := range s.Cases {
+				c := c
+				t.Run(c.Name, func(t *testing.T) {
+					res, err := runner.RunCase(ctx, s, c)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !res.Passed() {
+						if res.WantErr && res.Err == nil {
+							t.Errorf("want err but got err is nil")
+						} else {
+							t.Errorf("error.err=%+v", res.Err)
+						}
+					}
+					// Commit Stats が返ってきた場合は、1 行の Mutation 数を直接確かめる
+					if res.MutationCount > 0 {
+						t.Logf("rows=%d, mutationCount=%d", res.RowCount, res.MutationCount)
+						if c.PerRow > 0 {
+							if e, g := int64(c.PerRow*res.RowCount), res.MutationCount; e != g {
+								t.Errorf("want mutation count %d but got %d", e, g)
+							}
+						}
+					}
+				})
+			}
+		})
+	}
+}
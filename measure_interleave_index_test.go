@@ -3,11 +3,10 @@ package mutation_count_playground_test
 import (
 	"context"
 	"fmt"
-	"strings"
 	"testing"
 
 	"cloud.google.com/go/spanner"
-	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
 )
 
 const InterleaveParentWithIndexTable = "MeasureParentWithIndex"
@@ -15,7 +14,7 @@ const InterleaveChildWithIndexTable = "MeasureChildWithIndex"
 
 func TestMeasureInterleaveWithIndex_Insert(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 
@@ -28,8 +27,8 @@ func TestMeasureInterleaveWithIndex_Insert(t *testing.T) {
 	}{
 		// Parent: [1:ID, 2:Arr1, 3:CommitedAt] + normalColumnが 7 つで、10 になる
 		// Child: [1:ID, 2:ChildID, 3:Arr1, 4:CommitedAt, 5:With_Index1] + normalColumnが 7 - 2 つで、10 になる
-		{"empty : 7-1000", 7, empty, 1000, false},
-		{"empty : 7-1001", 7, empty, 1001, true},
+		{"empty : 7-N", 7, empty, maxRows(20), false},
+		{"empty : 7-N+1", 7, empty, maxRows(20) + 1, true},
 	}
 
 	for _, tt := range cases {
@@ -43,7 +42,7 @@ func TestMeasureInterleaveWithIndex_Insert(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -78,11 +77,9 @@ func createInterleaveWithIndexInsertMutations(normalColumnCount int, addColumn m
 
 func createInterleaveWithIndexParentInsertMutation(normalColumnCount int, addColumn map[string]interface{}) (string, *spanner.Mutation, error) {
 	v := make(map[string]interface{})
-	id := uuid.New().String()
+	id := runKeys.Next()
 	v["ID"] = id
-	for j := 1; j <= normalColumnCount; j++ {
-		v[fmt.Sprintf("Col%d", j)] = ""
-	}
+	putNormalColumns(v, normalColumnCount)
 
 	for addKey, addValue := range addColumn {
 		v[addKey] = addValue
@@ -99,12 +96,10 @@ func createInterleaveWithIndexChildInsertMutation(parentID string, normalColumnC
 	}
 
 	v := make(map[string]interface{})
-	id := uuid.New().String()
+	id := runKeys.Next()
 	v["ID"] = parentID
 	v["ChildID"] = id
-	for j := 1; j <= ncc; j++ {
-		v[fmt.Sprintf("Col%d", j)] = ""
-	}
+	putNormalColumns(v, ncc)
 
 	for addKey, addValue := range addColumn {
 		v[addKey] = addValue
@@ -116,7 +111,7 @@ func createInterleaveWithIndexChildInsertMutation(parentID string, normalColumnC
 
 func TestMeasureInterleaveWithIndex_Delete(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 
@@ -128,8 +123,8 @@ func TestMeasureInterleaveWithIndex_Delete(t *testing.T) {
 		wantErr           bool
 	}{
 		// [1:MeasureParent Table ,2:MeasureChildWithIndex1_1 INDEX Table]で、 2 になる
-		{"empty : 7-10000", 7, empty, 10000, false},
-		{"empty : 7-10001", 7, empty, 10001, true},
+		{"empty : 7-N", 7, empty, int64(maxRows(2)), false},
+		{"empty : 7-N+1", 7, empty, int64(maxRows(2) + 1), true},
 	}
 
 	for _, tt := range cases {
@@ -151,27 +146,15 @@ func TestMeasureInterleaveWithIndex_Delete(t *testing.T) {
 					ids = append(ids, parentID)
 					mus = append(mus, parentMu)
 					mus = append(mus, childMu)
-					if len(mus) > 100 {
-						_, err = sc.Apply(ctx, mus)
-						if err != nil {
-							t.Fatal("failed Insert...", err)
-						}
-						mus = []*spanner.Mutation{}
-					}
-				}
-				if len(mus) > 0 {
-					_, err := sc.Apply(ctx, mus)
-					if err != nil {
-						t.Fatal("failed Insert...", err)
-					}
 				}
+				applyInBatches(ctx, t, sc, mus)
 			}
 			mu := createDeleteMutation(t, InterleaveParentWithIndexTable, ids)
 			_, err := sc.Apply(ctx, mu)
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
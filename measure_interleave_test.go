@@ -3,11 +3,10 @@ package mutation_count_playground_test
 import (
 	"context"
 	"fmt"
-	"strings"
 	"testing"
 
 	"cloud.google.com/go/spanner"
-	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
 )
 
 const InterleaveParentTable = "MeasureParent"
@@ -15,7 +14,7 @@ const InterleaveChildTable = "MeasureChild"
 
 func TestMeasureInterleave_Insert(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 
@@ -28,8 +27,8 @@ func TestMeasureInterleave_Insert(t *testing.T) {
 	}{
 		// Parent: [1:ID, 2:Arr1, 3:CommitedAt] + normalColumnが 7 つで、10 になる
 		// Child: [1:ID, 2:ChildID, 3:Arr1, 4:CommitedAt] + normalColumnが 7 - 1 つで、10 になる
-		{"empty : 7-1000", 7, empty, 1000, false},
-		{"empty : 7-1001", 7, empty, 1001, true},
+		{"empty : 7-N", 7, empty, maxRows(20), false},
+		{"empty : 7-N+1", 7, empty, maxRows(20) + 1, true},
 	}
 
 	for _, tt := range cases {
@@ -43,7 +42,7 @@ func TestMeasureInterleave_Insert(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -79,11 +78,9 @@ func createInterleaveInsertMutations(normalColumnCount int, addColumn map[string
 
 func createInterleaveParentInsertMutation(normalColumnCount int, addColumn map[string]interface{}) (string, *spanner.Mutation, error) {
 	v := make(map[string]interface{})
-	id := uuid.New().String()
+	id := runKeys.Next()
 	v["ID"] = id
-	for j := 1; j <= normalColumnCount; j++ {
-		v[fmt.Sprintf("Col%d", j)] = ""
-	}
+	putNormalColumns(v, normalColumnCount)
 
 	for addKey, addValue := range addColumn {
 		v[addKey] = addValue
@@ -100,12 +97,10 @@ func createInterleaveChildInsertMutation(parentID string, normalColumnCount int,
 	}
 
 	v := make(map[string]interface{})
-	id := uuid.New().String()
+	id := runKeys.Next()
 	v["ID"] = parentID
 	v["ChildID"] = id
-	for j := 1; j <= ncc; j++ {
-		v[fmt.Sprintf("Col%d", j)] = ""
-	}
+	putNormalColumns(v, ncc)
 
 	for addKey, addValue := range addColumn {
 		v[addKey] = addValue
@@ -117,7 +112,7 @@ func createInterleaveChildInsertMutation(parentID string, normalColumnCount int,
 
 func TestMeasureInterleave_Delete(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 
@@ -129,8 +124,8 @@ func TestMeasureInterleave_Delete(t *testing.T) {
 		wantErr           bool
 	}{
 		// [1:MeasureParent Table]で、1 になる
-		{"empty : 7-20000", 7, empty, 20000, false},
-		{"empty : 7-20001", 7, empty, 20001, true},
+		{"empty : 7-N", 7, empty, int64(maxRows(1)), false},
+		{"empty : 7-N+1", 7, empty, int64(maxRows(1) + 1), true},
 	}
 
 	for _, tt := range cases {
@@ -152,27 +147,15 @@ func TestMeasureInterleave_Delete(t *testing.T) {
 					ids = append(ids, parentID)
 					mus = append(mus, parentMu)
 					mus = append(mus, childMu)
-					if len(mus) > 100 {
-						_, err = sc.Apply(ctx, mus)
-						if err != nil {
-							t.Fatal("failed Insert...", err)
-						}
-						mus = []*spanner.Mutation{}
-					}
-				}
-				if len(mus) > 0 {
-					_, err := sc.Apply(ctx, mus)
-					if err != nil {
-						t.Fatal("failed Insert...", err)
-					}
 				}
+				applyInBatches(ctx, t, sc, mus)
 			}
 			mu := createDeleteMutation(t, InterleaveParentTable, ids)
 			_, err := sc.Apply(ctx, mu)
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -0,0 +1,80 @@
+package mutation_count_playground_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/experiment"
+	"github.com/sinmetal/mutation_count_playground/matrix"
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+// TestMatrix is ddl/*.sql の Table の Index から組み合わせの Case を作って実行する
+// Case が多く時間がかかるので MUTATION_COUNT_MATRIX が指定されている時だけ実行する. all か Table 名を , 区切りで指定する
+func TestMatrix(t *testing.T) {
+	target := os.Getenv("MUTATION_COUNT_MATRIX")
+	if target == "" {
+		t.Skip("MUTATION_COUNT_MATRIX is not set")
+	}
+	tables := make(map[string]bool)
+	for _, v := range strings.Split(target, ",") {
+		tables[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+
+	files, err := filepath.Glob("ddl/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var specs []*experiment.Spec
+	for _, f := range files {
+		s, err := schema.ParseFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tbl := range s.Tables {
+			if !tables["all"] && !tables[strings.ToLower(tbl.Name)] {
+				continue
+			}
+			spec, err := matrix.Generate(f, tbl.Name, matrix.Options{})
+			if err != nil {
+				// Interleave の親子の Table は experiments/measure_interleave*.json で計測する
+				t.Logf("skip %s: %v", tbl.Name, err)
+				continue
+			}
+			specs = append(specs, spec)
+		}
+	}
+
+	ctx := context.Background()
+	sc := createApplier(ctx, t)
+	runner := &experiment.Runner{Client: sc, Mark: runMark, Limit: limitProfile().Limit, Keys: runKeys}
+	for _, s := range specs {
+		s := s
+		t.Run(s.Name, func(t *testing.T) {
+			for _, c := range s.Cases {
+				c := c
+				t.Run(c.Name, func(t *testing.T) {
+					res, err := runner.RunCase(ctx, s, c)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !res.Passed() {
+						if res.WantErr && res.Err == nil {
+							t.Errorf("want err but got err is nil")
+						} else {
+							t.Errorf("error.err=%+v", res.Err)
+						}
+					}
+					if res.MutationCount > 0 {
+						if e, g := int64(c.PerRow*res.RowCount), res.MutationCount; e != g {
+							t.Errorf("want mutation count %d but got %d", e, g)
+						}
+					}
+				})
+			}
+		})
+	}
+}
@@ -2,17 +2,17 @@ package mutation_count_playground_test
 
 import (
 	"context"
-	"strings"
 	"testing"
 
 	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
 )
 
 const StoringIndexTable = "MeasureWithStoring"
 
 func TestMeasureStoringIndex_Insert(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 	withStoringIndex1 := map[string]interface{}{"WithIndex1": ""}
@@ -27,20 +27,20 @@ func TestMeasureStoringIndex_Insert(t *testing.T) {
 		wantErr           bool
 	}{
 		// WithIndexをすべてNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:MeasureWithStoringWithIndex1_1, 5:MeasureWithStoringWithIndex2_1] + normalColumnが 5 つで、10 になる
-		{"empty : 5-2000", 5, empty, 2000, false},
-		{"empty : 5-2001", 5, empty, 2001, true},
+		{"empty : 5-N", 5, empty, maxRows(10), false},
+		{"empty : 5-N+1", 5, empty, maxRows(10) + 1, true},
 
 		//WithIndexに値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:MeasureWithStoringWithIndex1_1, 6:MeasureWithStoringWithIndex2_1] + normalColumnが 4 つで、10 になる
-		{"WithIndex1 : 4-2000", 4, withStoringIndex1, 2000, false},
-		{"WithIndex1 : 4-2001", 4, withStoringIndex1, 2001, true},
+		{"WithIndex1 : 4-N", 4, withStoringIndex1, maxRows(10), false},
+		{"WithIndex1 : 4-N+1", 4, withStoringIndex1, maxRows(10) + 1, true},
 
 		//WithIndexに値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex2, 5:MeasureWithStoringWithIndex1_1, 6:MeasureWithStoringWithIndex2_1] + normalColumnが 4 つで、10 になる
-		{"WithIndex2 : 3-2000", 4, withStoringIndex2, 2000, false},
-		{"WithIndex2 : 3-2001", 4, withStoringIndex2, 2001, true},
+		{"WithIndex2 : 3-N", 4, withStoringIndex2, maxRows(10), false},
+		{"WithIndex2 : 3-N+1", 4, withStoringIndex2, maxRows(10) + 1, true},
 
 		//WithIndexに値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:WithIndex2, 6:MeasureWithStoringWithIndex1_1, 7:MeasureWithStoringWithIndex2_1] + normalColumnが 3 つで、10 になる
-		{"withIndex1and2 : 3-2000", 3, withStoringIndex1and2, 2000, false},
-		{"withIndex1and2 : 3-2001", 3, withStoringIndex1and2, 2001, true},
+		{"withIndex1and2 : 3-N", 3, withStoringIndex1and2, maxRows(10), false},
+		{"withIndex1and2 : 3-N+1", 3, withStoringIndex1and2, maxRows(10) + 1, true},
 	}
 
 	for _, tt := range cases {
@@ -54,7 +54,7 @@ func TestMeasureStoringIndex_Insert(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -68,7 +68,7 @@ func TestMeasureStoringIndex_Insert(t *testing.T) {
 
 func TestMeasureStoringIndex_Update(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 	withStoringIndex := map[string]interface{}{"WithIndex1": ""}
@@ -83,20 +83,20 @@ func TestMeasureStoringIndex_Update(t *testing.T) {
 		wantErr           bool
 	}{
 		// WithIndexをすべてNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt] + normalColumnが 7 つで、10 になる
-		{"empty : 7-2000", 7, empty, 2000, false},
-		{"empty : 7-2001", 7, empty, 2001, true},
+		{"empty : 7-N", 7, empty, int64(maxRows(10)), false},
+		{"empty : 7-N+1", 7, empty, int64(maxRows(10) + 1), true},
 
-		// WithIndex1に値を入れて、WithIndex2をNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithStoringIndex1, , 5:WithStoringIndex2, 6:MeasureStoringIndexWithStoringIndex * 2] + normalColumnが 3 つで、10 になる
-		{"withIndex1 : 3-2000", 3, withStoringIndex, 2000, false},
-		{"withIndex1 : 3-2001", 3, withStoringIndex, 2001, true},
+		// WithIndex1に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:MeasureWithStoringWithIndex1_1 (古いEntryの削除 U2), 6:MeasureWithStoringWithIndex1_1 (新しいEntryの追加 U3), 7:MeasureWithStoringWithIndex1_1 のSTORING Storing1 (U3)] + normalColumnが 3 つで、10 になる
+		{"withIndex1 : 3-N", 3, withStoringIndex, int64(maxRows(10)), false},
+		{"withIndex1 : 3-N+1", 3, withStoringIndex, int64(maxRows(10) + 1), true},
 
-		// withStoringColumn1に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:Storing1, 5:MeasureWithStoringWithIndex1_1 * 2, 7:MeasureWithStoringWithIndex2_1 * 2] + normalColumnが 2 つで、10 になる
-		{"withStoringColumn1 : 2-2000", 2, withStoringColumn1, 2000, false},
-		{"withStoringColumn1 : 2-2001", 2, withStoringColumn1, 2001, true},
+		// withStoringColumn1に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:Storing1, 5:MeasureWithStoringWithIndex1_1 (U4), 6:MeasureWithStoringWithIndex1_1 のStoring1 (U4), 7:MeasureWithStoringWithIndex2_1 (U4), 8:MeasureWithStoringWithIndex2_1 のStoring1 (U4)] + normalColumnが 2 つで、10 になる
+		{"withStoringColumn1 : 2-N", 2, withStoringColumn1, int64(maxRows(10)), false},
+		{"withStoringColumn1 : 2-N+1", 2, withStoringColumn1, int64(maxRows(10) + 1), true},
 
-		// withStoringColumn2に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:Storing2, 5:MeasureWithStoringWithIndex2_1 * 2] + normalColumnが 4 つで、10 になる
-		{"withStoringColumn2 : 4-2000", 4, withStoringColumn2, 2000, false},
-		{"withStoringColumn2 : 4-2001", 4, withStoringColumn2, 2001, true},
+		// withStoringColumn2に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:Storing2, 5:MeasureWithStoringWithIndex2_1 (U4), 6:MeasureWithStoringWithIndex2_1 のStoring2 (U4)] + normalColumnが 4 つで、10 になる
+		{"withStoringColumn2 : 4-N", 4, withStoringColumn2, int64(maxRows(10)), false},
+		{"withStoringColumn2 : 4-N+1", 4, withStoringColumn2, int64(maxRows(10) + 1), true},
 	}
 
 	for _, tt := range cases {
@@ -118,7 +118,7 @@ func TestMeasureStoringIndex_Update(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -3,11 +3,21 @@ package mutation_count_playground_test
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"cloud.google.com/go/spanner"
-	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/applier"
+	"github.com/sinmetal/mutation_count_playground/backend"
+	"github.com/sinmetal/mutation_count_playground/batch"
+	"github.com/sinmetal/mutation_count_playground/cassette"
+	"github.com/sinmetal/mutation_count_playground/cleanup"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/keygen"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
 )
 
 const Table = "Measure"
@@ -15,7 +25,7 @@ const NoIndexTable = "MeasureNoIndex"
 
 func TestInsert(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 	wihtIndex1 := map[string]interface{}{"withIndex1": ""}
@@ -30,20 +40,20 @@ func TestInsert(t *testing.T) {
 		wantErr           bool
 	}{
 		// WithIndexをすべてNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:MeasureWithIndex1_1, 5:MeasureWithIndex2_1, 6:MeasureWithIndex2_2] + normalColumnが 4 つで、10 になる
-		{"empty : 4-2000", 4, empty, 2000, false},
-		{"empty : 4-2001", 4, empty, 2001, true},
+		{"empty : 4-N", 4, empty, maxRows(10), false},
+		{"empty : 4-N+1", 4, empty, maxRows(10) + 1, true},
 
 		// WithIndex1に値を入れて、WithIndex2をNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:MeasureWithIndex1_1, 6:MeasureWithIndex2_1, 7:MeasureWithIndex2_2] + normalColumnが 3 つで、10 になる
-		{"withIndex1 : 3-2000", 3, wihtIndex1, 2000, false},
-		{"withIndex1 : 3-2001", 3, wihtIndex1, 2001, true},
+		{"withIndex1 : 3-N", 3, wihtIndex1, maxRows(10), false},
+		{"withIndex1 : 3-N+1", 3, wihtIndex1, maxRows(10) + 1, true},
 
 		// WithIndex2に値を入れて、WithIndex1をNULLにした時、[1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex2, 5:MeasureWithIndex1_1, 6:MeasureWithIndex2_1, 7:MeasureWithIndex2_2] + normalColumnが 3 つで、10 になる
-		{"withIndex2 : 3-2000", 3, wihtIndex2, 2000, false},
-		{"withIndex2 : 3-2001", 3, wihtIndex2, 2001, true},
+		{"withIndex2 : 3-N", 3, wihtIndex2, maxRows(10), false},
+		{"withIndex2 : 3-N+1", 3, wihtIndex2, maxRows(10) + 1, true},
 
 		// WithIndex1とWithIndex2に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:WithIndex2, 6:MeasureWithIndex1_1, 7:MeasureWithIndex2_1, 8:MeasureWithIndex2_2] + normalColumnが 2 つで、10 になる
-		{"withIndexAll : 2-2000", 2, wihtIndexAll, 2000, false},
-		{"withIndexAll : 2-2001", 2, wihtIndexAll, 2001, true},
+		{"withIndexAll : 2-N", 2, wihtIndexAll, maxRows(10), false},
+		{"withIndexAll : 2-N+1", 2, wihtIndexAll, maxRows(10) + 1, true},
 	}
 
 	for _, tt := range cases {
@@ -57,7 +67,7 @@ func TestInsert(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -76,10 +86,8 @@ func createInsertMutation(table string, normalColumnCount int, addColumn map[str
 	list := make([]*spanner.Mutation, rowCount)
 	for i := 0; i < rowCount; i++ {
 		v := make(map[string]interface{})
-		v["ID"] = uuid.New().String()
-		for j := 1; j <= normalColumnCount; j++ {
-			v[fmt.Sprintf("Col%d", j)] = ""
-		}
+		v["ID"] = runKeys.Next()
+		putNormalColumns(v, normalColumnCount)
 
 		for addKey, addValue := range addColumn {
 			v[addKey] = addValue
@@ -94,17 +102,17 @@ func createInsertMutation(table string, normalColumnCount int, addColumn map[str
 
 func TestInsertNoIndexTable(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	cases := []struct {
 		name    string
 		count   int
 		wantErr bool
 	}{
-		{"100", 100, false},
-		{"1000", 1000, false},
-		{"2000", 2000, false},
-		{"2001", 2001, true},
+		{"N*5%", rowsPercent(10, 5), false},
+		{"N*50%", rowsPercent(10, 50), false},
+		{"N", maxRows(10), false},
+		{"N+1", maxRows(10) + 1, true},
 	}
 
 	for _, tt := range cases {
@@ -118,7 +126,7 @@ func TestInsertNoIndexTable(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -135,7 +143,7 @@ func createInsertMutationColCount10(table string, count int) ([]*spanner.Mutatio
 	list := make([]*spanner.Mutation, count)
 	for i := 0; i < count; i++ {
 		v := make(map[string]interface{})
-		v["ID"] = uuid.New().String()
+		v["ID"] = runKeys.Next()
 		v["Col1"] = ""
 		v["Col2"] = ""
 		v["Col3"] = ""
@@ -151,9 +159,11 @@ func createInsertMutationColCount10(table string, count int) ([]*spanner.Mutatio
 	return list, nil
 }
 
+// TestUpdate is UpdateMap の Mutation 数を計測する
+// Key の Column に値を指定した Index は、古い Entry の削除 (U2) と新しい Entry の追加 (U3) で 2 つ数えられる. ルールは estimator.Rules を参照
 func TestUpdate(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 	withIndex1 := map[string]interface{}{"withIndex1": ""}
@@ -168,23 +178,23 @@ func TestUpdate(t *testing.T) {
 		wantErr           bool
 	}{
 		// WithIndexをすべてNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt] + normalColumnが 7 つで、10 になる
-		{"empty : 7-2000", 7, empty, 2000, false},
-		{"empty : 7-2001", 7, empty, 2001, true},
-
-		// WithIndex1に値を入れて、WithIndex2をNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:MeasureWithIndex1_1, 6:?] + normalColumnが 4 つで、10 になる
-		{"withIndex1 : 4-2000", 4, withIndex1, 2000, false},
-		{"withIndex1 : 4-2001", 4, withIndex1, 2001, true},
-
-		// WithIndex2に値を入れて、WithIndex1をNULLにした時、[1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex2, 5:MeasureWithIndex2_1, 6:MeasureWithIndex2_2, 7:?, 8:?] + normalColumnが 2 つで、10 になる
-		{"withIndex2 : 2-2000", 2, withIndex2, 2000, false},
-		{"withIndex2 : 2-2001", 2, withIndex2, 2001, true},
-
-		// WithIndex1とWitnIndex2に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:WithIndex2, 6:MeasureWithIndex1_1, 7:MeasureWithIndex2_1, 8:MeasureWithIndex2_2, 9:?, 10:?, 11:?] + normalColumnが 0 つで、11 になる
-		{"withIndexAll : 0-1500", 0, withIndexAll, 1500, false},
-		{"withIndexAll : 0-1600", 0, withIndexAll, 1600, false},
-		{"withIndexAll : 0-1700", 0, withIndexAll, 1700, false},
-		{"withIndexAll : 0-1818", 0, withIndexAll, 1818, false},
-		{"withIndexAll : 0-1819", 0, withIndexAll, 1819, true},
+		{"empty : 7-N", 7, empty, int64(maxRows(10)), false},
+		{"empty : 7-N+1", 7, empty, int64(maxRows(10) + 1), true},
+
+		// WithIndex1に値を入れて、WithIndex2をNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:MeasureWithIndex1_1 (古いEntryの削除 U2), 6:MeasureWithIndex1_1 (新しいEntryの追加 U3)] + normalColumnが 4 つで、10 になる
+		{"withIndex1 : 4-N", 4, withIndex1, int64(maxRows(10)), false},
+		{"withIndex1 : 4-N+1", 4, withIndex1, int64(maxRows(10) + 1), true},
+
+		// WithIndex2に値を入れて、WithIndex1をNULLにした時、[1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex2, 5:MeasureWithIndex2_1 (U3), 6:MeasureWithIndex2_2 (U3), 7:MeasureWithIndex2_1 (U2), 8:MeasureWithIndex2_2 (U2)] + normalColumnが 2 つで、10 になる
+		{"withIndex2 : 2-N", 2, withIndex2, int64(maxRows(10)), false},
+		{"withIndex2 : 2-N+1", 2, withIndex2, int64(maxRows(10) + 1), true},
+
+		// WithIndex1とWitnIndex2に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:WithIndex2, 6:MeasureWithIndex1_1 (U3), 7:MeasureWithIndex2_1 (U3), 8:MeasureWithIndex2_2 (U3), 9:MeasureWithIndex1_1 (U2), 10:MeasureWithIndex2_1 (U2), 11:MeasureWithIndex2_2 (U2)] + normalColumnが 0 つで、11 になる
+		{"withIndexAll : 0-N*25%", 0, withIndexAll, int64(rowsPercent(11, 25)), false},
+		{"withIndexAll : 0-N*50%", 0, withIndexAll, int64(rowsPercent(11, 50)), false},
+		{"withIndexAll : 0-N*75%", 0, withIndexAll, int64(rowsPercent(11, 75)), false},
+		{"withIndexAll : 0-N", 0, withIndexAll, int64(maxRows(11)), false},
+		{"withIndexAll : 0-N+1", 0, withIndexAll, int64(maxRows(11) + 1), true},
 	}
 
 	for _, tt := range cases {
@@ -206,7 +216,7 @@ func TestUpdate(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -224,10 +234,11 @@ func createInsertMutationForUpdateTest(table string, rowCount int64) ([]string,
 	var ids = make([]string, rowCount)
 	list := make([]*spanner.Mutation, rowCount)
 	for i := int64(0); i < rowCount; i++ {
-		id := uuid.New().String()
+		id := runKeys.Next()
 		ids[i] = id
 		v := make(map[string]interface{})
 		v["ID"] = id
+		v["Mark"] = runMark
 		v["CommitedAt"] = spanner.CommitTimestamp
 		list[i] = spanner.InsertMap(table, v)
 	}
@@ -264,7 +275,7 @@ func createUpdateMutation(t *testing.T, table string, updateIDs []string, normal
 
 func TestUpdateDML(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 	withIndex1 := map[string]interface{}{"withIndex1": ""}
@@ -279,29 +290,29 @@ func TestUpdateDML(t *testing.T) {
 		wantErr           bool
 	}{
 		// WithIndexをすべてNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt] + normalColumnが 7 つで、10 になる
-		{"empty : 7-2000", 7, empty, 2000, false},
-		{"empty : 7-2001", 7, empty, 2001, true},
-
-		// WithIndex1に値を入れて、WithIndex2をNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:MeasureWithIndex1_1, 6:?] + normalColumnが 4 つで、10 になる
-		{"withIndex1 : 4-2000", 4, withIndex1, 2000, false},
-		{"withIndex1 : 4-2001", 4, withIndex1, 2001, true},
-
-		// WithIndex2に値を入れて、WithIndex1をNULLにした時、[1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex2, 5:MeasureWithIndex2_1, 6:MeasureWithIndex2_2, 7:?, 8:?] + normalColumnが 2 つで、10 になる
-		{"withIndex2 : 2-2000", 2, withIndex2, 2000, false},
-		{"withIndex2 : 2-2001", 2, withIndex2, 2001, true},
-
-		// WithIndex1とWitnIndex2に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:WithIndex2, 6:MeasureWithIndex1_1, 7:MeasureWithIndex2_1, 8:MeasureWithIndex2_2, 9:?, 10:?, 11:?] + normalColumnが 0 つで、11 になる
-		{"withIndexAll : 0-1500", 0, withIndexAll, 1500, false},
-		{"withIndexAll : 0-1600", 0, withIndexAll, 1600, false},
-		{"withIndexAll : 0-1700", 0, withIndexAll, 1700, false},
-		{"withIndexAll : 0-1818", 0, withIndexAll, 1818, false},
-		{"withIndexAll : 0-1819", 0, withIndexAll, 1819, true},
+		{"empty : 7-N", 7, empty, int64(maxRows(10)), false},
+		{"empty : 7-N+1", 7, empty, int64(maxRows(10) + 1), true},
+
+		// WithIndex1に値を入れて、WithIndex2をNULLにした時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:MeasureWithIndex1_1 (古いEntryの削除 U2), 6:MeasureWithIndex1_1 (新しいEntryの追加 U3)] + normalColumnが 4 つで、10 になる
+		{"withIndex1 : 4-N", 4, withIndex1, int64(maxRows(10)), false},
+		{"withIndex1 : 4-N+1", 4, withIndex1, int64(maxRows(10) + 1), true},
+
+		// WithIndex2に値を入れて、WithIndex1をNULLにした時、[1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex2, 5:MeasureWithIndex2_1 (U3), 6:MeasureWithIndex2_2 (U3), 7:MeasureWithIndex2_1 (U2), 8:MeasureWithIndex2_2 (U2)] + normalColumnが 2 つで、10 になる
+		{"withIndex2 : 2-N", 2, withIndex2, int64(maxRows(10)), false},
+		{"withIndex2 : 2-N+1", 2, withIndex2, int64(maxRows(10) + 1), true},
+
+		// WithIndex1とWitnIndex2に値を入れた時、 [1:ID, 2:Arr1, 3:CommitedAt, 4:WithIndex1, 5:WithIndex2, 6:MeasureWithIndex1_1 (U3), 7:MeasureWithIndex2_1 (U3), 8:MeasureWithIndex2_2 (U3), 9:MeasureWithIndex1_1 (U2), 10:MeasureWithIndex2_1 (U2), 11:MeasureWithIndex2_2 (U2)] + normalColumnが 0 つで、11 になる
+		{"withIndexAll : 0-N*25%", 0, withIndexAll, int64(rowsPercent(11, 25)), false},
+		{"withIndexAll : 0-N*50%", 0, withIndexAll, int64(rowsPercent(11, 50)), false},
+		{"withIndexAll : 0-N*75%", 0, withIndexAll, int64(rowsPercent(11, 75)), false},
+		{"withIndexAll : 0-N", 0, withIndexAll, int64(maxRows(11)), false},
+		{"withIndexAll : 0-N+1", 0, withIndexAll, int64(maxRows(11) + 1), true},
 	}
 
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			mark := uuid.New().String()
+			mark := runMark + "/" + runKeys.Next()
 			{
 				// UPDATEするために先にINSERTする
 				var mu []*spanner.Mutation
@@ -314,18 +325,11 @@ func TestUpdateDML(t *testing.T) {
 			}
 
 			sql := createUpdateDML(mark, tt.normalColumnCount, tt.updateColumn)
-			_, err := sc.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
-				_, err := txn.Update(ctx, spanner.NewStatement(sql))
-				if err != nil {
-					return err
-				}
-
-				return nil
-			})
+			_, err := sc.Update(ctx, spanner.NewStatement(sql))
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -343,7 +347,7 @@ func createInsertMutationForUpdateDMLTest(table string, mark string, rowCount in
 	var ids = make([]string, rowCount)
 	list := make([]*spanner.Mutation, rowCount)
 	for i := int64(0); i < rowCount; i++ {
-		id := uuid.New().String()
+		id := runKeys.Next()
 		ids[i] = id
 		v := make(map[string]interface{})
 		v["ID"] = id
@@ -384,7 +388,7 @@ func createUpdateDML(mark string, normalColumnCount int, updateColumn map[string
 
 func TestMeasure_Delete(t *testing.T) {
 	ctx := context.Background()
-	sc := createClient(ctx, t)
+	sc := createApplier(ctx, t)
 
 	empty := make(map[string]interface{})
 	withIndex1 := map[string]interface{}{"withIndex1": ""}
@@ -399,21 +403,21 @@ func TestMeasure_Delete(t *testing.T) {
 		wantErr           bool
 	}{
 		// WithIndexをすべてNULLにした時、[1:Measure Table , 2:MeasureWithIndex1_1 INDEX Table, 3:MeasureWithIndex2_1 INDEX Table, 4:MeasureWithIndex2_2]で、 4 になる
-		{"empty : 7-2000", 7, empty, 2000, false},
-		{"empty : 7-5000", 7, empty, 5000, false},
-		{"empty : 7-5001", 7, empty, 5001, true},
+		{"empty : 7-N*40%", 7, empty, int64(rowsPercent(4, 40)), false},
+		{"empty : 7-N", 7, empty, int64(maxRows(4)), false},
+		{"empty : 7-N+1", 7, empty, int64(maxRows(4) + 1), true},
 
 		// WithIndex1に値を入れて、WithIndex2をNULLにした時、[1:Measure Table , 2:MeasureWithIndex1_1 INDEX Table, 3:MeasureWithIndex2_1 INDEX Table, 4:MeasureWithIndex2_2]で、 4 になる
-		{"withIndex1 : 4-5000", 4, withIndex1, 5000, false},
-		{"withIndex1 : 4-5001", 4, withIndex1, 5001, true},
+		{"withIndex1 : 4-N", 4, withIndex1, int64(maxRows(4)), false},
+		{"withIndex1 : 4-N+1", 4, withIndex1, int64(maxRows(4) + 1), true},
 
 		// WithIndex2に値を入れて、WithIndex1をNULLにした時、[1:Measure Table , 2:MeasureWithIndex1_1 INDEX Table, 3:MeasureWithIndex2_1 INDEX Table, 4:MeasureWithIndex2_2]で、 4 になる
-		{"withIndex2 : 2-5000", 2, withIndex2, 5000, false},
-		{"withIndex2 : 2-5001", 2, withIndex2, 5001, true},
+		{"withIndex2 : 2-N", 2, withIndex2, int64(maxRows(4)), false},
+		{"withIndex2 : 2-N+1", 2, withIndex2, int64(maxRows(4) + 1), true},
 
 		// WithIndex1とWitnIndex2に値を入れた時、[1:Measure Table , 2:MeasureWithIndex1_1 INDEX Table, 3:MeasureWithIndex2_1 INDEX Table, 4:MeasureWithIndex2_2]で、 4 になる
-		{"withIndexAll : 0-5000", 0, withIndexAll, 5000, false},
-		{"withIndexAll : 0-5001", 0, withIndexAll, 5001, true},
+		{"withIndexAll : 0-N", 0, withIndexAll, int64(maxRows(4)), false},
+		{"withIndexAll : 0-N+1", 0, withIndexAll, int64(maxRows(4) + 1), true},
 	}
 
 	for _, tt := range cases {
@@ -430,27 +434,15 @@ func TestMeasure_Delete(t *testing.T) {
 					}
 					ids = append(ids, id)
 					mus = append(mus, mu)
-					if len(mus) > 100 {
-						_, err = sc.Apply(ctx, mus)
-						if err != nil {
-							t.Fatal("failed Insert...", err)
-						}
-						mus = []*spanner.Mutation{}
-					}
-				}
-				if len(mus) > 0 {
-					_, err := sc.Apply(ctx, mus)
-					if err != nil {
-						t.Fatal("failed Insert...", err)
-					}
 				}
+				applyInBatches(ctx, t, sc, mus)
 			}
 			mu := createDeleteMutation(t, Table, ids)
 			_, err := sc.Apply(ctx, mu)
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("want err but got err is nil")
-				} else if !strings.Contains(err.Error(), "The transaction contains too many mutations") {
+				} else if !spanerr.IsMutationLimit(err) {
 					t.Errorf("error.err=%+v", err)
 				}
 			} else {
@@ -464,9 +456,10 @@ func TestMeasure_Delete(t *testing.T) {
 
 // createInsertMutationForDeleteTest is Delete のTestをする時に先にInsertするためのMutationを作る
 func createInsertMutationForDeleteTest(table string, normalColumnCount int, insertColumn map[string]interface{}) (string, *spanner.Mutation, error) {
-	id := uuid.New().String()
+	id := runKeys.Next()
 	v := make(map[string]interface{})
 	v["ID"] = id
+	v["Mark"] = runMark
 	v["CommitedAt"] = spanner.CommitTimestamp
 	for j := 1; j <= normalColumnCount; j++ {
 		v[fmt.Sprintf("Col%d", j)] = ""
@@ -500,17 +493,173 @@ func createDeleteMutationByKey(t *testing.T, table string, deleteKeys []*spanner
 	return list
 }
 
-func createClient(ctx context.Context, t *testing.T) *spanner.Client {
-	config := spanner.ClientConfig{
-		NumChannels: 12,
-		SessionPoolConfig: spanner.SessionPoolConfig{
-			MinOpened: 50,
-		},
+// applyInBatches is Mutation数の上限に収まるように分割してApplyする
+// DELETEのTestの前準備のように、数が多いINSERTをするために使う
+func applyInBatches(ctx context.Context, t *testing.T, sc applier.Applier, mus []*spanner.Mutation) {
+	w := &batch.Writer{Applier: sc, Schema: loadSchema(t), Limit: limitProfile().Limit}
+	results, err := w.Apply(ctx, mus)
+	if err != nil {
+		t.Fatal("failed Insert...", err)
+	}
+	if err := batch.FirstError(results); err != nil {
+		t.Fatal("failed Insert...", err)
+	}
+}
+
+// loadSchema is ddl/ のすべての Table を読み込む
+func loadSchema(t *testing.T) *schema.Schema {
+	s, err := schema.LoadDir("ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// limitProfile is 接続先の Mutation 数の上限の Profile. MUTATION_COUNT_LIMIT で指定する
+// 接続先を開いていない場合は Legacy
+func limitProfile() estimator.Profile {
+	if testBackend == nil {
+		return estimator.Legacy
+	}
+	p, err := testBackend.Config.LimitProfile()
+	if err != nil {
+		// Open する時に Validate しているので、ここには来ない
+		panic(err)
+	}
+	return p
+}
+
+// maxRows is 1 行 perRow の Mutation を 1 つの Commit に含めることができる最大の行数. Case の N と N+1 はここから求める
+// 行数は limitProfile から求めるので、createApplier で接続先を開いた後に呼ぶ
+func maxRows(perRow int) int {
+	return limitProfile().MaxRows(perRow)
+}
+
+// rowsPercent is maxRows の percent % の行数. 上限より少ない行数の Case に使い、experiment の Case の percent と同じ値になる
+func rowsPercent(perRow, percent int) int {
+	return maxRows(perRow) * percent / 100
+}
+
+// runMark is この実行で書き込む行の Mark. Test が終わった後に、この Mark から始まる行を削除する
+var runMark = cleanup.MarkFromEnv()
+
+// runKeys is この実行で書き込む行の ID を作る. MUTATION_COUNT_KEYGEN で選び、TestMain で作る
+var runKeys keygen.Generator
+
+// putNormalColumns is INDEXが付いていないカラムに値を入れる
+// Mark もINDEXが付いていないカラムなので、Col1...Col(normalColumnCount-1) と Mark で normalColumnCount 個になる
+func putNormalColumns(v map[string]interface{}, normalColumnCount int) {
+	for j := 1; j < normalColumnCount; j++ {
+		v[fmt.Sprintf("Col%d", j)] = ""
+	}
+	if normalColumnCount > 0 {
+		v["Mark"] = runMark
+	}
+}
+
+// TestMain is Test がすべて終わった後に、書き込んだ行を削除して、Open した接続先を閉じる
+func TestMain(m *testing.M) {
+	var err error
+	runKeys, err = keygen.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if runKeys.String() != keygen.KindRandom {
+		// 同じ Key で再現できるように、SEED を含めた値を表示する
+		fmt.Printf("keygen: %s=%s\n", keygen.EnvKeyGen, runKeys)
+	}
+
+	code := m.Run()
+	if testBackend != nil {
+		ctx := context.Background()
+		if err := cleanupRows(ctx, testBackend); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if err := testBackend.Close(ctx); err != nil {
+			// Cassette の再生で記録と一致しなかった場合もここで分かるので、失敗にする
+			fmt.Fprintln(os.Stderr, err)
+			if code == 0 {
+				code = 1
+			}
+		}
+	}
+	os.Exit(code)
+}
+
+// cleanupRows is runMark の行を削除する
+// Close で Database ごと無くなる場合と、MUTATION_COUNT_KEEP_ROWS が指定されている場合は削除しない
+func cleanupRows(ctx context.Context, b *backend.Backend) error {
+	if b.Temporary() || os.Getenv(cleanup.EnvKeepRows) != "" {
+		return nil
+	}
+	sc, err := schema.LoadDir("ddl")
+	if err != nil {
+		return err
+	}
+	client, err := b.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	c := &cleanup.Cleaner{Client: client, Schema: sc}
+	targets, err := c.Clean(ctx, runMark)
+	if err != nil {
+		return fmt.Errorf("failed cleanup mark=%s: %v", runMark, err)
+	}
+	for _, t := range targets {
+		fmt.Printf("cleanup %s: %d rows (mark=%s)\n", t.Table, len(t.Keys), runMark)
+	}
+	return nil
+}
+
+var (
+	backendOnce sync.Once
+	testBackend *backend.Backend
+	backendErr  error
+)
+
+// openBackend is 環境変数で指定された接続先を 1 つだけ開く
+func openBackend() (*backend.Backend, error) {
+	backendOnce.Do(func() {
+		var c *backend.Config
+		c, backendErr = backend.FromEnv()
+		if backendErr != nil {
+			return
+		}
+		testBackend, backendErr = backend.Open(context.Background(), c)
+	})
+	return testBackend, backendErr
+}
+
+// createApplier is 環境変数で指定された接続先の applier.Applier を作成する. 接続先が指定されていない場合は Skip する
+// MUTATION_COUNT_BACKEND=dryrun の場合は Spanner に接続せず、estimator の見積もりだけで同じ Case を実行する
+func createApplier(ctx context.Context, t *testing.T) applier.Applier {
+	b, err := openBackend()
+	if err == backend.ErrNotConfigured {
+		t.Skip(err)
 	}
-	dataClient, err := spanner.NewClientWithConfig(ctx, "projects/gcpug-public-spanner/instances/merpay-sponsored-instance/databases/sinmetal", config)
 	if err != nil {
 		t.Fatal(err)
 	}
+	a, err := b.NewApplier(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := b.Cassette(); d != nil {
+		// 記録していない Test は再生できないので失敗にする. MUTATION_COUNT_CASSETTE_SKIP_MISSING を指定した場合だけ Skip する
+		if d.Mode == cassette.Replay && !d.Recorded(t.Name()) {
+			msg := fmt.Sprintf("cassette %s is not recorded in %s. record it against Cloud Spanner first: %s=projects/PROJECT_ID/instances/INSTANCE_ID/databases/DATABASE_ID %s=record go test -run '%s' .",
+				t.Name(), d.Dir, backend.EnvDatabase, backend.EnvCassette, strings.SplitN(t.Name(), "/", 2)[0])
+			if b.Config.CassetteSkipMissing {
+				t.Skip(msg)
+			}
+			t.Fatal(msg)
+		}
+		// Test ごとの Cassette に Commit と ExecuteSql を記録か再生する
+		return &cassette.Applier{Applier: a, Name: t.Name()}
+	}
 
-	return dataClient
+	return a
 }
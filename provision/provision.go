@@ -0,0 +1,123 @@
+// Package provision is ddl/*.sql の Schema を持つ Database を Database Admin API で作成、削除する
+//
+// 計測を始める前に毎回同じ Schema の Database を用意できるように、新しい Database を作成するか、
+// 既存の Database にまだ無い Table と Index だけを作成する
+package provision
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"github.com/google/uuid"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+)
+
+// Provisioner is DDLDir の DDL を Database に適用する
+type Provisioner struct {
+	Admin *database.DatabaseAdminClient
+
+	// DDLDir is 適用する *.sql がある Directory. 省略した場合は ddl
+	DDLDir string
+}
+
+func (p *Provisioner) statements() ([]string, error) {
+	dir := p.DDLDir
+	if dir == "" {
+		dir = "ddl"
+	}
+	return schema.ReadStatements(dir)
+}
+
+// Create is instance に databaseID の Database を作成して DDL を適用する
+// instance は projects/PROJECT_ID/instances/INSTANCE_ID の形式. 作成した Database の名前を返す
+func (p *Provisioner) Create(ctx context.Context, instance, databaseID string) (string, error) {
+	statements, err := p.statements()
+	if err != nil {
+		return "", err
+	}
+	op, err := p.Admin.CreateDatabase(ctx, &adminpb.CreateDatabaseRequest{
+		Parent:          instance,
+		CreateStatement: fmt.Sprintf("CREATE DATABASE `%s`", databaseID),
+		ExtraStatements: statements,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed CreateDatabase %s/databases/%s: %v", instance, databaseID, err)
+	}
+	db, err := op.Wait(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed CreateDatabase %s/databases/%s: %v", instance, databaseID, err)
+	}
+	return db.Name, nil
+}
+
+// Apply is 既存の Database に、まだ無い Table と Index の DDL だけを適用する
+// 適用した Statement を返す
+func (p *Provisioner) Apply(ctx context.Context, db string) ([]string, error) {
+	statements, err := p.statements()
+	if err != nil {
+		return nil, err
+	}
+	current, err := p.Admin.GetDatabaseDdl(ctx, &adminpb.GetDatabaseDdlRequest{Database: db})
+	if err != nil {
+		return nil, fmt.Errorf("failed GetDatabaseDdl %s: %v", db, err)
+	}
+	exists := make(map[string]bool)
+	for _, s := range current.Statements {
+		if name := objectName(s); name != "" {
+			exists[name] = true
+		}
+	}
+	var list []string
+	for _, s := range statements {
+		if name := objectName(s); name != "" && exists[name] {
+			continue
+		}
+		list = append(list, s)
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	op, err := p.Admin.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{Database: db, Statements: list})
+	if err != nil {
+		return nil, fmt.Errorf("failed UpdateDatabaseDdl %s: %v", db, err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("failed UpdateDatabaseDdl %s: %v", db, err)
+	}
+	return list, nil
+}
+
+// Drop is Database を削除する
+func (p *Provisioner) Drop(ctx context.Context, db string) error {
+	if err := p.Admin.DropDatabase(ctx, &adminpb.DropDatabaseRequest{Database: db}); err != nil {
+		return fmt.Errorf("failed DropDatabase %s: %v", db, err)
+	}
+	return nil
+}
+
+// NewDatabaseID is Create に渡す Database ID を作成する
+// Database ID は 30 文字以内なので、prefix が長い場合は切り詰めてからランダムな値を繋げる. prefix は小文字から始まる必要がある
+func NewDatabaseID(prefix string) string {
+	suffix := strings.Replace(uuid.New().String(), "-", "", -1)[:12]
+	if max := 30 - len(suffix) - 1; len(prefix) > max {
+		prefix = prefix[:max]
+	}
+	return strings.ToLower(prefix + "-" + suffix)
+}
+
+var objectNamePattern = regexp.MustCompile("(?is)^\\s*CREATE\\s+(?:UNIQUE\\s+)?(?:NULL_FILTERED\\s+)?(TABLE|INDEX)\\s+`?(\\w+)`?")
+
+// objectName is CREATE TABLE, CREATE INDEX の Statement が作成する Table か Index の名前を返す
+// Table と Index は同じ名前を持てないので、種類は区別しない
+func objectName(statement string) string {
+	m := objectNamePattern.FindStringSubmatch(statement)
+	if m == nil {
+		return ""
+	}
+	return strings.ToLower(m[2])
+}
@@ -0,0 +1,136 @@
+package provision_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/provision"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+)
+
+const instance = "projects/fake/instances/fake"
+
+func newProvisioner(ctx context.Context, t *testing.T) (*fakespanner.Server, *provision.Provisioner) {
+	s, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := database.NewDatabaseAdminClient(ctx, s.ClientOptions()...)
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, &provision.Provisioner{Admin: admin, DDLDir: "../ddl"}
+}
+
+func TestProvisioner_CreateAndDrop(t *testing.T) {
+	ctx := context.Background()
+	s, p := newProvisioner(ctx, t)
+	defer s.Close()
+	defer p.Admin.Close()
+
+	name, err := p.Create(ctx, instance, provision.NewDatabaseID("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := s.Database(name)
+	if db == nil {
+		t.Fatalf("database %s is not found", name)
+	}
+	if e, g := 10, len(db.Schema().Tables); e != g {
+		t.Errorf("want tables %d but got %d", e, g)
+	}
+
+	// 作成した直後なので、追加する Statement は無い
+	applied, err := p.Apply(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 0, len(applied); e != g {
+		t.Errorf("want applied %d but got %d. %q", e, g, applied)
+	}
+
+	if err := p.Drop(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if s.Database(name) != nil {
+		t.Errorf("database %s is not dropped", name)
+	}
+}
+
+func TestProvisioner_Apply(t *testing.T) {
+	ctx := context.Background()
+	s, p := newProvisioner(ctx, t)
+	defer s.Close()
+	defer p.Admin.Close()
+
+	// Measure Table だけがある Database に残りを適用する
+	statements, err := schema.ReadStatements("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var measure []string
+	for _, stmt := range statements {
+		if strings.HasPrefix(stmt, "CREATE TABLE Measure (") {
+			measure = append(measure, stmt)
+		}
+	}
+	op, err := p.Admin.CreateDatabase(ctx, &adminpb.CreateDatabaseRequest{
+		Parent:          instance,
+		CreateStatement: "CREATE DATABASE `partial`",
+		ExtraStatements: measure,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := op.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	name := instance + "/databases/partial"
+	if e, g := 1, len(s.Database(name).Schema().Tables); e != g {
+		t.Fatalf("want tables %d but got %d", e, g)
+	}
+
+	applied, err := p.Apply(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range applied {
+		if strings.Contains(stmt, "CREATE TABLE Measure (") {
+			t.Errorf("existing table is applied again. %s", stmt)
+		}
+	}
+	if e, g := len(statements)-1, len(applied); e != g {
+		t.Errorf("want applied %d but got %d", e, g)
+	}
+	if e, g := 10, len(s.Database(name).Schema().Tables); e != g {
+		t.Errorf("want tables %d but got %d", e, g)
+	}
+}
+
+func TestNewDatabaseID(t *testing.T) {
+	cases := []struct {
+		name   string
+		prefix string
+	}{
+		{"short", "mutcount"},
+		{"long", "mutation-count-playground-measure"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := provision.NewDatabaseID(tt.prefix)
+			if len(got) > 30 {
+				t.Errorf("database id %s is too long", got)
+			}
+			if got[0] != tt.prefix[0] {
+				t.Errorf("database id %s does not start with prefix %s", got, tt.prefix)
+			}
+		})
+	}
+}
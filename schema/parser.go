@@ -0,0 +1,524 @@
+package schema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ParseFile is DDL が書かれたファイルを読み込んで Schema を作成する
+func ParseFile(path string) (*Schema, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// LoadDir is dir にある *.sql をすべて読み込んで 1 つの Schema にする
+// ddl/ のように Table ごとにファイルが分かれている場合に使う
+func LoadDir(dir string) (*Schema, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: no .sql files", dir)
+	}
+	sort.Strings(paths)
+
+	var ddl []string
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		ddl = append(ddl, string(b))
+	}
+	// ファイルの末尾に ; が無くても Statement が繋がらないように区切る
+	return Parse(strings.Join(ddl, ";\n"))
+}
+
+// Parse is CREATE TABLE, CREATE INDEX を含む DDL を Parse して Schema を作成する
+// Statement は ; で区切られている必要がある
+func Parse(ddl string) (*Schema, error) {
+	p := &parser{tokens: tokenize(ddl)}
+	s := &Schema{}
+	var indexes []*Index
+	for {
+		for p.eat(";") {
+		}
+		if p.done() {
+			break
+		}
+		switch {
+		case p.peekKeyword("CREATE", "TABLE"):
+			t, err := p.parseCreateTable()
+			if err != nil {
+				return nil, err
+			}
+			if s.Table(t.Name) != nil {
+				return nil, fmt.Errorf("duplicate table %s", t.Name)
+			}
+			s.Tables = append(s.Tables, t)
+		case p.peekKeyword("CREATE"):
+			idx, err := p.parseCreateIndex()
+			if err != nil {
+				return nil, err
+			}
+			indexes = append(indexes, idx)
+		default:
+			return nil, p.errorf("unsupported statement")
+		}
+		if !p.done() && !p.eat(";") {
+			return nil, p.errorf("want ;")
+		}
+	}
+
+	for _, idx := range indexes {
+		t := s.Table(idx.Table)
+		if t == nil {
+			return nil, fmt.Errorf("index %s: table %s is not found", idx.Name, idx.Table)
+		}
+		for _, k := range idx.Columns {
+			if t.Column(k.Column) == nil {
+				return nil, fmt.Errorf("index %s: column %s is not found in table %s", idx.Name, k.Column, t.Name)
+			}
+		}
+		for _, c := range idx.Storing {
+			if t.Column(c) == nil {
+				return nil, fmt.Errorf("index %s: storing column %s is not found in table %s", idx.Name, c, t.Name)
+			}
+		}
+		t.Indexes = append(t.Indexes, idx)
+	}
+	for _, t := range s.Tables {
+		if t.Interleave != nil && s.Table(t.Interleave.Parent) == nil {
+			return nil, fmt.Errorf("table %s: parent table %s is not found", t.Name, t.Interleave.Parent)
+		}
+	}
+	return s, nil
+}
+
+// parseCreateTable is CREATE TABLE Statement を Parse する
+//
+//	CREATE TABLE name ( column_def, ... ) PRIMARY KEY ( key_part, ... ) [, INTERLEAVE IN PARENT name [ON DELETE {CASCADE | NO ACTION}]]
+func (p *parser) parseCreateTable() (*Table, error) {
+	p.next() // CREATE
+	p.next() // TABLE
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	t := &Table{Name: name}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.eat(")") {
+		c, err := p.parseColumnDef()
+		if err != nil {
+			return nil, err
+		}
+		t.Columns = append(t.Columns, c)
+		if !p.eat(",") {
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if err := p.expectKeyword("PRIMARY", "KEY"); err != nil {
+		return nil, err
+	}
+	t.PrimaryKey, err = p.parseKeyPartList()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range t.PrimaryKey {
+		if t.Column(k.Column) == nil {
+			return nil, fmt.Errorf("table %s: primary key column %s is not found", t.Name, k.Column)
+		}
+	}
+
+	if p.eat(",") {
+		if err := p.expectKeyword("INTERLEAVE", "IN", "PARENT"); err != nil {
+			return nil, err
+		}
+		parent, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		t.Interleave = &Interleave{Parent: parent, OnDelete: NoAction}
+		if p.eatKeyword("ON", "DELETE") {
+			switch {
+			case p.eatKeyword("CASCADE"):
+				t.Interleave.OnDelete = Cascade
+			case p.eatKeyword("NO", "ACTION"):
+				t.Interleave.OnDelete = NoAction
+			default:
+				return nil, p.errorf("want CASCADE or NO ACTION")
+			}
+		}
+	}
+	return t, nil
+}
+
+// parseColumnDef is Column の定義を Parse する
+//
+//	name type [NOT NULL] [OPTIONS ( allow_commit_timestamp = { true | null } )]
+func (p *parser) parseColumnDef() (*Column, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	typ, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	c := &Column{Name: name, Type: typ}
+	if p.eatKeyword("NOT", "NULL") {
+		c.NotNull = true
+	}
+	if p.eatKeyword("OPTIONS") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for !p.eat(")") {
+			key, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			value := p.next()
+			if value == nil {
+				return nil, p.errorf("want option value")
+			}
+			if strings.EqualFold(key, "allow_commit_timestamp") {
+				c.AllowCommitTimestamp = strings.EqualFold(value.text, "true")
+			}
+			p.eat(",")
+		}
+	}
+	return c, nil
+}
+
+// parseType is Column の型を Parse する. STRING(MAX) や ARRAY<STRING(MAX)> のように正規化した文字列を返す
+func (p *parser) parseType() (string, error) {
+	base, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	base = strings.ToUpper(base)
+	switch base {
+	case "ARRAY":
+		if err := p.expect("<"); err != nil {
+			return "", err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect(">"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ARRAY<%s>", elem), nil
+	case "STRING", "BYTES":
+		if err := p.expect("("); err != nil {
+			return "", err
+		}
+		l := p.next()
+		if l == nil {
+			return "", p.errorf("want length")
+		}
+		if err := p.expect(")"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s(%s)", base, strings.ToUpper(l.text)), nil
+	case "BOOL", "INT64", "FLOAT64", "DATE", "TIMESTAMP":
+		return base, nil
+	default:
+		return "", p.errorf("unsupported type %s", base)
+	}
+}
+
+// parseCreateIndex is CREATE INDEX Statement を Parse する
+//
+//	CREATE [UNIQUE] [NULL_FILTERED] INDEX name ON table ( key_part, ... ) [STORING ( column, ... )] [, INTERLEAVE IN table]
+func (p *parser) parseCreateIndex() (*Index, error) {
+	p.next() // CREATE
+	idx := &Index{}
+	if p.eatKeyword("UNIQUE") {
+		idx.Unique = true
+	}
+	if p.eatKeyword("NULL_FILTERED") {
+		idx.NullFiltered = true
+	}
+	if err := p.expectKeyword("INDEX"); err != nil {
+		return nil, err
+	}
+	var err error
+	if idx.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("ON"); err != nil {
+		return nil, err
+	}
+	if idx.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if idx.Columns, err = p.parseKeyPartList(); err != nil {
+		return nil, err
+	}
+	if p.eatKeyword("STORING") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for {
+			c, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			idx.Storing = append(idx.Storing, c)
+			if !p.eat(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.eat(",") {
+		if err := p.expectKeyword("INTERLEAVE", "IN"); err != nil {
+			return nil, err
+		}
+		if idx.Interleave, err = p.ident(); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// parseKeyPartList is ( column [ASC | DESC], ... ) を Parse する
+func (p *parser) parseKeyPartList() ([]KeyPart, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var list []KeyPart
+	for !p.eat(")") {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		k := KeyPart{Column: name}
+		if p.eatKeyword("DESC") {
+			k.Desc = true
+		} else {
+			p.eatKeyword("ASC")
+		}
+		list = append(list, k)
+		if !p.eat(",") {
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return list, nil
+}
+
+type token struct {
+	text string
+	line int
+}
+
+type parser struct {
+	tokens []*token
+	pos    int
+}
+
+// tokenize is DDL を token に分割する. コメントと空白は捨てる
+func tokenize(s string) []*token {
+	var tokens []*token
+	line := 1
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(s) && s[i+1] == '-', c == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '`':
+			j := strings.IndexByte(s[i+1:], '`')
+			if j < 0 {
+				j = len(s) - i - 1
+			}
+			tokens = append(tokens, &token{text: s[i+1 : i+1+j], line: line})
+			i += j + 2
+		case isIdentChar(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, &token{text: s[i:j], line: line})
+			i = j
+		default:
+			tokens = append(tokens, &token{text: string(c), line: line})
+			i++
+		}
+	}
+	return tokens
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) next() *token {
+	if p.done() {
+		return nil
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.done() {
+		return fmt.Errorf("unexpected end of ddl: %s", msg)
+	}
+	t := p.tokens[p.pos]
+	return fmt.Errorf("line %d: near %q: %s", t.line, t.text, msg)
+}
+
+// eat is 次の token が want であれば読み進めて true を返す
+func (p *parser) eat(want string) bool {
+	if p.done() || p.tokens[p.pos].text != want {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) expect(want string) error {
+	if !p.eat(want) {
+		return p.errorf("want %s", want)
+	}
+	return nil
+}
+
+// peekKeyword is 次の token が keywords と一致するかどうかを返す. 読み進めはしない
+func (p *parser) peekKeyword(keywords ...string) bool {
+	if p.pos+len(keywords) > len(p.tokens) {
+		return false
+	}
+	for i, k := range keywords {
+		if !strings.EqualFold(p.tokens[p.pos+i].text, k) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) eatKeyword(keywords ...string) bool {
+	if !p.peekKeyword(keywords...) {
+		return false
+	}
+	p.pos += len(keywords)
+	return true
+}
+
+func (p *parser) expectKeyword(keywords ...string) error {
+	if !p.eatKeyword(keywords...) {
+		return p.errorf("want %s", strings.Join(keywords, " "))
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	if p.done() {
+		return "", p.errorf("want identifier")
+	}
+	// `` のような空の Identifier も Token になるので、先頭の文字を見る前に長さを確かめる
+	if text := p.tokens[p.pos].text; text == "" || !isIdentChar(text[0]) {
+		return "", p.errorf("want identifier")
+	}
+	return p.next().text, nil
+}
+
+// SplitStatements is DDL を ; で Statement ごとに分ける
+// UpdateDatabaseDdl に渡せるように、Comment と末尾の ; は取り除き、空の Statement は返さない
+func SplitStatements(ddl string) []string {
+	var list []string
+	var cur strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			list = append(list, s)
+		}
+		cur.Reset()
+	}
+	for i := 0; i < len(ddl); i++ {
+		c := ddl[i]
+		switch {
+		case c == '-' && i+1 < len(ddl) && ddl[i+1] == '-', c == '#':
+			for i+1 < len(ddl) && ddl[i+1] != '\n' {
+				i++
+			}
+		case c == '`' || c == '"' || c == '\'':
+			// 閉じる quote までをそのまま書き込む. 閉じていない場合は最後まで
+			end := len(ddl)
+			if j := strings.IndexByte(ddl[i+1:], c); j >= 0 {
+				end = i + j + 2
+			}
+			cur.WriteString(ddl[i:end])
+			i = end - 1
+		case c == ';':
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return list
+}
+
+// ReadStatements is dir にある *.sql をファイル名の順に読み込んで Statement ごとに分ける
+func ReadStatements(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: no .sql files", dir)
+	}
+	sort.Strings(paths)
+
+	var list []string
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, SplitStatements(string(b))...)
+	}
+	return list, nil
+}
@@ -0,0 +1,222 @@
+package schema_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sinmetal/mutation_count_playground/schema"
+)
+
+func TestParseFile_AllDDL(t *testing.T) {
+	paths, err := filepath.Glob("../ddl/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("ddl files are not found")
+	}
+	for _, p := range paths {
+		p := p
+		t.Run(filepath.Base(p), func(t *testing.T) {
+			s, err := schema.ParseFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.Tables) == 0 {
+				t.Errorf("%s has no tables", p)
+			}
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	s, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 10, len(s.Tables); e != g {
+		t.Errorf("want tables %d but got %d", e, g)
+	}
+}
+
+func TestParseFile_Measure(t *testing.T) {
+	s, err := schema.ParseFile("../ddl/measure.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := s.Table("measure")
+	if tbl == nil {
+		t.Fatal("Measure is not found")
+	}
+	if e, g := 15, len(tbl.Columns); e != g {
+		t.Errorf("want columns %d but got %d", e, g)
+	}
+	if c := tbl.Column("ID"); c == nil || !c.NotNull || c.Type != "STRING(MAX)" {
+		t.Errorf("unexpected ID column %+v", c)
+	}
+	if c := tbl.Column("Arr1"); c == nil || c.Type != "ARRAY<STRING(MAX)>" {
+		t.Errorf("unexpected Arr1 column %+v", c)
+	}
+	if c := tbl.Column("CommitedAt"); c == nil || !c.AllowCommitTimestamp || c.Type != "TIMESTAMP" {
+		t.Errorf("unexpected CommitedAt column %+v", c)
+	}
+	if !tbl.IsKeyColumn("ID") {
+		t.Errorf("ID is not key column")
+	}
+	if e, g := 3, len(tbl.Indexes); e != g {
+		t.Fatalf("want indexes %d but got %d", e, g)
+	}
+	idx := tbl.Indexes[2]
+	if e, g := "MeasureWithIndex2_2", idx.Name; e != g {
+		t.Errorf("want index %s but got %s", e, g)
+	}
+	if len(idx.Columns) != 1 || idx.Columns[0].Column != "WithIndex2" || !idx.Columns[0].Desc {
+		t.Errorf("unexpected index columns %+v", idx.Columns)
+	}
+}
+
+func TestParseFile_CompositeIndex(t *testing.T) {
+	s, err := schema.ParseFile("../ddl/measure_composite_index.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := s.Table("MeasureCompositeIndex")
+	if e, g := 4, len(tbl.Indexes); e != g {
+		t.Fatalf("want indexes %d but got %d", e, g)
+	}
+	idx := tbl.Indexes[3]
+	want := []schema.KeyPart{{Column: "WithCompositeIndex1"}, {Column: "WithCompositeIndex2", Desc: true}}
+	if len(idx.Columns) != len(want) {
+		t.Fatalf("unexpected index columns %+v", idx.Columns)
+	}
+	for i := range want {
+		if e, g := want[i], idx.Columns[i]; e != g {
+			t.Errorf("want %+v but got %+v", e, g)
+		}
+	}
+}
+
+func TestParseFile_StoringIndex(t *testing.T) {
+	s, err := schema.ParseFile("../ddl/measure_storing_index.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := s.Table("MeasureWithStoring")
+	if e, g := 2, len(tbl.Indexes); e != g {
+		t.Fatalf("want indexes %d but got %d", e, g)
+	}
+	if e, g := []string{"Storing1"}, tbl.Indexes[0].Storing; len(g) != 1 || e[0] != g[0] {
+		t.Errorf("want storing %v but got %v", e, g)
+	}
+	if e, g := []string{"Storing1", "Storing2"}, tbl.Indexes[1].Storing; len(g) != 2 || e[0] != g[0] || e[1] != g[1] {
+		t.Errorf("want storing %v but got %v", e, g)
+	}
+}
+
+func TestParseFile_Interleave(t *testing.T) {
+	cases := []struct {
+		path         string
+		child        string
+		parent       string
+		onDelete     schema.OnDelete
+		childIndexes int
+	}{
+		{"../ddl/measure_interleave.sql", "MeasureChild", "MeasureParent", schema.Cascade, 0},
+		{"../ddl/measure_interleave_index.sql", "MeasureChildWithIndex", "MeasureParentWithIndex", schema.Cascade, 1},
+		{"../ddl/measure_interleave_no_cascade.sql", "MeasureChildNoCascade", "MeasureParentNoCascade", schema.NoAction, 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.child, func(t *testing.T) {
+			s, err := schema.ParseFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			child := s.Table(tt.child)
+			if child == nil || child.Interleave == nil {
+				t.Fatalf("%s is not interleaved", tt.child)
+			}
+			if e, g := tt.parent, child.Interleave.Parent; e != g {
+				t.Errorf("want parent %s but got %s", e, g)
+			}
+			if e, g := tt.onDelete, child.Interleave.OnDelete; e != g {
+				t.Errorf("want on delete %v but got %v", e, g)
+			}
+			if e, g := 2, len(child.PrimaryKey); e != g {
+				t.Errorf("want primary key %d but got %d", e, g)
+			}
+			if e, g := tt.childIndexes, len(child.Indexes); e != g {
+				t.Errorf("want indexes %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	cases := []struct {
+		name string
+		ddl  string
+	}{
+		{"unknown index table", "CREATE INDEX Idx ON Hoge (Col1)"},
+		{"unknown index column", "CREATE TABLE T (ID STRING(MAX)) PRIMARY KEY (ID); CREATE INDEX Idx ON T (Col1)"},
+		{"unknown parent", "CREATE TABLE T (ID STRING(MAX)) PRIMARY KEY (ID), INTERLEAVE IN PARENT P"},
+		{"missing primary key", "CREATE TABLE T (ID STRING(MAX))"},
+		{"unsupported statement", "DROP TABLE T"},
+		{"empty table name", "CREATE TABLE `` (ID STRING(MAX)) PRIMARY KEY (ID)"},
+		{"empty column name", "CREATE TABLE T (`` STRING(MAX)) PRIMARY KEY (ID)"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := schema.Parse(tt.ddl); err == nil {
+				t.Errorf("want err but got err is nil")
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	cases := []struct {
+		name string
+		ddl  string
+		want []string
+	}{
+		{"single", "CREATE TABLE A (ID STRING(MAX)) PRIMARY KEY (ID);\n", []string{"CREATE TABLE A (ID STRING(MAX)) PRIMARY KEY (ID)"}},
+		{"no trailing semicolon", "CREATE TABLE A (ID STRING(MAX)) PRIMARY KEY (ID);\nCREATE INDEX AByID ON A (ID)", []string{"CREATE TABLE A (ID STRING(MAX)) PRIMARY KEY (ID)", "CREATE INDEX AByID ON A (ID)"}},
+		{"comment", "-- hoge; fuga\nCREATE INDEX AByID ON A (ID); # piyo;\n", []string{"CREATE INDEX AByID ON A (ID)"}},
+		{"quoted", "CREATE TABLE `A;B` (ID STRING(MAX)) PRIMARY KEY (ID);", []string{"CREATE TABLE `A;B` (ID STRING(MAX)) PRIMARY KEY (ID)"}},
+		{"empty", " ;\n; ", nil},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := schema.SplitStatements(tt.ddl)
+			if e, g := len(tt.want), len(got); e != g {
+				t.Fatalf("want statements %d but got %d. %q", e, g, got)
+			}
+			for i := range tt.want {
+				if e, g := tt.want[i], got[i]; e != g {
+					t.Errorf("want %q but got %q", e, g)
+				}
+			}
+		})
+	}
+}
+
+func TestReadStatements(t *testing.T) {
+	list, err := schema.ReadStatements("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := schema.Parse(strings.Join(list, ";\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 10, len(s.Tables); e != g {
+		t.Errorf("want tables %d but got %d", e, g)
+	}
+}
@@ -0,0 +1,116 @@
+// Package schema is Spanner の Schema を Mutation 数の見積もりに必要な範囲で表現する
+package schema
+
+import "strings"
+
+// Schema is Database に含まれる Table の集合
+type Schema struct {
+	Tables []*Table
+}
+
+// Table is name に一致する Table を返す
+// Spanner の識別子は大文字小文字を区別しないので、EqualFold で比較する
+func (s *Schema) Table(name string) *Table {
+	for _, t := range s.Tables {
+		if strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// Table is CREATE TABLE で作成される Table
+type Table struct {
+	Name       string
+	Columns    []*Column
+	PrimaryKey []KeyPart
+	Interleave *Interleave
+
+	// Indexes is この Table に対して作成された Secondary Index
+	Indexes []*Index
+}
+
+// Column is name に一致する Column を返す
+func (t *Table) Column(name string) *Column {
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// IsKeyColumn is name が Primary Key の Column かどうかを返す
+func (t *Table) IsKeyColumn(name string) bool {
+	for _, k := range t.PrimaryKey {
+		if strings.EqualFold(k.Column, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Column is Table の Column
+type Column struct {
+	Name    string
+	Type    string
+	NotNull bool
+
+	// AllowCommitTimestamp is OPTIONS (allow_commit_timestamp=true) が指定されているかどうか
+	AllowCommitTimestamp bool
+}
+
+// KeyPart is Primary Key や Index を構成する Column
+type KeyPart struct {
+	Column string
+	Desc   bool
+}
+
+// Index is CREATE INDEX で作成される Secondary Index
+type Index struct {
+	Name         string
+	Table        string
+	Columns      []KeyPart
+	Storing      []string
+	Unique       bool
+	NullFiltered bool
+
+	// Interleave is INTERLEAVE IN で指定された Table. 指定されていない場合は空
+	Interleave string
+}
+
+// HasColumn is name が Index の Key Column に含まれるかどうかを返す
+func (idx *Index) HasColumn(name string) bool {
+	for _, k := range idx.Columns {
+		if strings.EqualFold(k.Column, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stores is name が STORING 句に含まれるかどうかを返す
+func (idx *Index) Stores(name string) bool {
+	for _, c := range idx.Storing {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Interleave is INTERLEAVE IN PARENT 句
+type Interleave struct {
+	Parent   string
+	OnDelete OnDelete
+}
+
+// OnDelete is INTERLEAVE の ON DELETE の動作
+type OnDelete int
+
+const (
+	// NoAction is ON DELETE NO ACTION. 子の行が残っている親の行は削除できない
+	NoAction OnDelete = iota
+	// Cascade is ON DELETE CASCADE. 親の行を削除すると子の行も削除される
+	Cascade
+)
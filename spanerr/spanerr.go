@@ -0,0 +1,113 @@
+// Package spanerr is Client.Apply や ReadWriteTransaction が返した error を種類ごとの型に分類する
+//
+// spanner.Error (v1.0.0) は gRPC の Status Code と文言しか持たず、Status の Details は Client の中で捨てられるので
+// Code が InvalidArgument の error の文言を正規表現で調べて分類する. Spanner 側の文言が変わった場合は正規表現を直す
+package spanerr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+)
+
+// TooManyMutationsFormat is Mutation 数が上限を超えた時に Spanner が返す error の文言. %d は上限
+// fakespanner と applier.DryRun もこの文言で error を返すので、Classify で MutationLimitError に分類できる
+const TooManyMutationsFormat = "The transaction contains too many mutations. Insert and update operations count with the multiplicity of the number of columns they affect. For example, inserting values into one key column and four non-key columns count as five mutations total for the insert. Delete and delete range operations count as one mutation regardless of the number of columns affected. The current mutation limit is %d."
+
+// MutationLimitError is Commit に含まれる Mutation 数が上限を超えた
+type MutationLimitError struct {
+	// Limit is Server が返した Mutation 数の上限. 返ってこなかった場合は 0
+	Limit int
+	Err   error
+}
+
+func (e *MutationLimitError) Error() string {
+	return e.Err.Error()
+}
+
+// CommitSizeError is Commit のサイズが上限を超えた
+type CommitSizeError struct {
+	// Limit is Server が返した Commit サイズの上限 (bytes). 返ってこなかった場合は 0
+	Limit int64
+	Err   error
+}
+
+func (e *CommitSizeError) Error() string {
+	return e.Err.Error()
+}
+
+// InvalidArgumentError is 上記以外の InvalidArgument
+type InvalidArgumentError struct {
+	Err error
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return e.Err.Error()
+}
+
+var (
+	mutationLimitMessage = regexp.MustCompile(`(?i)too many mutations`)
+	mutationLimitValue   = regexp.MustCompile(`(?i)mutation limit is (\d+)`)
+	commitSizeMessage    = regexp.MustCompile(`(?i)(maximum total bytes-size|commit size|transaction is too large)`)
+	commitSizeValue      = regexp.MustCompile(`(?i)maximum size:? (\d+)`)
+)
+
+// Classify is err を MutationLimitError, CommitSizeError, InvalidArgumentError のいずれかに分類する
+// InvalidArgument 以外の error はそのまま返す
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch err.(type) {
+	case *MutationLimitError, *CommitSizeError, *InvalidArgumentError:
+		return err
+	}
+	if spanner.ErrCode(err) != codes.InvalidArgument {
+		return err
+	}
+
+	desc := spanner.ErrDesc(err)
+	switch {
+	case mutationLimitMessage.MatchString(desc):
+		e := &MutationLimitError{Err: err}
+		if v, ok := findNumber(mutationLimitValue, desc); ok {
+			e.Limit = int(v)
+		}
+		return e
+	case commitSizeMessage.MatchString(desc):
+		e := &CommitSizeError{Err: err}
+		if v, ok := findNumber(commitSizeValue, desc); ok {
+			e.Limit = v
+		}
+		return e
+	default:
+		return &InvalidArgumentError{Err: err}
+	}
+}
+
+// IsMutationLimit is err が Mutation 数の上限を超えたことによる error かどうかを返す
+func IsMutationLimit(err error) bool {
+	_, ok := Classify(err).(*MutationLimitError)
+	return ok
+}
+
+// IsCommitSize is err が Commit のサイズの上限を超えたことによる error かどうかを返す
+func IsCommitSize(err error) bool {
+	_, ok := Classify(err).(*CommitSizeError)
+	return ok
+}
+
+func findNumber(re *regexp.Regexp, text string) (int64, bool) {
+	m := re.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
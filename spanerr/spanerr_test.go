@@ -0,0 +1,92 @@
+package spanerr_test
+
+import (
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/spanerr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const tooManyMutations = "The transaction contains too many mutations. Insert and update operations count with the multiplicity of the number of columns they affect. For example, inserting values into one key column and four non-key columns count as five mutations total for the insert. Delete and delete range operations count as one mutation regardless of the number of columns affected. The current mutation limit is 20000."
+
+const tooLarge = "The transaction exceeds the maximum total bytes-size that can be handled by Spanner. Please reduce the size or number of the writes, or use fewer indexes. (Maximum size: 104857600)"
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		wantType  string
+		wantLimit int64
+	}{
+		{"spanner error mutation limit", &spanner.Error{Code: codes.InvalidArgument, Desc: tooManyMutations}, "mutation", 20000},
+		{"grpc status mutation limit", status.Error(codes.InvalidArgument, tooManyMutations), "mutation", 20000},
+		{"mutation limit format", status.Errorf(codes.InvalidArgument, spanerr.TooManyMutationsFormat, 80000), "mutation", 80000},
+		{"mutation limit without value", status.Error(codes.InvalidArgument, "The transaction contains too many mutations."), "mutation", 0},
+		{"commit size", &spanner.Error{Code: codes.InvalidArgument, Desc: tooLarge}, "size", 104857600},
+		{"other invalid argument", &spanner.Error{Code: codes.InvalidArgument, Desc: "Column Hoge is not found"}, "invalid", 0},
+		{"not found", &spanner.Error{Code: codes.NotFound, Desc: "Table Hoge is not found"}, "other", 0},
+		{"go error", errors.New("too many mutations"), "other", 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := spanerr.Classify(tt.err)
+			switch v := got.(type) {
+			case *spanerr.MutationLimitError:
+				if e, g := tt.wantType, "mutation"; e != g {
+					t.Fatalf("want %s but got %s", e, g)
+				}
+				if e, g := tt.wantLimit, int64(v.Limit); e != g {
+					t.Errorf("want limit %d but got %d", e, g)
+				}
+			case *spanerr.CommitSizeError:
+				if e, g := tt.wantType, "size"; e != g {
+					t.Fatalf("want %s but got %s", e, g)
+				}
+				if e, g := tt.wantLimit, v.Limit; e != g {
+					t.Errorf("want limit %d but got %d", e, g)
+				}
+			case *spanerr.InvalidArgumentError:
+				if e, g := tt.wantType, "invalid"; e != g {
+					t.Fatalf("want %s but got %s", e, g)
+				}
+			default:
+				if e, g := tt.wantType, "other"; e != g {
+					t.Fatalf("want %s but got %s", e, g)
+				}
+				if got != tt.err {
+					t.Errorf("want original error but got %v", got)
+				}
+			}
+			if e, g := tt.err.Error(), got.Error(); e != g {
+				t.Errorf("want message %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestClassify_Nil(t *testing.T) {
+	if err := spanerr.Classify(nil); err != nil {
+		t.Errorf("want nil but got %v", err)
+	}
+	if spanerr.IsMutationLimit(nil) {
+		t.Errorf("nil is not mutation limit error")
+	}
+}
+
+func TestIsMutationLimit(t *testing.T) {
+	err := &spanner.Error{Code: codes.InvalidArgument, Desc: tooManyMutations}
+	if !spanerr.IsMutationLimit(err) {
+		t.Errorf("want mutation limit error")
+	}
+	if !spanerr.IsMutationLimit(spanerr.Classify(err)) {
+		t.Errorf("classified error is not mutation limit error")
+	}
+	if spanerr.IsCommitSize(err) {
+		t.Errorf("mutation limit error is not commit size error")
+	}
+}
@@ -0,0 +1,157 @@
+// Package telemetry is Commit ごとに見積もった Mutation 数を OpenTelemetry の Metrics と Span の Attribute として記録する
+//
+// Recorder を Commit の gRPC の Interceptor として spanner.NewClient に指定すると、Commit の RPC ごとに CommitRequest の Mutation を見積もって記録する
+// Attribute は新しい Span を作らずに、Commit の RPC の ctx の Span に付ける
+// otelgrpc などの Interceptor を Recorder より前に指定している場合はその Commit の RPC の Span に、そうでない場合は Apply を呼んだ ctx の Span に付く
+//
+//	r, err := telemetry.NewRecorder(s, otel.GetMeterProvider())
+//	client, err := spanner.NewClient(ctx, database, r.ClientOption())
+//
+// Cloud Spanner の Client (v1.0.0) 自身の Span は OpenCensus なので、その Span には Attribute を付けない
+package telemetry
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/estimator"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/option"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc"
+)
+
+// ScopeName is Meter の Instrumentation Scope の名前
+const ScopeName = "github.com/sinmetal/mutation_count_playground/telemetry"
+
+// Metrics の名前
+const (
+	// MetricMutationCount is 1 つの Commit の Table と Op ごとの Mutation 数の Histogram
+	MetricMutationCount = "mutation_count_playground.commit.mutation_count"
+	// MetricTotalMutationCount is 1 つの Commit の Mutation 数の合計の Histogram
+	MetricTotalMutationCount = "mutation_count_playground.commit.total_mutation_count"
+)
+
+// CommitMethod is Commit の gRPC の method 名
+const CommitMethod = "/google.spanner.v1.Spanner/Commit"
+
+var (
+	// KeyTable is Mutation の対象の Table
+	KeyTable = attribute.Key("table")
+	// KeyOp is Mutation の操作 (Insert, Update, ...)
+	KeyOp = attribute.Key("op")
+
+	// Buckets is Mutation 数の Histogram の境界. 上限の 20000 に近いところを細かくしている
+	Buckets = []float64{0, 10, 100, 1000, 5000, 10000, 15000, 18000, 19000, 20000, 40000, 80000}
+)
+
+// Span の Attribute の名前
+const (
+	// AttributeTotal is Commit の Mutation 数の合計
+	AttributeTotal = "mutation_count.total"
+	// AttributePrefix is Table と Op ごとの Mutation 数の Attribute の prefix. "mutation_count.Measure.Insert" の形になる
+	AttributePrefix = "mutation_count."
+)
+
+// Recorder is Schema で見積もった Commit の Mutation 数を Metrics と Span の Attribute に記録する
+type Recorder struct {
+	schema        *schema.Schema
+	mutationCount metric.Int64Histogram
+	totalCount    metric.Int64Histogram
+}
+
+// NewRecorder is mp の Meter に Histogram を作成した Recorder を返す
+func NewRecorder(s *schema.Schema, mp metric.MeterProvider) (*Recorder, error) {
+	meter := mp.Meter(ScopeName)
+	mutationCount, err := meter.Int64Histogram(MetricMutationCount,
+		metric.WithDescription("Estimated mutation count of a commit per table and operation"),
+		metric.WithUnit("{mutation}"),
+		metric.WithExplicitBucketBoundaries(Buckets...))
+	if err != nil {
+		return nil, err
+	}
+	totalCount, err := meter.Int64Histogram(MetricTotalMutationCount,
+		metric.WithDescription("Estimated total mutation count of a commit"),
+		metric.WithUnit("{mutation}"),
+		metric.WithExplicitBucketBoundaries(Buckets...))
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{schema: s, mutationCount: mutationCount, totalCount: totalCount}, nil
+}
+
+// Record is ms を 1 つの Commit として見積もり、Metrics と ctx の Span の Attribute に記録する
+// ctx に記録中の Span が無い場合は Metrics だけを記録する
+func (r *Recorder) Record(ctx context.Context, ms []*spanner.Mutation) (*estimator.Explanation, error) {
+	e, err := estimator.Explain(r.schema, ms)
+	if err != nil {
+		return nil, err
+	}
+	r.record(ctx, e)
+	return e, nil
+}
+
+func (r *Recorder) record(ctx context.Context, e *estimator.Explanation) {
+	type key struct {
+		table string
+		op    estimator.Op
+	}
+	counts := make(map[key]int)
+	var keys []key
+	for _, u := range e.Units {
+		k := key{u.Table, u.Op}
+		if _, ok := counts[k]; !ok {
+			keys = append(keys, k)
+		}
+		counts[k] += u.Count
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].table != keys[j].table {
+			return keys[i].table < keys[j].table
+		}
+		return keys[i].op < keys[j].op
+	})
+
+	attrs := []attribute.KeyValue{attribute.Int(AttributeTotal, e.Total)}
+	for _, k := range keys {
+		r.mutationCount.Record(ctx, int64(counts[k]), metric.WithAttributes(KeyTable.String(k.table), KeyOp.String(k.op.String())))
+		attrs = append(attrs, attribute.Int(AttributePrefix+k.table+"."+k.op.String(), counts[k]))
+	}
+	r.totalCount.Record(ctx, int64(e.Total))
+
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// UnaryClientInterceptor is Commit の RPC の前に CommitRequest の Mutation を見積もって記録する
+// Abort で Retry された Commit は RPC ごとに記録する. 見積もれない Mutation の場合は otel.Handle に error を渡して、記録せずに Commit する
+func (r *Recorder) UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if req, ok := req.(*sppb.CommitRequest); ok && method == CommitMethod {
+		if err := r.recordProto(ctx, req.Mutations); err != nil {
+			otel.Handle(err)
+		}
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (r *Recorder) recordProto(ctx context.Context, pbs []*sppb.Mutation) error {
+	ms, err := estimator.FromProtoAll(pbs)
+	if err != nil {
+		return err
+	}
+	e, err := estimator.ExplainMutations(r.schema, ms)
+	if err != nil {
+		return err
+	}
+	r.record(ctx, e)
+	return nil
+}
+
+// ClientOption is spanner.NewClient に UnaryClientInterceptor を指定する option. 他の Interceptor の後に連結する
+func (r *Recorder) ClientOption() option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(r.UnaryClientInterceptor))
+}
@@ -0,0 +1,174 @@
+package telemetry_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/mutation_count_playground/fakespanner"
+	"github.com/sinmetal/mutation_count_playground/schema"
+	"github.com/sinmetal/mutation_count_playground/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const database = "projects/fake/instances/fake/databases/fake"
+
+// histograms is reader に記録された name の Histogram の Data Point を table/op ごとに返す
+func histograms(t *testing.T, reader *sdkmetric.ManualReader, name string) map[string]metricdata.HistogramDataPoint[int64] {
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	points := make(map[string]metricdata.HistogramDataPoint[int64])
+	for _, sm := range rm.ScopeMetrics {
+		if sm.Scope.Name != telemetry.ScopeName {
+			continue
+		}
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Histogram[int64]).DataPoints {
+				table, _ := dp.Attributes.Value(telemetry.KeyTable)
+				op, _ := dp.Attributes.Value(telemetry.KeyOp)
+				points[table.AsString()+"/"+op.AsString()] = dp
+			}
+		}
+	}
+	return points
+}
+
+func TestRecorder_UnaryClientInterceptor(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := sdkmetric.NewManualReader()
+	r, err := telemetry.NewRecorder(sc, sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+
+	s, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddDatabase(database, sc)
+	client, err := spanner.NewClientWithConfig(ctx, database, spanner.ClientConfig{}, append(s.ClientOptions(), r.ClientOption())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var ms []*spanner.Mutation
+	for i := 0; i < 3; i++ {
+		// 1 行 [1:ID, 2:Col1, 3:MeasureWithIndex1_1, 4:MeasureWithIndex2_1, 5:MeasureWithIndex2_2]
+		ms = append(ms, spanner.InsertMap("Measure", map[string]interface{}{"ID": fmt.Sprintf("id-%d", i), "Col1": ""}))
+	}
+	// [1:Measure, 2:MeasureWithIndex1_1, 3:MeasureWithIndex2_1, 4:MeasureWithIndex2_2]
+	ms = append(ms, spanner.Delete("Measure", spanner.Key{"id-x"}))
+
+	commitCtx, span := tracer.Start(ctx, "commit")
+	if _, err := client.Apply(commitCtx, ms); err != nil {
+		t.Fatal(err)
+	}
+	span.End()
+
+	// Attribute は新しい Span を作らずに Commit の ctx の Span に付ける
+	ended := spans.Ended()
+	if e, g := 1, len(ended); e != g {
+		t.Fatalf("want spans %d but got %d", e, g)
+	}
+	if e, g := "commit", ended[0].Name(); e != g {
+		t.Errorf("want span name %s but got %s", e, g)
+	}
+	wantAttrs := map[attribute.Key]int64{
+		"mutation_count.total":          19,
+		"mutation_count.Measure.Insert": 15,
+		"mutation_count.Measure.Delete": 4,
+	}
+	if e, g := len(wantAttrs), len(ended[0].Attributes()); e != g {
+		t.Errorf("want attributes %d but got %v", e, ended[0].Attributes())
+	}
+	for _, kv := range ended[0].Attributes() {
+		if e, g := wantAttrs[kv.Key], kv.Value.AsInt64(); e != g {
+			t.Errorf("attribute %s want %d but got %d", kv.Key, e, g)
+		}
+	}
+
+	got := make(map[string]int64)
+	for k, dp := range histograms(t, reader, telemetry.MetricMutationCount) {
+		got[k] = dp.Sum
+	}
+	if e, g := fmt.Sprint(map[string]int64{"Measure/Insert": 15, "Measure/Delete": 4}), fmt.Sprint(got); e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+
+	total := histograms(t, reader, telemetry.MetricTotalMutationCount)["/"]
+	if e, g := uint64(1), total.Count; e != g {
+		t.Errorf("want commits %d but got %d", e, g)
+	}
+	if e, g := int64(19), total.Sum; e != g {
+		t.Errorf("want total %d but got %d", e, g)
+	}
+	if e, g := fmt.Sprint(telemetry.Buckets), fmt.Sprint(total.Bounds); e != g {
+		t.Errorf("want bounds %s but got %s", e, g)
+	}
+}
+
+func TestRecorder_Record(t *testing.T) {
+	ctx := context.Background()
+	sc, err := schema.LoadDir("../ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := sdkmetric.NewManualReader()
+	r, err := telemetry.NewRecorder(sc, sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		ms      []*spanner.Mutation
+		want    int
+		wantErr bool
+	}{
+		{"insert", []*spanner.Mutation{spanner.InsertMap("Measure", map[string]interface{}{"ID": "id", "Col1": ""})}, 5, false},
+		{"unknown table", []*spanner.Mutation{spanner.InsertMap("Unknown", map[string]interface{}{"ID": "id"})}, 0, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := r.Record(ctx, tt.ms)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want err but got %v", e)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, e.Total; e != g {
+				t.Errorf("want %d but got %d", e, g)
+			}
+		})
+	}
+
+	// 見積もれなかった Mutation は記録しない
+	if e, g := uint64(1), histograms(t, reader, telemetry.MetricTotalMutationCount)["/"].Count; e != g {
+		t.Errorf("want commits %d but got %d", e, g)
+	}
+}